@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/xorms/converter"
+	"github.com/magic-lib/go-plat-startupcfg/startupcfg"
+	"github.com/urfave/cli/v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	modelTemplateFile = "model.tpl"
+	daoTemplateFile   = "dao.tpl"
+)
+
+// genConfig gen 命令的配置，命令行参数优先于json配置
+type genConfig struct {
+	Dsn         string                  `json:"dsn"`
+	ConnCfg     *startupcfg.MysqlConfig `json:"conn_cfg"`
+	Include     []string                `json:"include"`      // 表名通配符，为空时全部生成
+	Exclude     []string                `json:"exclude"`      // 不生成的表名通配符
+	Prefix      string                  `json:"prefix"`       // 生成struct时去除的表前缀
+	Package     string                  `json:"package"`      // 包名，默认为输出目录名
+	TagKey      string                  `json:"tag_key"`      // 默认xorm
+	JsonTag     bool                    `json:"json_tag"`     // 是否添加json tag
+	Dao         bool                    `json:"dao"`          // 是否生成数据访问对象
+	NullType    string                  `json:"null_type"`    // pointer、sql、none
+	OutDir      string                  `json:"out_dir"`      // 输出目录，每个表一个文件
+	TemplateDir string                  `json:"template_dir"` // 模板目录，包含model.tpl、dao.tpl，有dao.tpl时生成数据访问对象
+}
+
+func genCommand() *cli.Command {
+	var jsonConfig string
+	var check bool
+	cfg := new(genConfig)
+	include := cli.NewStringSlice()
+	exclude := cli.NewStringSlice()
+	return &cli.Command{
+		Name:  "gen",
+		Usage: "Generate xorm models from MySQL tables",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "json-config", Destination: &jsonConfig, Usage: "json config file, flags take precedence"},
+			&cli.StringFlag{Name: "dsn", Destination: &cfg.Dsn, Usage: "user:pwd@tcp(host:port)/db"},
+			&cli.StringSliceFlag{Name: "include", Destination: include, Usage: "table name globs to generate, e.g. user_*"},
+			&cli.StringSliceFlag{Name: "exclude", Destination: exclude, Usage: "table name globs to skip"},
+			&cli.StringFlag{Name: "prefix", Destination: &cfg.Prefix, Usage: "table prefix stripped from struct names"},
+			&cli.StringFlag{Name: "package", Destination: &cfg.Package, Usage: "package name, default is the output dir name"},
+			&cli.StringFlag{Name: "tag-key", Destination: &cfg.TagKey, Usage: "struct tag key, default xorm"},
+			&cli.BoolFlag{Name: "json-tag", Destination: &cfg.JsonTag, Usage: "add json tags"},
+			&cli.BoolFlag{Name: "dao", Destination: &cfg.Dao, Usage: "generate a repository embedding xorms.Dao for each table"},
+			&cli.StringFlag{Name: "null-type", Destination: &cfg.NullType, Usage: "nullable columns: pointer, sql or none"},
+			&cli.StringFlag{Name: "out", Destination: &cfg.OutDir, Usage: "output directory"},
+			&cli.StringFlag{Name: "template-dir", Destination: &cfg.TemplateDir, Usage: "directory with model.tpl and dao.tpl"},
+			&cli.BoolFlag{Name: "check", Destination: &check, Usage: "only check that generated files are up to date"},
+		},
+		Action: func(c *cli.Context) error {
+			if jsonConfig != "" {
+				fileCfg := new(genConfig)
+				if err := readJsonFile(jsonConfig, fileCfg); err != nil {
+					return fmt.Errorf("读取配置文件失败: %w", err)
+				}
+				mergeGenConfig(c, fileCfg, cfg)
+				cfg = fileCfg
+			}
+			if c.IsSet("include") {
+				cfg.Include = include.Value()
+			}
+			if c.IsSet("exclude") {
+				cfg.Exclude = exclude.Value()
+			}
+			return runGen(cfg, check)
+		},
+	}
+}
+
+// mergeGenConfig 命令行设置了的参数覆盖json配置
+func mergeGenConfig(c *cli.Context, dst *genConfig, flags *genConfig) {
+	for name, set := range map[string]func(){
+		"dsn":          func() { dst.Dsn = flags.Dsn },
+		"prefix":       func() { dst.Prefix = flags.Prefix },
+		"package":      func() { dst.Package = flags.Package },
+		"tag-key":      func() { dst.TagKey = flags.TagKey },
+		"json-tag":     func() { dst.JsonTag = flags.JsonTag },
+		"dao":          func() { dst.Dao = flags.Dao },
+		"null-type":    func() { dst.NullType = flags.NullType },
+		"out":          func() { dst.OutDir = flags.OutDir },
+		"template-dir": func() { dst.TemplateDir = flags.TemplateDir },
+	} {
+		if c.IsSet(name) {
+			set()
+		}
+	}
+}
+
+func runGen(cfg *genConfig, check bool) error {
+	if cfg.Dsn == "" && cfg.ConnCfg != nil {
+		cfg.Dsn = cfg.ConnCfg.DatasourceName()
+	}
+	if cfg.Dsn == "" {
+		return fmt.Errorf("请设置数据库连接信息: --dsn 或 json配置")
+	}
+	if cfg.OutDir == "" {
+		return fmt.Errorf("请设置输出目录: --out")
+	}
+	outDir, err := filepath.Abs(cfg.OutDir)
+	if err != nil {
+		return err
+	}
+	if cfg.Package == "" {
+		cfg.Package = strings.ReplaceAll(filepath.Base(outDir), "-", "_")
+	}
+
+	t2s := converter.NewTable2Struct().
+		Dsn(cfg.Dsn).
+		Include(cfg.Include...).
+		Exclude(cfg.Exclude...).
+		Prefix(cfg.Prefix).
+		PackageName(cfg.Package).
+		TagKey(cfg.TagKey).
+		EnableJsonTag(cfg.JsonTag).
+		EnableDao(cfg.Dao).
+		Config(&converter.T2tConfig{
+			SeparateFile: true,
+			NullType:     cfg.NullType,
+		})
+	if cfg.TemplateDir != "" {
+		if err = loadTemplates(t2s, cfg.TemplateDir); err != nil {
+			return err
+		}
+	}
+	files, err := t2s.Generate()
+	if err != nil {
+		return err
+	}
+	if check {
+		return checkGenerated(outDir, files)
+	}
+	if err = os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	for _, one := range files {
+		if err = os.WriteFile(filepath.Join(outDir, one.Name), []byte(one.Content), 0o644); err != nil {
+			return fmt.Errorf("写入文件失败: %s, %w", one.Name, err)
+		}
+	}
+	fmt.Printf("generated %d files in %s\n", len(files), outDir)
+	return nil
+}
+
+// loadTemplates 读取模板目录中的模板，不存在的使用默认模板
+func loadTemplates(t2s *converter.Table2Struct, templateDir string) error {
+	content, err := os.ReadFile(filepath.Join(templateDir, modelTemplateFile))
+	if err == nil {
+		t2s.ModelTemplate(string(content))
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("读取模板失败: %w", err)
+	}
+	content, err = os.ReadFile(filepath.Join(templateDir, daoTemplateFile))
+	if err == nil {
+		t2s.DaoTemplate(string(content)).EnableDao(true)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("读取模板失败: %w", err)
+	}
+	return nil
+}
+
+// checkGenerated 检查输出目录中的文件是否与表结构一致，目录中多余的生成文件也视为过期
+func checkGenerated(outDir string, files []converter.GeneratedFile) error {
+	var stale []string
+	generated := make(map[string]struct{}, len(files))
+	for _, one := range files {
+		generated[one.Name] = struct{}{}
+		content, err := os.ReadFile(filepath.Join(outDir, one.Name))
+		if err != nil || !bytes.Equal(content, []byte(one.Content)) {
+			stale = append(stale, one.Name)
+		}
+	}
+	existFiles, _ := filepath.Glob(filepath.Join(outDir, "*.go"))
+	for _, one := range existFiles {
+		name := filepath.Base(one)
+		if _, ok := generated[name]; ok {
+			continue
+		}
+		content, err := os.ReadFile(one)
+		if err == nil && bytes.HasPrefix(content, []byte(converter.GeneratedHeader)) {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		return cli.Exit(fmt.Sprintf("generated models are out of date, run mysql-tools gen: %s", strings.Join(stale, ", ")), 1)
+	}
+	return nil
+}
+
+func readJsonFile(fileName string, data any) error {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, data)
+}
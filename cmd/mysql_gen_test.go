@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/magic-lib/go-plat-mysql/xorms/converter"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckGenerated(t *testing.T) {
+	outDir := t.TempDir()
+	files := []converter.GeneratedFile{
+		{Name: "user.go", Content: converter.GeneratedHeader + "\n\npackage model\n"},
+	}
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(outDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := checkGenerated(outDir, files); err == nil {
+		t.Error("missing file should be stale")
+	}
+	writeFile("user.go", files[0].Content)
+	writeFile("helper.go", "package model\n")
+	if err := checkGenerated(outDir, files); err != nil {
+		t.Errorf("up to date: %v", err)
+	}
+
+	writeFile("user.go", files[0].Content+"// edited\n")
+	if err := checkGenerated(outDir, files); err == nil {
+		t.Error("modified file should be stale")
+	}
+
+	writeFile("user.go", files[0].Content)
+	writeFile("dropped_table.go", converter.GeneratedHeader+"\n\npackage model\n")
+	if err := checkGenerated(outDir, files); err == nil {
+		t.Error("generated file of a dropped table should be stale")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/migrate"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"github.com/urfave/cli/v2"
+	"os"
+	"time"
+)
+
+func migrateCommand() *cli.Command {
+	var dsn, dir, tableName string
+	var dryRun bool
+	var steps int
+	var version int64
+	var applied bool
+
+	// withMigrator 连接数据库并读取迁移目录
+	withMigrator := func(fn func(ctx context.Context, m *migrate.Migrator) error) cli.ActionFunc {
+		return func(c *cli.Context) error {
+			ctx := c.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			list, err := migrate.LoadDir(dir)
+			if err != nil {
+				return err
+			}
+			dbConn, err := sqlcomm.MysqlConnect(dsn, schemaConnTimeout)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = dbConn.Close() }()
+			opts := []migrate.Option{migrate.WithMigrations(list...)}
+			if tableName != "" {
+				opts = append(opts, migrate.WithTableName(tableName))
+			}
+			if dryRun {
+				opts = append(opts, migrate.WithDryRun(os.Stdout))
+			}
+			m, err := migrate.NewMigrator(dbConn, opts...)
+			if err != nil {
+				return err
+			}
+			return fn(ctx, m)
+		}
+	}
+	printApplied := func(list []*migrate.Migration, err error) error {
+		for _, one := range list {
+			fmt.Printf("-- %d_%s\n", one.Version, one.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("-- nothing to migrate")
+		}
+		return nil
+	}
+
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "Run versioned sql migrations from --dir against --dsn",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "dsn", Destination: &dsn, Required: true, Usage: "database to migrate"},
+			&cli.StringFlag{Name: "dir", Destination: &dir, Value: "migrations", Usage: "directory of VERSION_NAME.up.sql and VERSION_NAME.down.sql files"},
+			&cli.StringFlag{Name: "table", Destination: &tableName, Usage: "history table, default " + migrate.DefaultTableName},
+			&cli.BoolFlag{Name: "dry-run", Destination: &dryRun, Usage: "print the statements without executing them"},
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:  "up",
+				Usage: "apply all pending migrations",
+				Action: withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+					return printApplied(m.Up(ctx))
+				}),
+			},
+			{
+				Name:  "down",
+				Usage: "roll back the last --steps migrations",
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "steps", Destination: &steps, Value: 1, Usage: "number of migrations to roll back"},
+				},
+				Action: withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+					return printApplied(m.Down(ctx, steps))
+				}),
+			},
+			{
+				Name:  "to",
+				Usage: "migrate up or down to --version",
+				Flags: []cli.Flag{
+					&cli.Int64Flag{Name: "version", Destination: &version, Required: true, Usage: "target version, 0 rolls back everything"},
+				},
+				Action: withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+					return printApplied(m.To(ctx, version))
+				}),
+			},
+			{
+				Name:  "force",
+				Usage: "clear the dirty mark of --version after fixing the database by hand",
+				Flags: []cli.Flag{
+					&cli.Int64Flag{Name: "version", Destination: &version, Required: true, Usage: "dirty version"},
+					&cli.BoolFlag{Name: "applied", Destination: &applied, Value: true, Usage: "keep the version as applied, false removes it from the history"},
+				},
+				Action: withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+					return m.Force(ctx, version, applied)
+				}),
+			},
+			{
+				Name:  "status",
+				Usage: "list migrations and whether they are applied",
+				Action: withMigrator(func(ctx context.Context, m *migrate.Migrator) error {
+					list, err := m.Status(ctx)
+					if err != nil {
+						return err
+					}
+					for _, one := range list {
+						state := "pending"
+						if one.Applied {
+							state = "applied " + one.AppliedAt.Format(time.DateTime)
+						}
+						if one.Dirty {
+							state = "dirty " + one.AppliedAt.Format(time.DateTime)
+						}
+						if one.ChecksumMismatch {
+							state += " (modified)"
+						}
+						if one.Missing {
+							state += " (missing)"
+						}
+						fmt.Printf("%d\t%s\t%s\n", one.Version, one.Name, state)
+					}
+					return nil
+				}),
+			},
+		},
+	}
+}
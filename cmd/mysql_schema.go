@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/schema"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"github.com/urfave/cli/v2"
+	"time"
+)
+
+const schemaConnTimeout = 10 * time.Second
+
+func schemaDiffCommand() *cli.Command {
+	var dsn, targetDsn string
+	var allowDrop, ignoreComment, apply, printJson bool
+	tables := cli.NewStringSlice()
+	return &cli.Command{
+		Name:  "schema-diff",
+		Usage: "Diff the schema of --dsn against --target-dsn and print or apply the migration",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "dsn", Destination: &dsn, Required: true, Usage: "database to migrate"},
+			&cli.StringFlag{Name: "target-dsn", Destination: &targetDsn, Required: true, Usage: "database with the desired schema"},
+			&cli.StringSliceFlag{Name: "table", Destination: tables, Usage: "only diff these tables"},
+			&cli.BoolFlag{Name: "allow-drop", Destination: &allowDrop, Usage: "drop tables and columns missing in the target"},
+			&cli.BoolFlag{Name: "ignore-comment", Destination: &ignoreComment, Usage: "ignore table and column comments"},
+			&cli.BoolFlag{Name: "json", Destination: &printJson, Usage: "print the plan as json"},
+			&cli.BoolFlag{Name: "apply", Destination: &apply, Usage: "execute the migration on --dsn"},
+		},
+		Action: func(c *cli.Context) error {
+			ctx := c.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			dbConn, err := sqlcomm.MysqlConnect(dsn, schemaConnTimeout)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = dbConn.Close() }()
+			targetConn, err := sqlcomm.MysqlConnect(targetDsn, schemaConnTimeout)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = targetConn.Close() }()
+
+			from, err := schema.LoadDatabase(ctx, dbConn, tables.Value()...)
+			if err != nil {
+				return err
+			}
+			to, err := schema.LoadDatabase(ctx, targetConn, tables.Value()...)
+			if err != nil {
+				return err
+			}
+			var opts []schema.DiffOption
+			if allowDrop {
+				opts = append(opts, schema.WithAllowDrop())
+			}
+			if ignoreComment {
+				opts = append(opts, schema.WithIgnoreComment())
+			}
+			plan := schema.Diff(from, to, opts...)
+			if printJson {
+				content, err := json.MarshalIndent(plan, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(content))
+			} else if plan.Empty() {
+				fmt.Println("-- schema is up to date")
+			} else {
+				fmt.Print(plan.String())
+			}
+			if !apply || plan.Empty() {
+				return nil
+			}
+			num, err := plan.Apply(ctx, dbConn)
+			if err != nil {
+				return fmt.Errorf("applied %d of %d statements: %w", num, len(plan.Statements), err)
+			}
+			fmt.Printf("-- applied %d statements\n", num)
+			return nil
+		},
+	}
+}
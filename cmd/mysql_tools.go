@@ -21,22 +21,39 @@ func main() {
 	app := &cli.App{
 		Name:  "mysql-tools",
 		Usage: "Tool for importing data into MySQL",
+		// 子命令执行前会先检查这里的必填参数，所以不设置Required，在Action中检查
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:        "tool-type",
 				Destination: &cmdConfig.ToolsType,
-				Required:    true,
-				Usage:       "tool-type: import",
+				Usage:       "tool-type: import, delete, modify, osc",
 			},
 			&cli.StringFlag{
 				Name:        "json-config",
 				Destination: &cmdConfig.JsonConfig,
-				Required:    true,
 				Usage:       "JsonConfig",
 			},
 		},
+		Commands: []*cli.Command{
+			genCommand(),
+			schemaDiffCommand(),
+			migrateCommand(),
+		},
 		Action: func(c *cli.Context) error {
-			jsonData, err := getToolsConfigFromFile(cmdConfig.JsonConfig)
+			if cmdConfig.ToolsType == "" || cmdConfig.JsonConfig == "" {
+				_ = cli.ShowAppHelp(c)
+				return fmt.Errorf("Required flags \"tool-type, json-config\" not set")
+			}
+			if cmdConfig.ToolsType == etl.MysqlMethodOsc {
+				oscData, err := getToolsConfigFromFile[etl.MySqlOscData](cmdConfig.JsonConfig)
+				if err != nil {
+					fmt.Println("getToolsConfigFromFile opening file:", err)
+					return err
+				}
+				return etl.NewMySqlOnlineSchemaChange(oscData).Start()
+			}
+
+			jsonData, err := getToolsConfigFromFile[etl.MySqlImportData](cmdConfig.JsonConfig)
 			if err != nil {
 				fmt.Println("getToolsConfigFromFile opening file:", err)
 				return err
@@ -70,7 +87,7 @@ func main() {
 	}
 }
 
-func getToolsConfigFromFile(jsonConfig string) (*etl.MySqlImportData, error) {
+func getToolsConfigFromFile[T any](jsonConfig string) (*T, error) {
 	// 打开 JSON 文件
 	file, err := os.Open(jsonConfig)
 	if err != nil {
@@ -84,7 +101,7 @@ func getToolsConfigFromFile(jsonConfig string) (*etl.MySqlImportData, error) {
 	}(file)
 
 	// 创建一个结构体变量用于存储解析后的数据
-	var data etl.MySqlImportData
+	var data T
 
 	// 解码 JSON 文件内容到结构体
 	decoder := json.NewDecoder(file)
@@ -24,6 +24,7 @@ func (b *batchMySqlTableImportCmd) CheckNewOrDelete() {
 		batchExecutor.LogTableName = b.batchMySqlImportData.LogTableName
 		batchExecutor.ErrorFilePath = b.batchMySqlImportData.ErrorFilePath
 		batchExecutor.PageLimit = b.batchMySqlImportData.PageLimit
+		batchExecutor.Ctx = b.batchMySqlImportData.Ctx
 
 		batchExecutor.FromPrimaryKey = oneImportTable.SrcPrimaryKey
 		batchExecutor.FromTableName = oneImportTable.SrcTableName
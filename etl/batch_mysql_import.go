@@ -1,6 +1,7 @@
 package etl
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/magic-lib/go-plat-mysql/sqlcomm"
@@ -10,9 +11,18 @@ import (
 	"github.com/magic-lib/go-plat-utils/templates/ruleengine"
 	"github.com/magic-lib/go-plat-utils/utils/httputil"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
 	"log"
 )
 
+// etl 每一页的span属性
+const (
+	attrEtlMethod   = attribute.Key("etl.method")
+	attrEtlPageNow  = attribute.Key("etl.page_now")
+	attrEtlPageSize = attribute.Key("etl.page_size")
+	attrEtlRows     = attribute.Key("etl.rows")
+)
+
 type batchMySqlTableImport struct {
 	srcMysqlDataSource *mysqlDataSource
 	toMysqlDataSource  *mysqlDataSource
@@ -36,6 +46,10 @@ type batchMySqlTableImport struct {
 	ToColumnMap map[string]string // 目标表字段和源表字段的映射关系
 
 	ExchangeFuncList []ExchangeFunc
+
+	RetryPolicy *sqlcomm.RetryPolicy //写入的重试策略，为nil时不重试
+
+	Ctx context.Context //链路追踪的上下文，每一页的span都在它下面
 }
 
 var exchangeFuncMap = map[string]ExchangeFunc{}
@@ -55,6 +69,52 @@ func newBatchMySqlTableImport(srcMysqlDataSource *mysqlDataSource, toMysqlDataSo
 	return b
 }
 
+func (b *batchMySqlTableImport) getCtx() context.Context {
+	if b.Ctx != nil {
+		return b.Ctx
+	}
+	return context.Background()
+}
+
+// runPage 执行一页，整页为一个span，查询、转换、写入、日志为它的子span
+func (b *batchMySqlTableImport) runPage(method string, importExec *mysqlImport, queryData *mysqlExport, logService *mysqlLogger,
+	startId string, pageNow int, pageSize int) (bool, error) {
+	ctx, span := sqlcomm.StartSpan(b.getCtx(), "etl page",
+		sqlcomm.AttrDbSystem.String("mysql"),
+		sqlcomm.AttrDbSqlTable.String(b.ToTableName),
+		attrEtlMethod.String(method),
+		attrEtlPageNow.Int(pageNow),
+		attrEtlPageSize.Int(pageSize))
+
+	isEndQuery, logRecord, whereCond, tempErr := b.importOrUpdateOneList(ctx, importExec, queryData, startId)
+	// 表示要插入日志
+	if logRecord != nil {
+		span.SetAttributes(attrEtlRows.Int(logRecord.SucNum))
+		_, logSpan := sqlcomm.StartSpan(ctx, "etl log")
+		id, logErr := logService.InsertLogRecord(&MysqlLogRecord{
+			TableName: b.ToTableName,
+			Method:    method,
+			StartId:   startId,
+			PageNow:   pageNow,
+			PageSize:  pageSize,
+		})
+
+		if logErr == nil {
+			if tempErr != nil {
+				logRecord.Errors = tempErr.Error()
+				logErr = logService.FailureLogRecord(id, logRecord, whereCond)
+				fmt.Println("执行runOneList语句时错误: ", tempErr)
+			} else {
+				logErr = logService.SuccessLogRecord(id, logRecord, whereCond)
+			}
+		}
+		sqlcomm.EndSpan(logSpan, logErr)
+	}
+	sqlcomm.EndSpan(span, tempErr)
+
+	return isEndQuery, tempErr
+}
+
 func (b *batchMySqlTableImport) mysqlDb() error {
 	srcMysqlConn, err := newMysqlDataSource(b.srcMysqlDataSource)
 
@@ -126,32 +186,10 @@ func (b *batchMySqlTableImport) batchImport() error {
 	}
 	importExec.ErrorFilePrefix = b.ErrorFilePath
 	importExec.DstInsertType = b.DstInsertType
+	importExec.RetryPolicy = b.RetryPolicy
 
 	var insertLogRecord = func(startId string, pageNow int, pageSize int) (bool, error) {
-		// 全量导入
-		isEndQuery, logRecord, whereCond, tempErr := b.importOrUpdateOneList(importExec, queryData, startId)
-		// 表示要插入日志
-		if logRecord != nil {
-			id, logErr := logService.InsertLogRecord(&MysqlLogRecord{
-				TableName: b.ToTableName,
-				Method:    MysqlMethodImport,
-				StartId:   startId,
-				PageNow:   pageNow,
-				PageSize:  pageSize,
-			})
-
-			if logErr == nil {
-				if tempErr != nil {
-					logRecord.Errors = tempErr.Error()
-					_ = logService.FailureLogRecord(id, logRecord, whereCond)
-					fmt.Println("执行runOneList语句时错误: ", tempErr)
-				} else {
-					_ = logService.SuccessLogRecord(id, logRecord, whereCond)
-				}
-			}
-		}
-
-		return isEndQuery, tempErr
+		return b.runPage(MysqlMethodImport, importExec, queryData, logService, startId, pageNow, pageSize)
 	}
 
 	if b.PageLimit == 0 {
@@ -394,32 +432,10 @@ func (b *batchMySqlTableImport) batchModify() error {
 		return err
 	}
 	importExec.ErrorFilePrefix = b.ErrorFilePath
+	importExec.RetryPolicy = b.RetryPolicy
 
 	var modifyLogRecord = func(startId string, pageNow int, pageSize int) (bool, error) {
-		// 全量导入
-		isEndQuery, logRecord, whereCond, tempErr := b.importOrUpdateOneList(importExec, queryData, startId)
-
-		if logRecord != nil {
-			id, logErr := logService.InsertLogRecord(&MysqlLogRecord{
-				TableName: b.ToTableName,
-				Method:    MysqlMethodModify,
-				StartId:   startId,
-				PageNow:   pageNow,
-				PageSize:  pageSize,
-			})
-
-			if logErr == nil {
-				if tempErr != nil {
-					logRecord.Errors = tempErr.Error()
-					_ = logService.FailureLogRecord(id, logRecord, whereCond)
-					fmt.Println("执行runOneList语句时错误: ", tempErr)
-				} else {
-					_ = logService.SuccessLogRecord(id, logRecord, whereCond)
-				}
-			}
-		}
-
-		return isEndQuery, tempErr
+		return b.runPage(MysqlMethodModify, importExec, queryData, logService, startId, pageNow, pageSize)
 	}
 
 	if b.PageLimit == 0 {
@@ -560,14 +576,17 @@ func (b *batchMySqlTableImport) getPageModel(logService *mysqlLogger, toTableNam
 	return page, false
 }
 
-func (b *batchMySqlTableImport) importOrUpdateOneList(importExec *mysqlImport, queryData *mysqlExport, startId string) (bool, *MysqlLogRecord, *sqlstatement.LogicCondition, error) {
-	return b.commRunOneList(importExec, queryData, startId, func(idList []string, dataList []map[string]any, pageNow int) (int, error) {
-		return importExec.importData(idList, pageNow, dataList)
+func (b *batchMySqlTableImport) importOrUpdateOneList(ctx context.Context, importExec *mysqlImport, queryData *mysqlExport, startId string) (bool, *MysqlLogRecord, *sqlstatement.LogicCondition, error) {
+	return b.commRunOneList(ctx, importExec, queryData, startId, func(ctx context.Context, idList []string, dataList []map[string]any, pageNow int) (int, error) {
+		return importExec.importData(ctx, idList, pageNow, dataList)
 	})
 }
 
-func (b *batchMySqlTableImport) commRunOneList(importExec *mysqlImport, queryData *mysqlExport, startId string, f func(idList []string, dataList []map[string]any, pageNow int) (int, error)) (bool, *MysqlLogRecord, *sqlstatement.LogicCondition, error) {
-	dataList, err := queryData.fetchDataList(startId)
+func (b *batchMySqlTableImport) commRunOneList(ctx context.Context, importExec *mysqlImport, queryData *mysqlExport, startId string, f func(ctx context.Context, idList []string, dataList []map[string]any, pageNow int) (int, error)) (bool, *MysqlLogRecord, *sqlstatement.LogicCondition, error) {
+	fetchCtx, fetchSpan := sqlcomm.StartSpan(ctx, "etl fetch")
+	dataList, err := queryData.fetchDataList(fetchCtx, startId)
+	fetchSpan.SetAttributes(attrEtlRows.Int(len(dataList)))
+	sqlcomm.EndSpan(fetchSpan, err)
 
 	logRecord := &MysqlLogRecord{}
 
@@ -586,6 +605,7 @@ func (b *batchMySqlTableImport) commRunOneList(importExec *mysqlImport, queryDat
 		}
 	}
 
+	_, transformSpan := sqlcomm.StartSpan(ctx, "etl transform")
 	dataList = importExec.defaultExchangeFunc(dataList)
 
 	//对整个数据做相应处理，这里是通用设置
@@ -600,6 +620,8 @@ func (b *batchMySqlTableImport) commRunOneList(importExec *mysqlImport, queryDat
 			dataList = exchangeFunc(dataList)
 		}
 	}
+	transformSpan.SetAttributes(attrEtlRows.Int(len(dataList)))
+	sqlcomm.EndSpan(transformSpan, nil)
 	if len(dataList) == 0 {
 		//表示过滤了，不用执行
 		return false, nil, nil, nil
@@ -645,7 +667,10 @@ func (b *batchMySqlTableImport) commRunOneList(importExec *mysqlImport, queryDat
 
 	}
 
-	sucNum, err := f(idList, dataList, queryData.page.PageNow)
+	writeCtx, writeSpan := sqlcomm.StartSpan(ctx, "etl write")
+	sucNum, err := f(writeCtx, idList, dataList, queryData.page.PageNow)
+	writeSpan.SetAttributes(attrEtlRows.Int(sucNum))
+	sqlcomm.EndSpan(writeSpan, err)
 	logRecord = &MysqlLogRecord{
 		SucNum: sucNum,
 		FromId: firstCurrId,
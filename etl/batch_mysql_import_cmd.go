@@ -1,7 +1,9 @@
 package etl
 
 import (
+	"context"
 	"fmt"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
 	"github.com/magic-lib/go-plat-startupcfg/startupcfg"
 	"github.com/magic-lib/go-plat-utils/goroutines"
 	"time"
@@ -14,6 +16,8 @@ type MySqlImportData struct {
 	ErrorFilePath  string                 `json:"error_file_path"`
 	PageLimit      uint                   `json:"page_limit"`
 	TableList      []oneImportTable       `json:"table_list"`
+	RetryPolicy    *sqlcomm.RetryPolicy   `json:"retry_policy"` //写入的重试策略，为nil时不重试
+	Ctx            context.Context        `json:"-"`            //链路追踪的上下文
 }
 
 type oneImportTable struct {
@@ -50,6 +54,8 @@ func (b *batchMySqlTableImportCmd) Start() {
 		batchExecutor.LogTableName = b.batchMySqlImportData.LogTableName
 		batchExecutor.ErrorFilePath = b.batchMySqlImportData.ErrorFilePath
 		batchExecutor.PageLimit = b.batchMySqlImportData.PageLimit
+		batchExecutor.Ctx = b.batchMySqlImportData.Ctx
+		batchExecutor.RetryPolicy = b.batchMySqlImportData.RetryPolicy
 
 		batchExecutor.FromPrimaryKey = oneImportTable.SrcPrimaryKey
 		batchExecutor.FromTableName = oneImportTable.SrcTableName
@@ -13,6 +13,7 @@ const (
 	MysqlMethodImport = "import"
 	MysqlMethodDelete = "delete"
 	MysqlMethodModify = "modify"
+	MysqlMethodOsc    = "osc"
 )
 
 // mysqlDataSource mysql数据源
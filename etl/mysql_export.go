@@ -1,7 +1,9 @@
 package etl
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/Masterminds/squirrel"
 	"github.com/magic-lib/go-plat-mysql/sqlcomm"
@@ -47,7 +49,7 @@ func (m *mysqlExport) checkFetchDataList() error {
 }
 
 // fetchDataList 获取数据列表
-func (m *mysqlExport) fetchDataList(startId string) ([]map[string]any, error) {
+func (m *mysqlExport) fetchDataList(ctx context.Context, startId string) ([]map[string]any, error) {
 	var sqlQuery = ""
 	var sqlParam []any
 	var page *httputil.PageModel
@@ -97,5 +99,23 @@ func (m *mysqlExport) fetchDataList(startId string) ([]map[string]any, error) {
 		}
 	}
 
-	return sqlcomm.MysqlQuery(m.dbConn, sqlQuery, sqlParam...)
+	return sqlcomm.MysqlQueryContext(ctx, m.dbConn, sqlQuery, sqlParam...)
+}
+
+// pageEndId 按主键分批时一页最后一行的主键，where 为剩余数据的范围，不满一页时返回false
+func (m *mysqlExport) pageEndId(ctx context.Context, where string, params ...any) (string, bool, error) {
+	sqlQuery, sqlParam, err := squirrel.Select(m.PrimaryKey).From(m.TableName).Where(where, params...).
+		OrderBy(m.PrimaryKey + " ASC").Limit(1).Offset(uint64(m.page.PageSize - 1)).ToSql()
+	if err != nil {
+		return "", false, err
+	}
+	var endId string
+	err = m.dbConn.QueryRowContext(ctx, sqlQuery, sqlParam...).Scan(&endId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return endId, true, nil
 }
@@ -1,6 +1,7 @@
 package etl
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/Masterminds/squirrel"
@@ -12,9 +13,10 @@ import (
 )
 
 type mysqlImport struct {
-	ErrorFilePrefix string `json:"error_file_prefix"`
-	ErrorFileSuffix string `json:"error_file_suffix"`
-	DstInsertType   string `json:"dst_insert_type"` //是insert into 还是 replace into
+	ErrorFilePrefix string               `json:"error_file_prefix"`
+	ErrorFileSuffix string               `json:"error_file_suffix"`
+	DstInsertType   string               `json:"dst_insert_type"` //是insert into 还是 replace into
+	RetryPolicy     *sqlcomm.RetryPolicy `json:"retry_policy"`    //写入遇到死锁、连接断开等错误时的重试策略，为nil时不重试
 	dbConn          *sql.DB
 	tableName       string
 	columnMap       map[string]*sqlcomm.MysqlColumn
@@ -73,7 +75,7 @@ func (m *mysqlImport) defaultExchangeFunc(dataList []map[string]any) []map[strin
 	}
 	return dataList
 }
-func (m *mysqlImport) importData(idList []string, pageNow int, dataList []map[string]any) (int, error) {
+func (m *mysqlImport) importData(ctx context.Context, idList []string, pageNow int, dataList []map[string]any) (int, error) {
 	if len(dataList) == 0 {
 		return 0, fmt.Errorf("数据不能为空")
 	}
@@ -144,7 +146,13 @@ func (m *mysqlImport) importData(idList []string, pageNow int, dataList []map[st
 		lastCurrId = idList[len(idList)-1]
 	}
 
-	ret, err := m.dbConn.Exec(sqlString, sqlValue...)
+	// insert ignore 与 replace into 都是幂等的，可以直接重试
+	var ret sql.Result
+	if m.RetryPolicy != nil {
+		ret, err = sqlcomm.MysqlExecRetry(ctx, m.dbConn, m.RetryPolicy, sqlString, sqlValue...)
+	} else {
+		ret, err = sqlcomm.MysqlExecContext(ctx, m.dbConn, sqlString, sqlValue...)
+	}
 	if err != nil {
 		err = fmt.Errorf("写入数据失败: %w %s", err, sqlString)
 		errTemp := m.writeError(conv.String(idList)+"\n"+sqlString+"\n"+conv.String(sqlValue), file)
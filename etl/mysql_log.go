@@ -316,3 +316,21 @@ func (m *mysqlLogger) ListPageNowErrorLog(tableName string, method string, start
 	}
 	return errPageNowList, nil
 }
+
+// FindLastLogRecord 查询表和方法最后一条记录
+func (m *mysqlLogger) FindLastLogRecord(tableName string, method string) (*MysqlLogRecord, error) {
+	selectSql := fmt.Sprintf(`SELECT * FROM %s where database_name = DATABASE() AND table_name = ? AND method = ? ORDER BY id DESC LIMIT 1`, m.logTableName)
+	mapList, err := sqlcomm.MysqlQuery(m.dbConn, selectSql, tableName, method)
+	if err != nil {
+		return nil, err
+	}
+	if len(mapList) == 0 {
+		return nil, nil
+	}
+	logRecord := &MysqlLogRecord{}
+	err = conv.Unmarshal(mapList[0], logRecord)
+	if err != nil {
+		return nil, err
+	}
+	return logRecord, nil
+}
@@ -0,0 +1,624 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"github.com/magic-lib/go-plat-startupcfg/startupcfg"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mysql 错误码
+const (
+	errNumTriggerExists uint16 = 1359 // Trigger already exists
+)
+
+// MySqlOscData 在线修改表结构，类似 pt-online-schema-change：
+// 按新结构建影子表，触发器同步变更，按主键分批复制数据，最后用 RENAME TABLE 原子切换。
+// 中断后重新执行会从日志表中最后成功的一批继续复制
+type MySqlOscData struct {
+	MysqlConfig       startupcfg.MysqlConfig `json:"mysql_config"`
+	LogTableName      string                 `json:"log_table_name"`
+	TableName         string                 `json:"table_name"`
+	Alter             string                 `json:"alter"`               //ALTER TABLE 表名 后面的部分，如 ADD COLUMN age INT NOT NULL DEFAULT 0
+	ChunkSize         uint                   `json:"chunk_size"`          //每批复制的行数，默认1000
+	ChunkSleepMs      uint                   `json:"chunk_sleep_ms"`      //每批之间的休眠毫秒数
+	MaxThreadsRunning int                    `json:"max_threads_running"` //Threads_running 超过时暂停复制，0为不检查
+	LockWaitTimeout   uint                   `json:"lock_wait_timeout"`   //切换表时等待元数据锁的秒数，默认5秒，超时按重试策略重试
+	KeepOldTable      bool                   `json:"keep_old_table"`      //切换后保留原表 _表名_old
+	NoSwap            bool                   `json:"no_swap"`             //复制完成后不切换，保留影子表和触发器，用于检查数据
+	AllowColumnDrop   bool                   `json:"allow_column_drop"`   //允许删除或重命名字段，这些字段的数据不会复制
+	AllowUniqueAdd    bool                   `json:"allow_unique_add"`    //允许新增唯一索引，重复的行复制时忽略、同步时覆盖
+	RetryPolicy       *sqlcomm.RetryPolicy   `json:"retry_policy"`        //复制和切换的重试策略，为nil时使用默认策略
+	Ctx               context.Context        `json:"-"`                   //链路追踪的上下文
+}
+
+type mysqlOnlineSchemaChange struct {
+	data       *MySqlOscData
+	dbConn     *sql.DB
+	logService *mysqlLogger
+	throttle   *mysqlThrottle
+	pageQuery  *mysqlExport //按主键分批
+
+	chunkSize   int
+	tableName   string
+	newTable    string //影子表
+	oldTable    string //切换后的原表
+	triggers    map[string]string
+	primaryKey  string
+	pkIsInt     bool
+	pkUnsigned  bool
+	columnNames []string //原表和影子表都有的字段
+	runId       string   //一次修改的标识，记录在日志的start_id中
+}
+
+// NewMySqlOnlineSchemaChange 在线修改表结构
+func NewMySqlOnlineSchemaChange(data *MySqlOscData) *mysqlOnlineSchemaChange {
+	return &mysqlOnlineSchemaChange{
+		data: data,
+	}
+}
+
+func (o *mysqlOnlineSchemaChange) getCtx() context.Context {
+	if o.data.Ctx != nil {
+		return o.data.Ctx
+	}
+	return context.Background()
+}
+
+// Start 执行在线修改
+func (o *mysqlOnlineSchemaChange) Start() error {
+	ctx := o.getCtx()
+	if err := o.init(); err != nil {
+		return err
+	}
+	if err := o.checkTable(ctx); err != nil {
+		return err
+	}
+	if err := o.createNewTable(ctx); err != nil {
+		return err
+	}
+	if err := o.createTriggers(ctx); err != nil {
+		return err
+	}
+	if err := o.copyRows(ctx); err != nil {
+		return err
+	}
+	if o.data.NoSwap {
+		fmt.Println("复制完成，未切换表:", o.newTable)
+		return nil
+	}
+	if err := o.swapTables(ctx); err != nil {
+		return err
+	}
+	fmt.Println("修改表结构完成:", o.tableName)
+	return nil
+}
+
+func (o *mysqlOnlineSchemaChange) init() error {
+	if o.data.TableName == "" {
+		return fmt.Errorf("表名不能为空")
+	}
+	alter := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(o.data.Alter), ";"))
+	if alter == "" {
+		return fmt.Errorf("修改语句不能为空")
+	}
+	o.data.Alter = alter
+
+	dataSource, err := newMysqlDataSource(&mysqlDataSource{ConnCfg: &o.data.MysqlConfig})
+	if err != nil {
+		return err
+	}
+	o.dbConn, err = dataSource.Connect()
+	if err != nil {
+		return err
+	}
+	o.logService, err = NewMysqlLogger(o.dbConn, o.data.LogTableName)
+	if err != nil {
+		return err
+	}
+	o.throttle = newMysqlThrottle(o.dbConn, time.Duration(o.data.ChunkSleepMs)*time.Millisecond, o.data.MaxThreadsRunning)
+
+	o.chunkSize = int(o.data.ChunkSize)
+	if o.chunkSize <= 0 {
+		o.chunkSize = 1000
+	}
+	o.tableName = o.data.TableName
+	o.newTable = "_" + o.tableName + "_new"
+	o.oldTable = "_" + o.tableName + "_old"
+	o.triggers = map[string]string{
+		"INSERT": "_" + o.tableName + "_osc_ins",
+		"UPDATE": "_" + o.tableName + "_osc_upd",
+		"DELETE": "_" + o.tableName + "_osc_del",
+	}
+	return nil
+}
+
+// checkTable 原表必须有单字段主键，不能有外键和触发器，切换后的表名不能已存在
+func (o *mysqlOnlineSchemaChange) checkTable(ctx context.Context) error {
+	columns, err := sqlcomm.MysqlTableColumns(o.dbConn, o.tableName)
+	if err != nil {
+		return fmt.Errorf("获取列失败: %w", err)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("表不存在: %s", o.tableName)
+	}
+	pkList := make([]*sqlcomm.MysqlColumn, 0)
+	for _, column := range columns {
+		if column.ColumnKey == "PRI" {
+			pkList = append(pkList, column)
+		}
+	}
+	if len(pkList) != 1 {
+		return fmt.Errorf("表必须有主键，目前不支持联合主键: %s", o.tableName)
+	}
+	o.primaryKey = pkList[0].ColumnName
+	switch pkList[0].DataType {
+	case "tinyint", "smallint", "mediumint", "int", "bigint":
+		o.pkIsInt = true
+	}
+	o.pkUnsigned = strings.Contains(pkList[0].ColumnType, "unsigned")
+
+	if err = o.checkForeignKeys(ctx); err != nil {
+		return err
+	}
+	if err = o.checkTriggers(ctx); err != nil {
+		return err
+	}
+
+	oldColumns, err := sqlcomm.MysqlTableColumns(o.dbConn, o.oldTable)
+	if err != nil {
+		return fmt.Errorf("获取列失败: %w", err)
+	}
+	if len(oldColumns) > 0 && !o.data.NoSwap {
+		return fmt.Errorf("表已存在，请先删除: %s", o.oldTable)
+	}
+	return nil
+}
+
+// checkForeignKeys 被其他表引用时切换后外键会指向原表，CREATE TABLE LIKE 不复制外键，表自己的外键切换后会丢失
+func (o *mysqlOnlineSchemaChange) checkForeignKeys(ctx context.Context) error {
+	mapList, err := sqlcomm.MysqlQueryContext(ctx, o.dbConn, `SELECT TABLE_NAME, CONSTRAINT_NAME FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+		WHERE REFERENCED_TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME = ? AND TABLE_NAME != ?`, o.tableName, o.tableName)
+	if err != nil {
+		return err
+	}
+	if len(mapList) > 0 {
+		return fmt.Errorf("表被其他表的外键引用，切换后外键会指向原表: %s", conv.String(mapList))
+	}
+	mapList, err = sqlcomm.MysqlQueryContext(ctx, o.dbConn, `SELECT CONSTRAINT_NAME, REFERENCED_TABLE_NAME FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL`, o.tableName)
+	if err != nil {
+		return err
+	}
+	if len(mapList) > 0 {
+		return fmt.Errorf("表有外键，影子表不会复制外键，切换后外键会丢失: %s", conv.String(mapList))
+	}
+	return nil
+}
+
+// checkTriggers 表已有的触发器切换后留在原表上，会随原表删除，同 pt-online-schema-change 不支持
+func (o *mysqlOnlineSchemaChange) checkTriggers(ctx context.Context) error {
+	mapList, err := sqlcomm.MysqlQueryContext(ctx, o.dbConn, `SELECT TRIGGER_NAME FROM INFORMATION_SCHEMA.TRIGGERS
+		WHERE EVENT_OBJECT_SCHEMA = DATABASE() AND EVENT_OBJECT_TABLE = ? AND TRIGGER_NAME NOT IN (?, ?, ?)`,
+		o.tableName, o.triggers["INSERT"], o.triggers["UPDATE"], o.triggers["DELETE"])
+	if err != nil {
+		return err
+	}
+	if len(mapList) > 0 {
+		return fmt.Errorf("表已有触发器，切换后会随原表删除: %s", conv.String(mapList))
+	}
+	return nil
+}
+
+// createNewTable 创建影子表，已存在时为上次中断的修改，修改语句相同时继续使用
+func (o *mysqlOnlineSchemaChange) createNewTable(ctx context.Context) error {
+	newColumns, err := sqlcomm.MysqlTableColumns(o.dbConn, o.newTable)
+	if err != nil {
+		return fmt.Errorf("获取列失败: %w", err)
+	}
+	created := false
+	if len(newColumns) > 0 {
+		last, err := o.logService.FindLastLogRecord(o.newTable, MysqlMethodOsc)
+		if err != nil {
+			return err
+		}
+		if err = o.checkResume(last); err != nil {
+			return err
+		}
+		o.runId = last.StartId
+		fmt.Println("影子表已存在，继续上次的修改:", o.newTable, o.runId)
+	} else {
+		_, err = sqlcomm.MysqlExecContext(ctx, o.dbConn, fmt.Sprintf("CREATE TABLE %s LIKE %s", quoteName(o.newTable), quoteName(o.tableName)))
+		if err != nil {
+			return fmt.Errorf("创建影子表失败: %w", err)
+		}
+		_, err = sqlcomm.MysqlExecContext(ctx, o.dbConn, fmt.Sprintf("ALTER TABLE %s %s", quoteName(o.newTable), o.data.Alter))
+		if err != nil {
+			_, _ = sqlcomm.MysqlExecContext(ctx, o.dbConn, "DROP TABLE IF EXISTS "+quoteName(o.newTable))
+			return fmt.Errorf("修改影子表失败: %w", err)
+		}
+		newColumns, err = sqlcomm.MysqlTableColumns(o.dbConn, o.newTable)
+		if err != nil {
+			return fmt.Errorf("获取列失败: %w", err)
+		}
+		created = true
+	}
+
+	err = o.checkNewTable(ctx, newColumns)
+	if err == nil && created {
+		o.runId = time.Now().Format("20060102150405")
+		if err = o.logCreate(); err != nil {
+			err = fmt.Errorf("记录影子表日志失败: %w", err)
+		}
+	}
+	if err != nil && created {
+		_, _ = sqlcomm.MysqlExecContext(ctx, o.dbConn, "DROP TABLE IF EXISTS "+quoteName(o.newTable))
+	}
+	return err
+}
+
+// checkNewTable 复制两个表都有的字段，删除、重命名字段和新增唯一索引会丢失数据，需要设置允许
+func (o *mysqlOnlineSchemaChange) checkNewTable(ctx context.Context, newColumns []*sqlcomm.MysqlColumn) error {
+	hasPk := false
+	for _, column := range newColumns {
+		hasPk = hasPk || (column.ColumnName == o.primaryKey && column.ColumnKey == "PRI")
+	}
+	if !hasPk {
+		return fmt.Errorf("修改后的表必须保留主键: %s", o.primaryKey)
+	}
+	columns, err := sqlcomm.MysqlTableColumns(o.dbConn, o.tableName)
+	if err != nil {
+		return fmt.Errorf("获取列失败: %w", err)
+	}
+	var dropped []string
+	o.columnNames, dropped = matchColumns(columns, newColumns)
+	if len(dropped) > 0 && !o.data.AllowColumnDrop {
+		return fmt.Errorf("修改后的表没有这些字段，数据不会复制，重命名也一样，确认后设置 allow_column_drop: %s", strings.Join(dropped, ", "))
+	}
+	if o.data.AllowUniqueAdd {
+		return nil
+	}
+	oldKeys, err := o.uniqueKeys(ctx, o.tableName)
+	if err != nil {
+		return err
+	}
+	newKeys, err := o.uniqueKeys(ctx, o.newTable)
+	if err != nil {
+		return err
+	}
+	if added := addedUniqueKeys(oldKeys, newKeys); len(added) > 0 {
+		return fmt.Errorf("修改后的表新增了唯一索引，重复的行复制时忽略、同步时覆盖，确认后设置 allow_unique_add: %s", strings.Join(added, "; "))
+	}
+	return nil
+}
+
+// matchColumns 原表和影子表都有的字段，以及影子表中没有的字段，生成列不复制
+func matchColumns(columns []*sqlcomm.MysqlColumn, newColumns []*sqlcomm.MysqlColumn) (names []string, dropped []string) {
+	newColumnMap := make(map[string]*sqlcomm.MysqlColumn, len(newColumns))
+	for _, column := range newColumns {
+		newColumnMap[column.ColumnName] = column
+	}
+	names = make([]string, 0, len(columns))
+	for _, column := range columns {
+		newColumn, ok := newColumnMap[column.ColumnName]
+		if !ok {
+			if !isGenerated(column) {
+				dropped = append(dropped, column.ColumnName)
+			}
+			continue
+		}
+		// 生成列不能写入
+		if isGenerated(newColumn) {
+			continue
+		}
+		names = append(names, column.ColumnName)
+	}
+	return names, dropped
+}
+
+func isGenerated(column *sqlcomm.MysqlColumn) bool {
+	return strings.Contains(strings.ToUpper(column.Extra), "GENERATED")
+}
+
+// uniqueKeys 表的唯一索引，每个为逗号分隔的字段
+func (o *mysqlOnlineSchemaChange) uniqueKeys(ctx context.Context, tableName string) ([]string, error) {
+	mapList, err := sqlcomm.MysqlQueryContext(ctx, o.dbConn, `SELECT INDEX_NAME, GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX) AS COLUMN_NAMES
+		FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND NON_UNIQUE = 0 GROUP BY INDEX_NAME`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("查询唯一索引失败: %w", err)
+	}
+	keys := make([]string, 0, len(mapList))
+	for _, one := range mapList {
+		keys = append(keys, conv.String(one["COLUMN_NAMES"]))
+	}
+	return keys, nil
+}
+
+// addedUniqueKeys 新增的唯一索引，包含原表某个唯一索引的全部字段时不会有新的重复，不算新增
+func addedUniqueKeys(oldKeys []string, newKeys []string) []string {
+	var added []string
+	for _, newKey := range newKeys {
+		newFields := make(map[string]bool)
+		for _, field := range strings.Split(newKey, ",") {
+			newFields[field] = true
+		}
+		covered := false
+		for _, oldKey := range oldKeys {
+			covered = true
+			for _, field := range strings.Split(oldKey, ",") {
+				if !newFields[field] {
+					covered = false
+					break
+				}
+			}
+			if covered {
+				break
+			}
+		}
+		if !covered {
+			added = append(added, newKey)
+		}
+	}
+	return added
+}
+
+// logCreate 记录影子表的修改语句，继续时检查，第0页不影响复制的分页
+func (o *mysqlOnlineSchemaChange) logCreate() error {
+	logRecord := &MysqlLogRecord{
+		TableName: o.newTable,
+		Method:    MysqlMethodOsc,
+		StartId:   o.runId,
+		PageSize:  o.chunkSize,
+		Extend:    o.data.Alter,
+	}
+	id, err := o.logService.InsertLogRecord(logRecord)
+	if err != nil {
+		return err
+	}
+	return o.logService.SuccessLogRecord(id, logRecord, nil)
+}
+
+// checkResume 影子表必须由同样的修改语句创建，否则会切换成上次的结构
+func (o *mysqlOnlineSchemaChange) checkResume(last *MysqlLogRecord) error {
+	if last == nil {
+		return fmt.Errorf("影子表没有修改记录，请确认后删除: %s", o.newTable)
+	}
+	if last.Extend != o.data.Alter {
+		return fmt.Errorf("影子表的修改语句与本次不同，请确认后删除: %s, %s", o.newTable, last.Extend)
+	}
+	return nil
+}
+
+// createTriggers 原表的变更通过触发器同步到影子表，已存在时忽略
+func (o *mysqlOnlineSchemaChange) createTriggers(ctx context.Context) error {
+	for _, event := range []string{"DELETE", "UPDATE", "INSERT"} {
+		_, err := sqlcomm.MysqlExecContext(ctx, o.dbConn, o.triggerSql(event))
+		if err != nil {
+			if num, ok := sqlcomm.MysqlErrorNumber(err); ok && num == errNumTriggerExists {
+				continue
+			}
+			return fmt.Errorf("创建触发器失败: %w", err)
+		}
+	}
+	return nil
+}
+
+func (o *mysqlOnlineSchemaChange) triggerSql(event string) string {
+	newTable := quoteName(o.newTable)
+	pk := quoteName(o.primaryKey)
+	columns := make([]string, len(o.columnNames))
+	values := make([]string, len(o.columnNames))
+	for i, name := range o.columnNames {
+		columns[i] = quoteName(name)
+		values[i] = "NEW." + quoteName(name)
+	}
+	replaceSql := fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s)", newTable, strings.Join(columns, ", "), strings.Join(values, ", "))
+	deleteSql := fmt.Sprintf("DELETE IGNORE FROM %s WHERE %s.%s <=> OLD.%s", newTable, newTable, pk, pk)
+
+	var body string
+	switch event {
+	case "INSERT":
+		body = replaceSql
+	case "UPDATE":
+		// 主键修改时需要删除旧的行
+		body = fmt.Sprintf("BEGIN %s AND !(OLD.%s <=> NEW.%s); %s; END", deleteSql, pk, pk, replaceSql)
+	default:
+		body = deleteSql
+	}
+	return fmt.Sprintf("CREATE TRIGGER %s AFTER %s ON %s FOR EACH ROW %s",
+		quoteName(o.triggers[event]), event, quoteName(o.tableName), body)
+}
+
+// copyRows 按主键分批复制，每批记录到日志表，从最后成功的一批继续
+func (o *mysqlOnlineSchemaChange) copyRows(ctx context.Context) error {
+	// 触发器创建之后的最大主键，之后写入的行由触发器同步
+	var maxPk sql.NullString
+	err := o.dbConn.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(%s) FROM %s", quoteName(o.primaryKey), quoteName(o.tableName))).Scan(&maxPk)
+	if err != nil {
+		return fmt.Errorf("查询最大主键失败: %w", err)
+	}
+	if !maxPk.Valid {
+		return nil
+	}
+
+	o.pageQuery, err = newMysqlQuery(o.dbConn, 1, 0, o.chunkSize)
+	if err != nil {
+		return err
+	}
+	o.pageQuery.TableName = quoteName(o.tableName) + " FORCE INDEX(PRIMARY)"
+	o.pageQuery.PrimaryKey = quoteName(o.primaryKey)
+
+	lastId := ""
+	pageNow := 1
+	last, err := o.logService.FindLogSuccessMaxPageNow(&MysqlLogRecord{
+		TableName: o.newTable,
+		Method:    MysqlMethodOsc,
+		StartId:   o.runId,
+		PageSize:  o.chunkSize,
+	}, 1, 0)
+	if err == nil && last != nil {
+		lastId = last.EndId
+		pageNow = last.PageNow + 1
+		fmt.Println("从上次复制的位置继续:", lastId, "page_now:", pageNow)
+	}
+
+	for lastId != maxPk.String {
+		if err = o.throttle.wait(ctx); err != nil {
+			return err
+		}
+		endId, err := o.chunkEnd(ctx, lastId, maxPk.String)
+		if err != nil {
+			return err
+		}
+		if err = o.copyChunk(ctx, lastId, endId, pageNow); err != nil {
+			return err
+		}
+		lastId = endId
+		pageNow++
+	}
+	return nil
+}
+
+// chunkEnd 下一批的最后一个主键，不满一批时为最大主键
+func (o *mysqlOnlineSchemaChange) chunkEnd(ctx context.Context, lastId string, maxId string) (string, error) {
+	where, params := o.chunkWhere(lastId, maxId)
+	endId, ok, err := o.pageQuery.pageEndId(ctx, where, params...)
+	if err != nil {
+		return "", fmt.Errorf("查询分批主键失败: %w", err)
+	}
+	if !ok {
+		return maxId, nil
+	}
+	return endId, nil
+}
+
+func (o *mysqlOnlineSchemaChange) chunkWhere(fromId string, endId string) (string, []any) {
+	pk := quoteName(o.primaryKey)
+	if fromId == "" {
+		return pk + " <= ?", []any{o.pkValue(endId)}
+	}
+	return pk + " > ? AND " + pk + " <= ?", []any{o.pkValue(fromId), o.pkValue(endId)}
+}
+
+// pkValue 数字主键按数字比较，避免转为浮点数丢失精度
+func (o *mysqlOnlineSchemaChange) pkValue(id string) any {
+	if !o.pkIsInt {
+		return id
+	}
+	if o.pkUnsigned {
+		if v, err := strconv.ParseUint(id, 10, 64); err == nil {
+			return v
+		}
+	} else if v, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return v
+	}
+	return id
+}
+
+// copyChunk 复制一批，与 runPage 一样整批为一个span并记录日志
+func (o *mysqlOnlineSchemaChange) copyChunk(ctx context.Context, fromId string, endId string, pageNow int) error {
+	ctx, span := sqlcomm.StartSpan(ctx, "etl page",
+		sqlcomm.AttrDbSystem.String("mysql"),
+		sqlcomm.AttrDbSqlTable.String(o.tableName),
+		attrEtlMethod.String(MysqlMethodOsc),
+		attrEtlPageNow.Int(pageNow),
+		attrEtlPageSize.Int(o.chunkSize))
+
+	columns := make([]string, len(o.columnNames))
+	for i, name := range o.columnNames {
+		columns[i] = quoteName(name)
+	}
+	where, params := o.chunkWhere(fromId, endId)
+	// 已由触发器写入的行更新，忽略；共享锁避免复制时行被修改
+	copySql := fmt.Sprintf("INSERT LOW_PRIORITY IGNORE INTO %s (%s) SELECT %s FROM %s FORCE INDEX(PRIMARY) WHERE %s LOCK IN SHARE MODE",
+		quoteName(o.newTable), strings.Join(columns, ", "), strings.Join(columns, ", "), quoteName(o.tableName), where)
+
+	logRecord := &MysqlLogRecord{
+		TableName: o.newTable,
+		Method:    MysqlMethodOsc,
+		StartId:   o.runId,
+		PageNow:   pageNow,
+		PageSize:  o.chunkSize,
+		FromId:    fromId,
+		EndId:     endId,
+		Extend:    o.data.Alter,
+	}
+	id, logErr := o.logService.InsertLogRecord(logRecord)
+
+	ret, err := sqlcomm.MysqlExecRetry(ctx, o.dbConn, o.data.RetryPolicy, copySql, params...)
+	if err == nil {
+		num, _ := ret.RowsAffected()
+		logRecord.SucNum = int(num)
+		span.SetAttributes(attrEtlRows.Int(logRecord.SucNum))
+		fmt.Println(fmt.Sprintf("复制数据成功, table: %s, rows_affected: %d, page_now: %d, id: %s-%s time: %s",
+			o.newTable, num, pageNow, fromId, endId, conv.String(time.Now())))
+	}
+	if logErr == nil {
+		if err != nil {
+			logRecord.Errors = err.Error()
+			logErr = o.logService.FailureLogRecord(id, logRecord, nil)
+		} else {
+			logErr = o.logService.SuccessLogRecord(id, logRecord, nil)
+		}
+	}
+	if logErr != nil {
+		fmt.Println("记录日志失败: ", logErr)
+	}
+	sqlcomm.EndSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("复制数据失败: %w", err)
+	}
+	return nil
+}
+
+// swapTables RENAME TABLE 原子切换，然后删除触发器和原表
+func (o *mysqlOnlineSchemaChange) swapTables(ctx context.Context) error {
+	conn, err := o.dbConn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("获取连接失败: %w", err)
+	}
+	defer func(conn *sql.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	lockWaitTimeout := o.data.LockWaitTimeout
+	if lockWaitTimeout == 0 {
+		lockWaitTimeout = 5
+	}
+	// 等待元数据锁时会阻塞后面所有的读写，所以超时时间要短
+	if _, err = conn.ExecContext(ctx, fmt.Sprintf("SET SESSION lock_wait_timeout = %d", lockWaitTimeout)); err != nil {
+		return fmt.Errorf("设置lock_wait_timeout失败: %w", err)
+	}
+	renameSql := fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s",
+		quoteName(o.tableName), quoteName(o.oldTable), quoteName(o.newTable), quoteName(o.tableName))
+	err = sqlcomm.Retry(ctx, o.data.RetryPolicy, func(ctx context.Context) error {
+		_, err := conn.ExecContext(ctx, renameSql)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("切换表失败: %w", err)
+	}
+
+	// 触发器随原表改名，已经没有写入，删除失败不影响结果
+	for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+		if _, err = sqlcomm.MysqlExecContext(ctx, o.dbConn, "DROP TRIGGER IF EXISTS "+quoteName(o.triggers[event])); err != nil {
+			fmt.Println("删除触发器失败:", err)
+		}
+	}
+	if o.data.KeepOldTable {
+		return nil
+	}
+	if _, err = sqlcomm.MysqlExecContext(ctx, o.dbConn, "DROP TABLE IF EXISTS "+quoteName(o.oldTable)); err != nil {
+		fmt.Println("删除原表失败:", err)
+	}
+	return nil
+}
+
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
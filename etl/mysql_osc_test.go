@@ -0,0 +1,278 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/magic-lib/go-plat-mysql/internal/fakedb"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFakeDB 按语句返回结果的驱动，记录执行的语句和参数
+func newFakeDB(t *testing.T, handle func(query string) (*fakedb.Rows, error)) (*fakedb.DB, *sql.DB) {
+	t.Helper()
+	return fakedb.Open(t, func(query string, _ []driver.NamedValue) (*fakedb.Rows, error) {
+		return handle(query)
+	})
+}
+
+func newTestOsc() *mysqlOnlineSchemaChange {
+	o := NewMySqlOnlineSchemaChange(&MySqlOscData{TableName: "t_user", Alter: "ADD COLUMN age INT"})
+	o.tableName = "t_user"
+	o.newTable = "_t_user_new"
+	o.oldTable = "_t_user_old"
+	o.triggers = map[string]string{
+		"INSERT": "_t_user_osc_ins",
+		"UPDATE": "_t_user_osc_upd",
+		"DELETE": "_t_user_osc_del",
+	}
+	o.primaryKey = "id"
+	o.pkIsInt = true
+	o.columnNames = []string{"id", "name"}
+	o.chunkSize = 100
+	return o
+}
+
+func TestTriggerSql(t *testing.T) {
+	o := newTestOsc()
+	cases := map[string]string{
+		"INSERT": "CREATE TRIGGER `_t_user_osc_ins` AFTER INSERT ON `t_user` FOR EACH ROW " +
+			"REPLACE INTO `_t_user_new` (`id`, `name`) VALUES (NEW.`id`, NEW.`name`)",
+		"UPDATE": "CREATE TRIGGER `_t_user_osc_upd` AFTER UPDATE ON `t_user` FOR EACH ROW " +
+			"BEGIN DELETE IGNORE FROM `_t_user_new` WHERE `_t_user_new`.`id` <=> OLD.`id` AND !(OLD.`id` <=> NEW.`id`); " +
+			"REPLACE INTO `_t_user_new` (`id`, `name`) VALUES (NEW.`id`, NEW.`name`); END",
+		"DELETE": "CREATE TRIGGER `_t_user_osc_del` AFTER DELETE ON `t_user` FOR EACH ROW " +
+			"DELETE IGNORE FROM `_t_user_new` WHERE `_t_user_new`.`id` <=> OLD.`id`",
+	}
+	for event, expected := range cases {
+		if got := o.triggerSql(event); got != expected {
+			t.Errorf("%s:\ngot  %s\nwant %s", event, got, expected)
+		}
+	}
+}
+
+func TestChunkWhere(t *testing.T) {
+	o := newTestOsc()
+	where, params := o.chunkWhere("", "100")
+	if where != "`id` <= ?" || !reflect.DeepEqual(params, []any{int64(100)}) {
+		t.Errorf("first chunk: %s %v", where, params)
+	}
+	where, params = o.chunkWhere("100", "200")
+	if where != "`id` > ? AND `id` <= ?" || !reflect.DeepEqual(params, []any{int64(100), int64(200)}) {
+		t.Errorf("next chunk: %s %v", where, params)
+	}
+}
+
+func TestPkValue(t *testing.T) {
+	o := newTestOsc()
+	if v := o.pkValue("-9223372036854775808"); v != int64(-9223372036854775808) {
+		t.Errorf("int64: %#v", v)
+	}
+	if v := o.pkValue("abc"); v != "abc" {
+		t.Errorf("invalid int: %#v", v)
+	}
+	o.pkUnsigned = true
+	if v := o.pkValue("18446744073709551615"); v != uint64(18446744073709551615) {
+		t.Errorf("uint64: %#v", v)
+	}
+	o.pkIsInt = false
+	if v := o.pkValue("00123"); v != "00123" {
+		t.Errorf("string pk: %#v", v)
+	}
+}
+
+func TestChunkEnd(t *testing.T) {
+	endId := "199"
+	fake, db := newFakeDB(t, func(string) (*fakedb.Rows, error) {
+		if endId == "" {
+			return nil, nil
+		}
+		return &fakedb.Rows{Columns: []string{"id"}, Values: [][]driver.Value{{[]byte(endId)}}}, nil
+	})
+	o := newTestOsc()
+	o.dbConn = db
+	var err error
+	if o.pageQuery, err = newMysqlQuery(db, 1, 0, o.chunkSize); err != nil {
+		t.Fatal(err)
+	}
+	o.pageQuery.TableName = quoteName(o.tableName) + " FORCE INDEX(PRIMARY)"
+	o.pageQuery.PrimaryKey = quoteName(o.primaryKey)
+
+	got, err := o.chunkEnd(context.Background(), "99", "1000")
+	if err != nil || got != "199" {
+		t.Fatalf("chunk end: %s, %v", got, err)
+	}
+	want := "SELECT `id` FROM `t_user` FORCE INDEX(PRIMARY) WHERE `id` > ? AND `id` <= ? ORDER BY `id` ASC LIMIT 1 OFFSET 99"
+	if queries, args := fake.Queries(), fake.Args(); queries[0] != want || !reflect.DeepEqual(args[0], []any{int64(99), int64(1000)}) {
+		t.Errorf("query: %s %v", queries[0], args[0])
+	}
+
+	endId = ""
+	if got, err = o.chunkEnd(context.Background(), "999", "1000"); err != nil || got != "1000" {
+		t.Errorf("last chunk: %s, %v", got, err)
+	}
+}
+
+func TestCheckForeignKeysAndTriggers(t *testing.T) {
+	var incoming, outgoing, triggers bool
+	fake, db := newFakeDB(t, func(query string) (*fakedb.Rows, error) {
+		found := false
+		switch {
+		case strings.Contains(query, "REFERENCED_TABLE_NAME = ?"):
+			found = incoming
+		case strings.Contains(query, "REFERENCED_TABLE_NAME IS NOT NULL"):
+			found = outgoing
+		case strings.Contains(query, "INFORMATION_SCHEMA.TRIGGERS"):
+			found = triggers
+		}
+		if !found {
+			return nil, nil
+		}
+		return &fakedb.Rows{Columns: []string{"name"}, Values: [][]driver.Value{{[]byte("x")}}}, nil
+	})
+	o := newTestOsc()
+	o.dbConn = db
+	ctx := context.Background()
+	if err := o.checkForeignKeys(ctx); err != nil {
+		t.Errorf("no foreign keys: %v", err)
+	}
+	if err := o.checkTriggers(ctx); err != nil {
+		t.Errorf("no triggers: %v", err)
+	}
+	args := fake.Args()
+	last := args[len(args)-1]
+	if !reflect.DeepEqual(last, []any{"t_user", "_t_user_osc_ins", "_t_user_osc_upd", "_t_user_osc_del"}) {
+		t.Errorf("own triggers should be ignored: %v", last)
+	}
+
+	incoming = true
+	if err := o.checkForeignKeys(ctx); err == nil {
+		t.Error("referenced table should fail")
+	}
+	incoming, outgoing = false, true
+	if err := o.checkForeignKeys(ctx); err == nil {
+		t.Error("table with foreign keys should fail")
+	}
+	triggers = true
+	if err := o.checkTriggers(ctx); err == nil {
+		t.Error("table with triggers should fail")
+	}
+}
+
+func TestCheckResume(t *testing.T) {
+	o := newTestOsc()
+	if err := o.checkResume(nil); err == nil {
+		t.Error("shadow table without log should fail")
+	}
+	if err := o.checkResume(&MysqlLogRecord{StartId: "1", Extend: "ADD COLUMN age BIGINT"}); err == nil {
+		t.Error("different alter should fail")
+	}
+	if err := o.checkResume(&MysqlLogRecord{StartId: "1", Extend: "ADD COLUMN age INT"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMysqlThrottle(t *testing.T) {
+	running := []string{"10", "8", "3"}
+	fake, db := newFakeDB(t, func(string) (*fakedb.Rows, error) {
+		value := running[0]
+		if len(running) > 1 {
+			running = running[1:]
+		}
+		return &fakedb.Rows{Columns: []string{"Variable_name", "Value"}, Values: [][]driver.Value{{[]byte("Threads_running"), []byte(value)}}}, nil
+	})
+	throttle := newMysqlThrottle(db, time.Millisecond, 5)
+	throttle.checkInterval = time.Millisecond
+	if err := throttle.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if queries := fake.Queries(); len(queries) != 3 || queries[0] != "SHOW GLOBAL STATUS LIKE 'Threads_running'" {
+		t.Errorf("queries: %v", queries)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := throttle.sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled sleep: %v", err)
+	}
+	running = []string{"10"}
+	if err := throttle.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled wait: %v", err)
+	}
+
+	_, db = newFakeDB(t, func(string) (*fakedb.Rows, error) { return nil, errors.New("denied") })
+	if _, err := newMysqlThrottle(db, 0, 5).threadsRunning(context.Background()); err == nil {
+		t.Error("query error should fail")
+	}
+	if err := newMysqlThrottle(db, 0, 0).wait(context.Background()); err != nil {
+		t.Errorf("no limit should not query: %v", err)
+	}
+}
+
+func TestFindLastLogRecord(t *testing.T) {
+	var found bool
+	fake, db := newFakeDB(t, func(string) (*fakedb.Rows, error) {
+		if !found {
+			return nil, nil
+		}
+		return &fakedb.Rows{
+			Columns: []string{"id", "table_name", "method", "start_id", "page_now", "page_size", "end_id", "extend", "status"},
+			Types:   []string{"BIGINT", "VARCHAR", "VARCHAR", "VARCHAR", "INT", "INT", "VARCHAR", "TEXT", "VARCHAR"},
+			Values: [][]driver.Value{{int64(7), []byte("_t_user_new"), []byte(MysqlMethodOsc), []byte("20240102030405"),
+				int64(3), int64(100), []byte("300"), []byte("ADD COLUMN age INT"), []byte("success")}},
+		}, nil
+	})
+	logService, err := NewMysqlLogger(db, "osc_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := logService.FindLastLogRecord("_t_user_new", MysqlMethodOsc)
+	if err != nil || last != nil {
+		t.Fatalf("no record: %+v, %v", last, err)
+	}
+	queries, args := fake.Queries(), fake.Args()
+	query, queryArgs := queries[len(queries)-1], args[len(args)-1]
+	if !strings.Contains(query, "FROM osc_log ") || !strings.Contains(query, "ORDER BY id DESC LIMIT 1") ||
+		!reflect.DeepEqual(queryArgs, []any{"_t_user_new", MysqlMethodOsc}) {
+		t.Errorf("query: %s %v", query, queryArgs)
+	}
+
+	found = true
+	last, err = logService.FindLastLogRecord("_t_user_new", MysqlMethodOsc)
+	if err != nil || last == nil {
+		t.Fatalf("record: %+v, %v", last, err)
+	}
+	if last.Id != 7 || last.StartId != "20240102030405" || last.PageNow != 3 || last.EndId != "300" || last.Extend != "ADD COLUMN age INT" {
+		t.Errorf("record: %+v", last)
+	}
+}
+
+func TestMatchColumns(t *testing.T) {
+	columns := []*sqlcomm.MysqlColumn{
+		{ColumnName: "id"}, {ColumnName: "a"}, {ColumnName: "b"},
+		{ColumnName: "full_name", Extra: "VIRTUAL GENERATED"}, {ColumnName: "c"},
+	}
+	newColumns := []*sqlcomm.MysqlColumn{
+		{ColumnName: "id"}, {ColumnName: "b"}, {ColumnName: "c", Extra: "STORED GENERATED"}, {ColumnName: "a2"},
+	}
+	names, dropped := matchColumns(columns, newColumns)
+	if !reflect.DeepEqual(names, []string{"id", "b"}) || !reflect.DeepEqual(dropped, []string{"a"}) {
+		t.Errorf("names %v, dropped %v", names, dropped)
+	}
+}
+
+func TestAddedUniqueKeys(t *testing.T) {
+	oldKeys := []string{"id", "email"}
+	newKeys := []string{"id", "email", "email,tenant_id", "phone", "tenant_id,name"}
+	if got := addedUniqueKeys(oldKeys, newKeys); !reflect.DeepEqual(got, []string{"phone", "tenant_id,name"}) {
+		t.Errorf("added: %v", got)
+	}
+	if got := addedUniqueKeys(oldKeys, []string{"id", "name,id"}); len(got) != 0 {
+		t.Errorf("keys containing the primary key are not new: %v", got)
+	}
+}
@@ -0,0 +1,71 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"time"
+)
+
+// mysqlThrottle 分批写入时的限流，每批之间休眠，数据库繁忙时暂停
+type mysqlThrottle struct {
+	dbConn            *sql.DB
+	chunkSleep        time.Duration //每批之间的休眠时间
+	maxThreadsRunning int           //Threads_running 超过时暂停，0为不检查
+	checkInterval     time.Duration //暂停时检查的间隔
+}
+
+func newMysqlThrottle(db *sql.DB, chunkSleep time.Duration, maxThreadsRunning int) *mysqlThrottle {
+	return &mysqlThrottle{
+		dbConn:            db,
+		chunkSleep:        chunkSleep,
+		maxThreadsRunning: maxThreadsRunning,
+		checkInterval:     time.Second,
+	}
+}
+
+// wait 写入下一批之前调用
+func (t *mysqlThrottle) wait(ctx context.Context) error {
+	if t.chunkSleep > 0 {
+		if err := t.sleep(ctx, t.chunkSleep); err != nil {
+			return err
+		}
+	}
+	if t.maxThreadsRunning <= 0 {
+		return nil
+	}
+	for {
+		running, err := t.threadsRunning(ctx)
+		if err != nil {
+			return err
+		}
+		if running <= t.maxThreadsRunning {
+			return nil
+		}
+		fmt.Println("数据库繁忙，暂停写入, Threads_running:", running, "max:", t.maxThreadsRunning)
+		if err = t.sleep(ctx, t.checkInterval); err != nil {
+			return err
+		}
+	}
+}
+
+func (t *mysqlThrottle) threadsRunning(ctx context.Context) (int, error) {
+	var name, value string
+	err := t.dbConn.QueryRowContext(ctx, "SHOW GLOBAL STATUS LIKE 'Threads_running'").Scan(&name, &value)
+	if err != nil {
+		return 0, fmt.Errorf("查询Threads_running失败: %w", err)
+	}
+	return conv.Convert[int](value)
+}
+
+func (t *mysqlThrottle) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
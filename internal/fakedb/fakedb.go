@@ -0,0 +1,191 @@
+// Package fakedb 测试用的 database/sql 驱动，不连接数据库，由 Handler 按语句返回结果
+package fakedb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Handler 处理一条语句，调用时持有 DB 的锁
+// 查询时返回结果集，为nil时返回空结果集；执行时忽略结果集，影响行数为1；返回错误时语句失败
+type Handler func(query string, args []driver.NamedValue) (*Rows, error)
+
+// Rows 语句返回的结果集，Types 为字段的数据库类型，没有设置时为 VARCHAR
+type Rows struct {
+	Columns []string
+	Types   []string
+	Values  [][]driver.Value
+}
+
+// DB 记录执行的语句、参数和事务选项，事务的 BEGIN、COMMIT、ROLLBACK 也记录在语句中
+type DB struct {
+	lock    sync.Mutex
+	handle  Handler
+	queries []string
+	args    [][]any
+	txOpts  []driver.TxOptions
+}
+
+// New 新建驱动，handle 为nil时所有语句都成功，查询返回空结果集
+func New(handle Handler) *DB {
+	return &DB{handle: handle}
+}
+
+// Open 新建驱动并打开连接，测试结束时关闭
+func Open(t testing.TB, handle Handler) (*DB, *sql.DB) {
+	t.Helper()
+	fake := New(handle)
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { _ = db.Close() })
+	return fake, db
+}
+
+// Connect 实现 driver.Connector
+func (db *DB) Connect(context.Context) (driver.Conn, error) { return &conn{db: db}, nil }
+
+// Driver 实现 driver.Connector
+func (db *DB) Driver() driver.Driver { return fakeDriver{db: db} }
+
+// Queries 执行过的语句
+func (db *DB) Queries() []string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return append([]string{}, db.queries...)
+}
+
+// Args 每条语句的参数，与 Queries 一一对应
+func (db *DB) Args() [][]any {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return append([][]any{}, db.args...)
+}
+
+// TxOptions 每次开启事务的选项
+func (db *DB) TxOptions() []driver.TxOptions {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return append([]driver.TxOptions{}, db.txOpts...)
+}
+
+func (db *DB) record(query string, args []driver.NamedValue) {
+	values := make([]any, len(args))
+	for i, one := range args {
+		values[i] = one.Value
+	}
+	db.queries = append(db.queries, query)
+	db.args = append(db.args, values)
+}
+
+func (db *DB) run(query string, args []driver.NamedValue) (*Rows, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.record(query, args)
+	if db.handle == nil {
+		return nil, nil
+	}
+	return db.handle(query, args)
+}
+
+type fakeDriver struct{ db *DB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &conn{db: d.db}, nil }
+
+// conn 实现 mysql 驱动连接的全部接口，可以被 xorm 的连接包装使用
+type conn struct{ db *DB }
+
+func (c *conn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *conn) PrepareContext(context.Context, string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *conn) Close() error                       { return nil }
+func (c *conn) Ping(context.Context) error         { return nil }
+func (c *conn) ResetSession(context.Context) error { return nil }
+func (c *conn) IsValid() bool                      { return true }
+
+// CheckNamedValue 使用 database/sql 默认的参数转换
+func (c *conn) CheckNamedValue(*driver.NamedValue) error { return driver.ErrSkip }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.db.lock.Lock()
+	defer c.db.lock.Unlock()
+	c.db.txOpts = append(c.db.txOpts, opts)
+	c.db.record("BEGIN", nil)
+	return tx{db: c.db}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.db.run(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	ret, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if ret == nil {
+		ret = &Rows{}
+	}
+	return &rows{data: ret}, nil
+}
+
+type tx struct{ db *DB }
+
+func (t tx) Commit() error   { return t.end("COMMIT") }
+func (t tx) Rollback() error { return t.end("ROLLBACK") }
+
+func (t tx) end(query string) error {
+	t.db.lock.Lock()
+	defer t.db.lock.Unlock()
+	t.db.record(query, nil)
+	return nil
+}
+
+// rows 实现 mysql 驱动结果集的全部接口，xorm 需要字段类型
+type rows struct {
+	data *Rows
+	next int
+}
+
+func (r *rows) Columns() []string { return r.data.Columns }
+func (r *rows) Close() error      { return nil }
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.data.Values) {
+		return io.EOF
+	}
+	copy(dest, r.data.Values[r.next])
+	r.next++
+	return nil
+}
+func (r *rows) HasNextResultSet() bool { return false }
+func (r *rows) NextResultSet() error   { return io.EOF }
+func (r *rows) ColumnTypeDatabaseTypeName(i int) string {
+	if i < len(r.data.Types) {
+		return r.data.Types[i]
+	}
+	return "VARCHAR"
+}
+func (r *rows) ColumnTypeNullable(int) (bool, bool)               { return false, false }
+func (r *rows) ColumnTypePrecisionScale(int) (int64, int64, bool) { return 0, 0, false }
+
+// ColumnTypeScanType 按第一行的值确定类型
+func (r *rows) ColumnTypeScanType(i int) reflect.Type {
+	for _, one := range r.data.Values {
+		if i < len(one) && one[i] != nil {
+			return reflect.TypeOf(one[i])
+		}
+	}
+	return reflect.TypeOf((*any)(nil)).Elem()
+}
@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/crypto"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// MigrateFunc Go代码实现的迁移，在事务中执行，DDL会隐式提交
+type MigrateFunc func(ctx context.Context, tx *sql.Tx) error
+
+// Migration 一个版本的迁移，UpSql 和 Up 二选一，没有 Down 时不能回滚
+type Migration struct {
+	Version  int64
+	Name     string
+	UpSql    string
+	DownSql  string
+	Up       MigrateFunc
+	Down     MigrateFunc
+	Checksum string // UpSql 的md5，Go代码实现的迁移为空，不校验
+}
+
+var (
+	registerLock       sync.Mutex
+	registerMigrations = map[int64]*Migration{}
+
+	// 文件名: 版本号_名称.up.sql、版本号_名称.down.sql
+	migrationFileRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+)
+
+// RegisterMigration 注册Go代码实现的迁移，所有 Migrator 都会包含，版本号重复时覆盖
+func RegisterMigration(version int64, name string, up MigrateFunc, down MigrateFunc) {
+	registerLock.Lock()
+	defer registerLock.Unlock()
+	registerMigrations[version] = &Migration{Version: version, Name: name, Up: up, Down: down}
+}
+
+func registeredMigrations() []*Migration {
+	registerLock.Lock()
+	defer registerLock.Unlock()
+	ret := make([]*Migration, 0, len(registerMigrations))
+	for _, one := range registerMigrations {
+		ret = append(ret, one)
+	}
+	return ret
+}
+
+// LoadDir 读取目录中的迁移文件
+func LoadDir(dir string) ([]*Migration, error) {
+	return LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadFS 读取fs中的迁移文件，可用于 embed.FS，文件名为 版本号_名称.up.sql 和 版本号_名称.down.sql
+func LoadFS(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移目录失败: %w", err)
+	}
+	migrationMap := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if len(match) != 4 {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("迁移文件版本号错误: %s, %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取迁移文件失败: %s, %w", entry.Name(), err)
+		}
+		one, ok := migrationMap[version]
+		if !ok {
+			one = &Migration{Version: version, Name: match[2]}
+			migrationMap[version] = one
+		} else if one.Name != match[2] {
+			return nil, fmt.Errorf("迁移版本号重复: %d, %s, %s", version, one.Name, match[2])
+		}
+		if match[3] == "up" {
+			one.UpSql = string(content)
+			one.Checksum = crypto.Md5(one.UpSql)
+		} else {
+			one.DownSql = string(content)
+		}
+	}
+	ret := make([]*Migration, 0, len(migrationMap))
+	for _, one := range migrationMap {
+		if one.UpSql == "" {
+			return nil, fmt.Errorf("迁移缺少up文件: %d_%s", one.Version, one.Name)
+		}
+		ret = append(ret, one)
+	}
+	sortMigrations(ret)
+	return ret, nil
+}
+
+func sortMigrations(list []*Migration) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+}
+
+// hasDown 是否可以回滚
+func (m *Migration) hasDown() bool {
+	return m.Down != nil || m.DownSql != ""
+}
@@ -0,0 +1,37 @@
+package migrate_test
+
+import (
+	"github.com/magic-lib/go-plat-mysql/migrate"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0002_add_email.up.sql":     {Data: []byte("ALTER TABLE user ADD COLUMN email varchar(128);")},
+		"sql/0002_add_email.down.sql":   {Data: []byte("ALTER TABLE user DROP COLUMN email;")},
+		"sql/0001_create_user.up.sql":   {Data: []byte("CREATE TABLE user (id bigint primary key);")},
+		"sql/0001_create_user.down.sql": {Data: []byte("DROP TABLE user;")},
+		"sql/README.md":                 {Data: []byte("ignored")},
+	}
+	list, err := migrate.LoadFS(fsys, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Version != 1 || list[0].Name != "create_user" || list[1].Name != "add_email" {
+		t.Fatalf("%+v", list)
+	}
+	if list[1].DownSql == "" || list[1].Checksum == "" || list[0].Checksum == list[1].Checksum {
+		t.Errorf("%+v", list[1])
+	}
+
+	fsys["sql/0003_only_down.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	if _, err = migrate.LoadFS(fsys, "sql"); err == nil {
+		t.Error("migration without up file should fail")
+	}
+	delete(fsys, "sql/0003_only_down.down.sql")
+	fsys["sql/0002_other.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	if _, err = migrate.LoadFS(fsys, "sql"); err == nil {
+		t.Error("duplicate version should fail")
+	}
+}
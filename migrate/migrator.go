@@ -0,0 +1,462 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"github.com/magic-lib/go-plat-utils/logs"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTableName 默认的迁移历史表
+	DefaultTableName = "schema_migrations"
+	// DefaultLockTimeout 默认等待迁移锁的时间
+	DefaultLockTimeout = 30 * time.Second
+
+	errNoSuchTable = 1146
+)
+
+var (
+	// ErrLocked 其他实例正在迁移
+	ErrLocked = errors.New("migrate: lock is held by another instance")
+	// ErrChecksumMismatch 已执行的迁移文件被修改
+	ErrChecksumMismatch = errors.New("migrate: checksum mismatch")
+	// ErrNoDown 迁移没有回滚语句
+	ErrNoDown = errors.New("migrate: migration has no down")
+	// ErrDirty 有迁移执行到一半失败，需要手动修复数据库后调用 Force
+	ErrDirty = errors.New("migrate: dirty migration, fix the database and run force")
+)
+
+// Status 一个版本的状态
+type Status struct {
+	Version          int64     `json:"version"`
+	Name             string    `json:"name"`
+	Applied          bool      `json:"applied"`
+	AppliedAt        time.Time `json:"applied_at,omitempty"`
+	ChecksumMismatch bool      `json:"checksum_mismatch,omitempty"` // 执行后文件被修改
+	Missing          bool      `json:"missing,omitempty"`           // 已执行但迁移已不存在
+	Dirty            bool      `json:"dirty,omitempty"`             // 执行或回滚到一半失败
+}
+
+type history struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+	dirty     bool
+}
+
+// Migrator 按版本执行迁移，执行时持有 GET_LOCK 锁，同一时间只有一个实例迁移
+type Migrator struct {
+	db          *sql.DB
+	tableName   string
+	lockName    string
+	lockTimeout time.Duration
+	dryRun      io.Writer
+	logger      logs.ILogger
+	migrations  []*Migration
+}
+
+// Option Migrator 的选项
+type Option func(*Migrator)
+
+// WithTableName 设置迁移历史表，默认为 schema_migrations
+func WithTableName(tableName string) Option {
+	return func(m *Migrator) {
+		m.tableName = tableName
+	}
+}
+
+// WithLockName 设置 GET_LOCK 的锁名，默认为 库名.历史表名
+func WithLockName(lockName string) Option {
+	return func(m *Migrator) {
+		m.lockName = lockName
+	}
+}
+
+// WithLockTimeout 设置等待锁的时间
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockTimeout = timeout
+	}
+}
+
+// WithDryRun 只输出要执行的语句，不执行也不记录历史
+func WithDryRun(w io.Writer) Option {
+	return func(m *Migrator) {
+		m.dryRun = w
+	}
+}
+
+// WithLogger 设置日志，默认为 logs.DefaultLogger
+func WithLogger(logger logs.ILogger) Option {
+	return func(m *Migrator) {
+		m.logger = logger
+	}
+}
+
+// WithMigrations 添加迁移，如 LoadDir 读取的文件
+func WithMigrations(list ...*Migration) Option {
+	return func(m *Migrator) {
+		m.migrations = append(m.migrations, list...)
+	}
+}
+
+// NewMigrator 新建迁移，包含 RegisterMigration 注册的迁移
+func NewMigrator(db *sql.DB, opts ...Option) (*Migrator, error) {
+	m := &Migrator{
+		db:          db,
+		tableName:   DefaultTableName,
+		lockTimeout: DefaultLockTimeout,
+		logger:      logs.DefaultLogger(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.migrations = append(m.migrations, registeredMigrations()...)
+	sortMigrations(m.migrations)
+	for i := 1; i < len(m.migrations); i++ {
+		if m.migrations[i].Version == m.migrations[i-1].Version {
+			return nil, fmt.Errorf("迁移版本号重复: %d, %s, %s", m.migrations[i].Version,
+				m.migrations[i-1].Name, m.migrations[i].Name)
+		}
+	}
+	return m, nil
+}
+
+// Up 执行所有未执行的迁移，返回执行了的迁移
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	return m.To(ctx, -1)
+}
+
+// Down 回滚最后执行的 steps 个迁移
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var ret []*Migration
+	err := m.withLock(ctx, func() error {
+		histories, err := m.histories(ctx)
+		if err != nil {
+			return err
+		}
+		if err = checkDirty(histories); err != nil {
+			return err
+		}
+		for i := len(histories) - 1; i >= 0 && len(ret) < steps; i-- {
+			one := m.migration(histories[i].version)
+			if one == nil {
+				return fmt.Errorf("迁移不存在，无法回滚: %d_%s", histories[i].version, histories[i].name)
+			}
+			if err = m.down(ctx, one); err != nil {
+				return err
+			}
+			ret = append(ret, one)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// To 迁移到指定版本：比当前版本大时执行之间的迁移，小时回滚比它大的迁移，version 小于0时执行所有
+func (m *Migrator) To(ctx context.Context, version int64) ([]*Migration, error) {
+	var ret []*Migration
+	err := m.withLock(ctx, func() error {
+		histories, err := m.histories(ctx)
+		if err != nil {
+			return err
+		}
+		if err = checkDirty(histories); err != nil {
+			return err
+		}
+		if err = m.verify(histories); err != nil {
+			return err
+		}
+		applied := make(map[int64]bool, len(histories))
+		for _, one := range histories {
+			applied[one.version] = true
+		}
+		// 回滚比目标版本大的
+		if version >= 0 {
+			for i := len(histories) - 1; i >= 0; i-- {
+				if histories[i].version <= version {
+					continue
+				}
+				one := m.migration(histories[i].version)
+				if one == nil {
+					return fmt.Errorf("迁移不存在，无法回滚: %d_%s", histories[i].version, histories[i].name)
+				}
+				if err = m.down(ctx, one); err != nil {
+					return err
+				}
+				ret = append(ret, one)
+			}
+		}
+		for _, one := range m.migrations {
+			if applied[one.Version] || (version >= 0 && one.Version > version) {
+				continue
+			}
+			if err = m.up(ctx, one); err != nil {
+				return err
+			}
+			ret = append(ret, one)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// Force 手动修复失败的迁移后清除dirty标记，applied 为true时视为已执行，为false时视为未执行
+func (m *Migrator) Force(ctx context.Context, version int64, applied bool) error {
+	return m.withLock(ctx, func() error {
+		if m.dryRun != nil {
+			_, _ = fmt.Fprintf(m.dryRun, "-- force %d applied=%v\n", version, applied)
+			return nil
+		}
+		var err error
+		if applied {
+			_, err = m.db.ExecContext(ctx, "UPDATE "+m.quotedTable()+" SET dirty = 0 WHERE version = ?", version)
+		} else {
+			_, err = m.db.ExecContext(ctx, "DELETE FROM "+m.quotedTable()+" WHERE version = ?", version)
+		}
+		if err != nil {
+			return fmt.Errorf("修改迁移历史失败: %d, %w", version, err)
+		}
+		return nil
+	})
+}
+
+// Status 所有迁移的状态，按版本排序
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	histories, err := m.histories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	historyMap := make(map[int64]*history, len(histories))
+	for _, one := range histories {
+		historyMap[one.version] = one
+	}
+	ret := make([]*Status, 0, len(m.migrations))
+	for _, one := range m.migrations {
+		status := &Status{Version: one.Version, Name: one.Name}
+		if h, ok := historyMap[one.Version]; ok {
+			status.Applied = !h.dirty
+			status.AppliedAt = h.appliedAt
+			status.Dirty = h.dirty
+			status.ChecksumMismatch = one.Checksum != "" && h.checksum != "" && one.Checksum != h.checksum
+			delete(historyMap, one.Version)
+		}
+		ret = append(ret, status)
+	}
+	for _, h := range histories {
+		if _, ok := historyMap[h.version]; ok {
+			ret = append(ret, &Status{Version: h.version, Name: h.name, Applied: !h.dirty, AppliedAt: h.appliedAt, Missing: true, Dirty: h.dirty})
+		}
+	}
+	return ret, nil
+}
+
+func (m *Migrator) migration(version int64) *Migration {
+	for _, one := range m.migrations {
+		if one.Version == version {
+			return one
+		}
+	}
+	return nil
+}
+
+// checkDirty 有失败的迁移时不能继续
+func checkDirty(histories []*history) error {
+	for _, h := range histories {
+		if h.dirty {
+			return fmt.Errorf("%w: %d_%s", ErrDirty, h.version, h.name)
+		}
+	}
+	return nil
+}
+
+// verify 已执行的迁移文件不能修改
+func (m *Migrator) verify(histories []*history) error {
+	for _, h := range histories {
+		one := m.migration(h.version)
+		if one != nil && one.Checksum != "" && h.checksum != "" && one.Checksum != h.checksum {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, one.Version, one.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) up(ctx context.Context, one *Migration) error {
+	m.logger.Info("migrate up:", one.Version, one.Name)
+	start := func() error {
+		_, err := m.db.ExecContext(ctx, "INSERT INTO "+m.quotedTable()+" (version, name, checksum, applied_at, dirty) VALUES (?, ?, ?, ?, 1)",
+			one.Version, one.Name, one.Checksum, time.Now())
+		return err
+	}
+	return m.run(ctx, one, one.UpSql, one.Up, start, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE "+m.quotedTable()+" SET dirty = 0, applied_at = ? WHERE version = ?", time.Now(), one.Version)
+		return err
+	})
+}
+
+func (m *Migrator) down(ctx context.Context, one *Migration) error {
+	if !one.hasDown() {
+		return fmt.Errorf("%w: %d_%s", ErrNoDown, one.Version, one.Name)
+	}
+	m.logger.Info("migrate down:", one.Version, one.Name)
+	start := func() error {
+		_, err := m.db.ExecContext(ctx, "UPDATE "+m.quotedTable()+" SET dirty = 1 WHERE version = ?", one.Version)
+		return err
+	}
+	return m.run(ctx, one, one.DownSql, one.Down, start, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM "+m.quotedTable()+" WHERE version = ?", one.Version)
+		return err
+	})
+}
+
+// run 在事务中执行迁移并记录历史，DDL会隐式提交，失败时DDL不会回滚，
+// 所以执行前先标记为dirty，成功后在事务中清除，失败时保留标记，修复前不能再迁移
+func (m *Migrator) run(ctx context.Context, one *Migration, sqlText string, fn MigrateFunc, start func() error, finish func(tx *sql.Tx) error) error {
+	statements := sqlcomm.SplitSqlStatements(sqlText)
+	if m.dryRun != nil {
+		_, _ = fmt.Fprintf(m.dryRun, "-- %d_%s\n", one.Version, one.Name)
+		for _, statement := range statements {
+			_, _ = fmt.Fprintf(m.dryRun, "%s;\n", statement)
+		}
+		if fn != nil {
+			_, _ = fmt.Fprintln(m.dryRun, "-- go func")
+		}
+		return nil
+	}
+	if err := start(); err != nil {
+		return fmt.Errorf("记录迁移开始失败: %d_%s, %w", one.Version, one.Name, err)
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %d_%s, %w", one.Version, one.Name, err)
+	}
+	err = func() error {
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("%s, %w", statement, err)
+			}
+		}
+		if fn != nil {
+			if err := fn(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return finish(tx)
+	}()
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("迁移失败，已标记为dirty: %d_%s, %w", one.Version, one.Name, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("迁移提交失败，已标记为dirty: %d_%s, %w", one.Version, one.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) quotedTable() string {
+	return "`" + strings.ReplaceAll(m.tableName, "`", "``") + "`"
+}
+
+// histories 已执行的迁移，按版本排序，表不存在时为空
+func (m *Migrator) histories(ctx context.Context) ([]*history, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, checksum, applied_at, dirty FROM "+m.quotedTable()+" ORDER BY version")
+	if err != nil {
+		if num, ok := sqlcomm.MysqlErrorNumber(err); ok && num == errNoSuchTable {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询迁移历史失败: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	var ret []*history
+	for rows.Next() {
+		one := &history{}
+		// 连接没有 parseTime 时DATETIME为字符串，统一按字符串读取后解析
+		var appliedAt sql.NullString
+		if err = rows.Scan(&one.version, &one.name, &one.checksum, &appliedAt, &one.dirty); err != nil {
+			return nil, fmt.Errorf("查询迁移历史失败: %w", err)
+		}
+		if one.appliedAt, err = parseAppliedAt(appliedAt.String); err != nil {
+			return nil, fmt.Errorf("查询迁移历史失败: %d, %w", one.version, err)
+		}
+		ret = append(ret, one)
+	}
+	return ret, rows.Err()
+}
+
+// parseAppliedAt 解析执行时间，parseTime 时为 RFC3339 格式，驱动默认使用UTC
+func parseAppliedAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.Local(), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", value, time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Local(), nil
+}
+
+func (m *Migrator) createTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.quotedTable()+` (
+  version BIGINT NOT NULL,
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  checksum CHAR(32) NOT NULL DEFAULT '',
+  applied_at DATETIME NOT NULL,
+  dirty TINYINT(1) NOT NULL DEFAULT 0,
+  PRIMARY KEY (version)
+) DEFAULT CHARSET=utf8mb4`)
+	if err != nil {
+		return fmt.Errorf("创建迁移历史表失败: %w", err)
+	}
+	return nil
+}
+
+// withLock 在 GET_LOCK 锁中执行，锁与连接绑定，所以使用单独的连接
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("获取连接失败: %w", err)
+	}
+	defer func(conn *sql.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	lockName := m.lockName
+	if lockName == "" {
+		var dbName sql.NullString
+		if err = conn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&dbName); err != nil {
+			return fmt.Errorf("查询库名失败: %w", err)
+		}
+		lockName = dbName.String + "." + m.tableName
+	}
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int64(m.lockTimeout/time.Second)).Scan(&locked)
+	if err != nil {
+		return fmt.Errorf("获取迁移锁失败: %w", err)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return fmt.Errorf("%w: %s", ErrLocked, lockName)
+	}
+	defer func() {
+		// 使用新的ctx，调用方取消时也要释放锁
+		_, _ = conn.ExecContext(context.WithoutCancel(ctx), "DO RELEASE_LOCK(?)", lockName)
+	}()
+
+	if m.dryRun == nil {
+		if err = m.createTable(ctx); err != nil {
+			return err
+		}
+	}
+	return fn()
+}
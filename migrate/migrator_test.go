@@ -0,0 +1,239 @@
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/magic-lib/go-plat-mysql/internal/fakedb"
+	"github.com/magic-lib/go-plat-mysql/migrate"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeDB 模拟 mysql 的迁移历史表，其他语句只记录，包含 FAIL 的语句返回错误
+type fakeDB struct {
+	histories  map[int64][]driver.Value // version, name, checksum, applied_at, dirty
+	statements []string
+}
+
+func newFakeDB(t *testing.T) (*fakeDB, *sql.DB) {
+	t.Helper()
+	fake := &fakeDB{histories: make(map[int64][]driver.Value)}
+	_, db := fakedb.Open(t, fake.handle)
+	return fake, db
+}
+
+func (f *fakeDB) executed() []string {
+	return append([]string{}, f.statements...)
+}
+
+func (f *fakeDB) handle(query string, args []driver.NamedValue) (*fakedb.Rows, error) {
+	switch {
+	case query == "SELECT DATABASE()":
+		return &fakedb.Rows{Columns: []string{"db"}, Values: [][]driver.Value{{[]byte("test")}}}, nil
+	case strings.HasPrefix(query, "SELECT GET_LOCK"):
+		return &fakedb.Rows{Columns: []string{"locked"}, Values: [][]driver.Value{{int64(1)}}}, nil
+	case strings.HasPrefix(query, "SELECT version, name, checksum, applied_at, dirty FROM `schema_migrations`"):
+		ret := &fakedb.Rows{Columns: []string{"version", "name", "checksum", "applied_at", "dirty"}}
+		for _, row := range f.histories {
+			ret.Values = append(ret.Values, append([]driver.Value{}, row...))
+		}
+		sort.Slice(ret.Values, func(i, j int) bool { return ret.Values[i][0].(int64) < ret.Values[j][0].(int64) })
+		return ret, nil
+	case strings.HasPrefix(query, "SELECT "):
+		return nil, errors.New("unexpected query: " + query)
+	case strings.HasPrefix(query, "DO RELEASE_LOCK"), strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS `schema_migrations`"):
+	case strings.HasPrefix(query, "INSERT INTO `schema_migrations`"):
+		version := args[0].Value.(int64)
+		if _, ok := f.histories[version]; ok {
+			return nil, errors.New("duplicate version")
+		}
+		f.histories[version] = []driver.Value{version, args[1].Value, args[2].Value, formatTime(args[3].Value), int64(1)}
+	case strings.HasPrefix(query, "UPDATE `schema_migrations` SET dirty = 0, applied_at = ?"):
+		row := f.histories[args[1].Value.(int64)]
+		row[3], row[4] = formatTime(args[0].Value), int64(0)
+	case strings.HasPrefix(query, "UPDATE `schema_migrations` SET dirty = "):
+		dirty := int64(0)
+		if strings.Contains(query, "dirty = 1") {
+			dirty = 1
+		}
+		if row, ok := f.histories[args[0].Value.(int64)]; ok {
+			row[4] = dirty
+		}
+	case strings.HasPrefix(query, "DELETE FROM `schema_migrations`"):
+		delete(f.histories, args[0].Value.(int64))
+	default:
+		f.statements = append(f.statements, query)
+		if strings.Contains(query, "FAIL") {
+			return nil, errors.New("fail statement")
+		}
+	}
+	return nil, nil
+}
+
+// formatTime 没有 parseTime 时驱动返回的 DATETIME
+func formatTime(value driver.Value) driver.Value {
+	return []byte(value.(time.Time).UTC().Format(time.DateTime))
+}
+
+func loadMigrations(t *testing.T, files map[string]string) []*migrate.Migration {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	list, err := migrate.LoadFS(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+var testMigrations = map[string]string{
+	"0001_create_user.up.sql":   "CREATE TABLE user (id bigint primary key);",
+	"0001_create_user.down.sql": "DROP TABLE user;",
+	"0002_add_email.up.sql":     "ALTER TABLE user ADD COLUMN email varchar(128);",
+	"0002_add_email.down.sql":   "ALTER TABLE user DROP COLUMN email;",
+}
+
+func versions(list []*migrate.Migration) []int64 {
+	ret := make([]int64, 0, len(list))
+	for _, one := range list {
+		ret = append(ret, one.Version)
+	}
+	return ret
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	ctx := context.Background()
+	fake, db := newFakeDB(t)
+	m, err := migrate.NewMigrator(db, migrate.WithMigrations(loadMigrations(t, testMigrations)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Second)
+	list, err := m.Up(ctx)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("up: %v, %v", versions(list), err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, one := range status {
+		if !one.Applied || one.Dirty || one.AppliedAt.Before(start) || one.AppliedAt.After(time.Now().Add(time.Second)) {
+			t.Errorf("status: %+v", one)
+		}
+	}
+	if list, err = m.Up(ctx); err != nil || len(list) != 0 {
+		t.Errorf("up again: %v, %v", versions(list), err)
+	}
+
+	if list, err = m.Down(ctx, 1); err != nil || len(list) != 1 || list[0].Version != 2 {
+		t.Fatalf("down: %v, %v", versions(list), err)
+	}
+	if list, err = m.To(ctx, 2); err != nil || len(list) != 1 || list[0].Version != 2 {
+		t.Fatalf("to 2: %v, %v", versions(list), err)
+	}
+	if list, err = m.To(ctx, 0); err != nil || len(list) != 2 || list[0].Version != 2 || list[1].Version != 1 {
+		t.Fatalf("to 0: %v, %v", versions(list), err)
+	}
+	want := []string{
+		"CREATE TABLE user (id bigint primary key)",
+		"ALTER TABLE user ADD COLUMN email varchar(128)",
+		"ALTER TABLE user DROP COLUMN email",
+		"ALTER TABLE user ADD COLUMN email varchar(128)",
+		"ALTER TABLE user DROP COLUMN email",
+		"DROP TABLE user",
+	}
+	if got := strings.Join(fake.executed(), ";"); got != strings.Join(want, ";") {
+		t.Errorf("statements: %s", got)
+	}
+}
+
+func TestMigratorChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	_, db := newFakeDB(t)
+	m, _ := migrate.NewMigrator(db, migrate.WithMigrations(loadMigrations(t, testMigrations)...))
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]string, len(testMigrations))
+	for name, content := range testMigrations {
+		files[name] = content
+	}
+	files["0001_create_user.up.sql"] = "CREATE TABLE user (id bigint primary key, name varchar(64));"
+	m, _ = migrate.NewMigrator(db, migrate.WithMigrations(loadMigrations(t, files)...))
+	if _, err := m.Up(ctx); !errors.Is(err, migrate.ErrChecksumMismatch) {
+		t.Errorf("modified migration: %v", err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil || !status[0].ChecksumMismatch || status[1].ChecksumMismatch {
+		t.Errorf("status: %+v, %v", status, err)
+	}
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	fake, db := newFakeDB(t)
+	var out bytes.Buffer
+	m, _ := migrate.NewMigrator(db, migrate.WithDryRun(&out), migrate.WithMigrations(loadMigrations(t, testMigrations)...))
+	list, err := m.Up(context.Background())
+	if err != nil || len(list) != 2 {
+		t.Fatalf("dry run: %v, %v", versions(list), err)
+	}
+	if len(fake.executed()) != 0 || len(fake.histories) != 0 {
+		t.Errorf("dry run should not execute: %v, %v", fake.executed(), fake.histories)
+	}
+	if !strings.Contains(out.String(), "-- 1_create_user\nCREATE TABLE user (id bigint primary key);\n") {
+		t.Errorf("output: %s", out.String())
+	}
+}
+
+func TestMigratorDirty(t *testing.T) {
+	ctx := context.Background()
+	_, db := newFakeDB(t)
+	files := map[string]string{
+		"0001_create_user.up.sql": "CREATE TABLE user (id bigint primary key);",
+		"0002_broken.up.sql":      "ALTER TABLE user ADD COLUMN a int; FAIL;",
+	}
+	m, _ := migrate.NewMigrator(db, migrate.WithMigrations(loadMigrations(t, files)...))
+	list, err := m.Up(ctx)
+	if err == nil || len(list) != 1 {
+		t.Fatalf("broken migration should fail: %v, %v", versions(list), err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil || !status[0].Applied || status[1].Applied || !status[1].Dirty {
+		t.Fatalf("status: %+v, %v", status, err)
+	}
+	if _, err = m.Up(ctx); !errors.Is(err, migrate.ErrDirty) {
+		t.Errorf("up while dirty: %v", err)
+	}
+	if _, err = m.Down(ctx, 1); !errors.Is(err, migrate.ErrDirty) {
+		t.Errorf("down while dirty: %v", err)
+	}
+
+	if err = m.Force(ctx, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ = m.Status(ctx); status[1].Applied || status[1].Dirty {
+		t.Errorf("force not applied: %+v", status[1])
+	}
+	if _, err = m.Up(ctx); err == nil {
+		t.Fatal("broken migration should fail again")
+	}
+	if err = m.Force(ctx, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ = m.Status(ctx); !status[1].Applied || status[1].Dirty {
+		t.Errorf("force applied: %+v", status[1])
+	}
+	if list, err = m.Up(ctx); err != nil || len(list) != 0 {
+		t.Errorf("up after force: %v, %v", versions(list), err)
+	}
+}
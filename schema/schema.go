@@ -0,0 +1,329 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"sort"
+	"strings"
+)
+
+// Schema 一个库的表结构
+type Schema struct {
+	Tables []*Table `json:"tables"`
+	// 表结构来自Go struct时没有外键信息，对比时不处理外键
+	NoForeignKeys bool `json:"no_foreign_keys"`
+}
+
+// Table 表结构
+type Table struct {
+	Name        string        `json:"name"`
+	Engine      string        `json:"engine,omitempty"`
+	Collation   string        `json:"collation,omitempty"`
+	Comment     string        `json:"comment,omitempty"`
+	Columns     []*Column     `json:"columns"`
+	Indexes     []*Index      `json:"indexes,omitempty"` // 包括主键，主键的名字为 PRIMARY
+	ForeignKeys []*ForeignKey `json:"foreign_keys,omitempty"`
+}
+
+// Column 字段
+type Column struct {
+	Name          string  `json:"name"`
+	Type          string  `json:"type"` // 完整的类型，如 bigint unsigned、varchar(64)
+	Nullable      bool    `json:"nullable"`
+	Default       *string `json:"default,omitempty"`      // nil为没有默认值，字符串不包含引号
+	DefaultExpr   bool    `json:"default_expr,omitempty"` // 默认值是表达式，如 (uuid())
+	AutoIncrement bool    `json:"auto_increment,omitempty"`
+	OnUpdate      string  `json:"on_update,omitempty"` // 如 CURRENT_TIMESTAMP
+	Generated     string  `json:"generated,omitempty"` // 生成列的表达式
+	Stored        bool    `json:"stored,omitempty"`    // 生成列是否存储
+	Collation     string  `json:"collation,omitempty"`
+	Comment       string  `json:"comment,omitempty"`
+}
+
+// 索引类型
+const (
+	IndexPrimary  = "PRIMARY"
+	IndexUnique   = "UNIQUE"
+	IndexNormal   = "INDEX"
+	IndexFulltext = "FULLTEXT"
+	IndexSpatial  = "SPATIAL"
+)
+
+// PrimaryKeyName 主键索引的名字
+const PrimaryKeyName = "PRIMARY"
+
+// Index 索引
+type Index struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Columns []string `json:"columns"` // 有前缀长度时为 name(10)
+}
+
+// ForeignKey 外键
+type ForeignKey struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
+	OnUpdate   string   `json:"on_update,omitempty"`
+	OnDelete   string   `json:"on_delete,omitempty"`
+}
+
+// Table 获取表，不存在时返回nil
+func (s *Schema) Table(name string) *Table {
+	for _, one := range s.Tables {
+		if strings.EqualFold(one.Name, name) {
+			return one
+		}
+	}
+	return nil
+}
+
+// Column 获取字段，不存在时返回nil
+func (t *Table) Column(name string) *Column {
+	for _, one := range t.Columns {
+		if strings.EqualFold(one.Name, name) {
+			return one
+		}
+	}
+	return nil
+}
+
+// Index 获取索引，不存在时返回nil
+func (t *Table) Index(name string) *Index {
+	for _, one := range t.Indexes {
+		if strings.EqualFold(one.Name, name) {
+			return one
+		}
+	}
+	return nil
+}
+
+// ForeignKey 获取外键，不存在时返回nil
+func (t *Table) ForeignKey(name string) *ForeignKey {
+	for _, one := range t.ForeignKeys {
+		if strings.EqualFold(one.Name, name) {
+			return one
+		}
+	}
+	return nil
+}
+
+// LoadDatabase 从 information_schema 读取当前库的表结构，tables 为空时读取所有表
+func LoadDatabase(ctx context.Context, dbConn *sql.DB, tables ...string) (*Schema, error) {
+	s := &Schema{}
+	tableMap := make(map[string]*Table)
+	filter, args := tableFilter(tables)
+
+	rows, err := dbConn.QueryContext(ctx, `SELECT TABLE_NAME, IFNULL(ENGINE, ''), IFNULL(TABLE_COLLATION, ''), TABLE_COMMENT
+		FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE'`+filter+`
+		ORDER BY TABLE_NAME`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询表信息失败: %w", err)
+	}
+	err = scanRows(rows, func() error {
+		one := &Table{}
+		if err := rows.Scan(&one.Name, &one.Engine, &one.Collation, &one.Comment); err != nil {
+			return err
+		}
+		s.Tables = append(s.Tables, one)
+		tableMap[one.Name] = one
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询表信息失败: %w", err)
+	}
+
+	if err = loadColumns(ctx, dbConn, tableMap, filter, args); err != nil {
+		return nil, err
+	}
+	if err = loadIndexes(ctx, dbConn, tableMap, filter, args); err != nil {
+		return nil, err
+	}
+	if err = loadForeignKeys(ctx, dbConn, tableMap, filter, args); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func tableFilter(tables []string) (string, []any) {
+	if len(tables) == 0 {
+		return "", nil
+	}
+	args := make([]any, len(tables))
+	for i, one := range tables {
+		args[i] = one
+	}
+	return " AND TABLE_NAME IN (?" + strings.Repeat(",?", len(tables)-1) + ")", args
+}
+
+func scanRows(rows *sql.Rows, scan func() error) error {
+	defer closeRows(rows)
+	for rows.Next() {
+		if err := scan(); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func closeRows(rows *sql.Rows) {
+	_ = rows.Close()
+}
+
+// loadColumns 字段信息，只查询各版本都有的列
+func loadColumns(ctx context.Context, dbConn *sql.DB, tableMap map[string]*Table, filter string, args []any) error {
+	rows, err := dbConn.QueryContext(ctx, `SELECT TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, COLUMN_DEFAULT, IS_NULLABLE,
+		DATA_TYPE, COLLATION_NAME, COLUMN_TYPE, COLUMN_KEY, EXTRA, COLUMN_COMMENT, IFNULL(GENERATION_EXPRESSION, '')
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE()`+filter+`
+		ORDER BY TABLE_NAME, ORDINAL_POSITION`, args...)
+	if err != nil {
+		return fmt.Errorf("查询字段信息失败: %w", err)
+	}
+	err = scanRows(rows, func() error {
+		var isNullable string
+		col := &sqlcomm.MysqlColumn{}
+		if err := rows.Scan(&col.TableName, &col.ColumnName, &col.OrdinalPosition, &col.ColumnDefault, &isNullable,
+			&col.DataType, &col.CollationName, &col.ColumnType, &col.ColumnKey, &col.Extra, &col.ColumnComment,
+			&col.GenerationExpression); err != nil {
+			return err
+		}
+		col.IsNullable = isNullable == "YES"
+		if table, ok := tableMap[col.TableName]; ok {
+			table.Columns = append(table.Columns, NewColumn(col))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("查询字段信息失败: %w", err)
+	}
+	return nil
+}
+
+// NewColumn 由 information_schema 的字段信息生成
+func NewColumn(col *sqlcomm.MysqlColumn) *Column {
+	ret := &Column{
+		Name:      col.ColumnName,
+		Type:      col.ColumnType,
+		Nullable:  col.IsNullable,
+		Generated: col.GenerationExpression,
+		Comment:   col.ColumnComment,
+	}
+	if col.CollationName.Valid {
+		ret.Collation = col.CollationName.String
+	}
+	extra := strings.ToLower(col.Extra)
+	ret.AutoIncrement = strings.Contains(extra, "auto_increment")
+	ret.Stored = strings.Contains(extra, "stored generated")
+	if i := strings.Index(extra, "on update "); i >= 0 {
+		ret.OnUpdate = strings.ToUpper(strings.TrimSpace(col.Extra[i+len("on update "):]))
+	}
+	if col.ColumnDefault.Valid && ret.Generated == "" {
+		value := col.ColumnDefault.String
+		// MariaDB 的默认值带引号，NULL 表示没有默认值
+		if strings.EqualFold(value, "NULL") {
+			return ret
+		}
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+		}
+		ret.Default = &value
+		ret.DefaultExpr = strings.Contains(extra, "default_generated") && !isTimestampKeyword(value)
+	}
+	return ret
+}
+
+func loadIndexes(ctx context.Context, dbConn *sql.DB, tableMap map[string]*Table, filter string, args []any) error {
+	rows, err := dbConn.QueryContext(ctx, `SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME, SUB_PART, INDEX_TYPE
+		FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE()`+filter+`
+		ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`, args...)
+	if err != nil {
+		return fmt.Errorf("查询索引信息失败: %w", err)
+	}
+	err = scanRows(rows, func() error {
+		var tableName, indexName, indexType string
+		var nonUnique int
+		var columnName sql.NullString
+		var subPart sql.NullInt64
+		if err := rows.Scan(&tableName, &indexName, &nonUnique, &columnName, &subPart, &indexType); err != nil {
+			return err
+		}
+		table, ok := tableMap[tableName]
+		if !ok || !columnName.Valid { //函数索引不处理
+			return nil
+		}
+		index := table.Index(indexName)
+		if index == nil {
+			index = &Index{Name: indexName, Type: IndexNormal}
+			switch {
+			case indexName == PrimaryKeyName:
+				index.Type = IndexPrimary
+			case indexType == IndexFulltext || indexType == IndexSpatial:
+				index.Type = indexType
+			case nonUnique == 0:
+				index.Type = IndexUnique
+			}
+			table.Indexes = append(table.Indexes, index)
+		}
+		column := columnName.String
+		if subPart.Valid {
+			column = fmt.Sprintf("%s(%d)", column, subPart.Int64)
+		}
+		index.Columns = append(index.Columns, column)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("查询索引信息失败: %w", err)
+	}
+	for _, table := range tableMap {
+		sortIndexes(table.Indexes)
+	}
+	return nil
+}
+
+// sortIndexes 主键在前，其他按名字排序
+func sortIndexes(indexes []*Index) {
+	sort.SliceStable(indexes, func(i, j int) bool {
+		if (indexes[i].Type == IndexPrimary) != (indexes[j].Type == IndexPrimary) {
+			return indexes[i].Type == IndexPrimary
+		}
+		return indexes[i].Name < indexes[j].Name
+	})
+}
+
+func loadForeignKeys(ctx context.Context, dbConn *sql.DB, tableMap map[string]*Table, filter string, args []any) error {
+	rows, err := dbConn.QueryContext(ctx, `SELECT k.TABLE_NAME, k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_NAME,
+		k.REFERENCED_COLUMN_NAME, r.UPDATE_RULE, r.DELETE_RULE
+		FROM information_schema.KEY_COLUMN_USAGE k
+		JOIN information_schema.REFERENTIAL_CONSTRAINTS r
+		  ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME AND r.TABLE_NAME = k.TABLE_NAME
+		WHERE k.TABLE_SCHEMA = DATABASE() AND k.REFERENCED_TABLE_NAME IS NOT NULL`+strings.ReplaceAll(filter, "TABLE_NAME", "k.TABLE_NAME")+`
+		ORDER BY k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION`, args...)
+	if err != nil {
+		return fmt.Errorf("查询外键信息失败: %w", err)
+	}
+	err = scanRows(rows, func() error {
+		var tableName, name, column, refTable, refColumn, onUpdate, onDelete string
+		if err := rows.Scan(&tableName, &name, &column, &refTable, &refColumn, &onUpdate, &onDelete); err != nil {
+			return err
+		}
+		table, ok := tableMap[tableName]
+		if !ok {
+			return nil
+		}
+		fk := table.ForeignKey(name)
+		if fk == nil {
+			fk = &ForeignKey{Name: name, RefTable: refTable, OnUpdate: onUpdate, OnDelete: onDelete}
+			table.ForeignKeys = append(table.ForeignKeys, fk)
+		}
+		fk.Columns = append(fk.Columns, column)
+		fk.RefColumns = append(fk.RefColumns, refColumn)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("查询外键信息失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,571 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 迁移语句的类型
+const (
+	StatementDropForeignKey = "drop_foreign_key"
+	StatementCreateTable    = "create_table"
+	StatementAlterTable     = "alter_table"
+	StatementAddForeignKey  = "add_foreign_key"
+	StatementDropTable      = "drop_table"
+)
+
+// Statement 一条迁移语句
+type Statement struct {
+	Table string `json:"table"`
+	Kind  string `json:"kind"`
+	Sql   string `json:"sql"`
+}
+
+// Plan 按顺序执行的迁移语句：先删外键，再建表、改表，然后加外键，最后删表
+type Plan struct {
+	Statements []*Statement `json:"statements"`
+}
+
+type diffOptions struct {
+	allowDrop         bool
+	ignoreComment     bool
+	ignoreForeignKeys bool
+	structTarget      bool // 目标来自struct，没有的默认值、ON UPDATE、注释不修改
+}
+
+// DiffOption 对比的选项
+type DiffOption func(*diffOptions)
+
+// WithAllowDrop 删除目标中不存在的表和字段，默认不删除
+func WithAllowDrop() DiffOption {
+	return func(o *diffOptions) {
+		o.allowDrop = true
+	}
+}
+
+// WithIgnoreComment 不比较表和字段的注释
+func WithIgnoreComment() DiffOption {
+	return func(o *diffOptions) {
+		o.ignoreComment = true
+	}
+}
+
+// WithIgnoreForeignKeys 不比较外键，目标来自struct时自动忽略
+func WithIgnoreForeignKeys() DiffOption {
+	return func(o *diffOptions) {
+		o.ignoreForeignKeys = true
+	}
+}
+
+var (
+	intWidthRegex  = regexp.MustCompile(`\b(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+	spaceRegex     = regexp.MustCompile(`\s+`)
+	numericDefault = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+)
+
+// Diff 生成从 from 变为 to 的迁移语句
+func Diff(from, to *Schema, opts ...DiffOption) *Plan {
+	o := &diffOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if from.NoForeignKeys || to.NoForeignKeys {
+		o.ignoreForeignKeys = true
+	}
+	o.structTarget = to.NoForeignKeys
+	var fkDrops, creates, alters, fkAdds, drops []*Statement
+	for _, toTable := range to.Tables {
+		fromTable := from.Table(toTable.Name)
+		if fromTable == nil {
+			creates = append(creates, &Statement{Table: toTable.Name, Kind: StatementCreateTable, Sql: CreateTableSql(toTable)})
+			if !o.ignoreForeignKeys {
+				for _, fk := range toTable.ForeignKeys {
+					fkAdds = append(fkAdds, addForeignKey(toTable.Name, fk))
+				}
+			}
+			continue
+		}
+		if clauses := alterClauses(fromTable, toTable, o); len(clauses) > 0 {
+			alters = append(alters, &Statement{
+				Table: toTable.Name,
+				Kind:  StatementAlterTable,
+				Sql:   "ALTER TABLE " + quoteName(toTable.Name) + "\n  " + strings.Join(clauses, ",\n  "),
+			})
+		}
+		if o.ignoreForeignKeys {
+			continue
+		}
+		for _, fk := range fromTable.ForeignKeys {
+			if toFk := toTable.ForeignKey(fk.Name); toFk == nil || !foreignKeyEqual(fk, toFk) {
+				fkDrops = append(fkDrops, &Statement{
+					Table: toTable.Name,
+					Kind:  StatementDropForeignKey,
+					Sql:   "ALTER TABLE " + quoteName(toTable.Name) + " DROP FOREIGN KEY " + quoteName(fk.Name),
+				})
+			}
+		}
+		for _, fk := range toTable.ForeignKeys {
+			if fromFk := fromTable.ForeignKey(fk.Name); fromFk == nil || !foreignKeyEqual(fromFk, fk) {
+				fkAdds = append(fkAdds, addForeignKey(toTable.Name, fk))
+			}
+		}
+	}
+	if o.allowDrop {
+		for _, fromTable := range from.Tables {
+			if to.Table(fromTable.Name) == nil {
+				drops = append(drops, &Statement{Table: fromTable.Name, Kind: StatementDropTable, Sql: "DROP TABLE " + quoteName(fromTable.Name)})
+			}
+		}
+	}
+	plan := &Plan{}
+	for _, list := range [][]*Statement{fkDrops, creates, alters, fkAdds, drops} {
+		plan.Statements = append(plan.Statements, list...)
+	}
+	return plan
+}
+
+// Empty 没有需要执行的语句
+func (p *Plan) Empty() bool {
+	return len(p.Statements) == 0
+}
+
+// String 所有语句，以分号分隔
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, one := range p.Statements {
+		b.WriteString(one.Sql)
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// Apply 按顺序执行，DDL不能回滚，出错时返回已经执行的条数
+func (p *Plan) Apply(ctx context.Context, dbConn *sql.DB) (int, error) {
+	for i, one := range p.Statements {
+		if _, err := sqlcomm.MysqlExecContext(ctx, dbConn, one.Sql); err != nil {
+			return i, fmt.Errorf("执行迁移失败: %s, %w", one.Table, err)
+		}
+	}
+	return len(p.Statements), nil
+}
+
+func alterClauses(from, to *Table, o *diffOptions) []string {
+	var clauses []string
+	indexDrops, indexAdds := diffIndexes(from, to)
+	clauses = append(clauses, indexDrops...)
+
+	if o.allowDrop {
+		for _, col := range from.Columns {
+			if to.Column(col.Name) == nil {
+				clauses = append(clauses, "DROP COLUMN "+quoteName(col.Name))
+			}
+		}
+	}
+	for i, col := range to.Columns {
+		fromCol := from.Column(col.Name)
+		if fromCol == nil {
+			position := " FIRST"
+			if i > 0 {
+				position = " AFTER " + quoteName(to.Columns[i-1].Name)
+			}
+			clauses = append(clauses, "ADD COLUMN "+ColumnDefinition(col)+position)
+			continue
+		}
+		if o.structTarget {
+			col = withUnspecified(fromCol, col)
+		}
+		if !columnEqual(fromCol, col, o) {
+			clauses = append(clauses, "MODIFY COLUMN "+ColumnDefinition(col))
+		}
+	}
+	clauses = append(clauses, indexAdds...)
+
+	var options []string
+	if to.Engine != "" && !strings.EqualFold(from.Engine, to.Engine) {
+		options = append(options, "ENGINE="+to.Engine)
+	}
+	if to.Collation != "" && !strings.EqualFold(from.Collation, to.Collation) {
+		options = append(options, collationOption(to.Collation))
+	}
+	if !o.ignoreComment && from.Comment != to.Comment && !(o.structTarget && to.Comment == "") {
+		options = append(options, "COMMENT="+quoteString(to.Comment))
+	}
+	if len(options) > 0 {
+		clauses = append(clauses, strings.Join(options, " "))
+	}
+	return clauses
+}
+
+// withUnspecified struct中没有设置的默认值、ON UPDATE、排序规则和注释使用库中的，修改字段时不会去掉
+func withUnspecified(from, to *Column) *Column {
+	ret := *to
+	if ret.Default == nil && from.Default != nil {
+		ret.Default, ret.DefaultExpr = from.Default, from.DefaultExpr
+	}
+	if ret.OnUpdate == "" {
+		ret.OnUpdate = from.OnUpdate
+	}
+	if ret.Collation == "" {
+		ret.Collation = from.Collation
+	}
+	if ret.Comment == "" {
+		ret.Comment = from.Comment
+	}
+	return &ret
+}
+
+// diffIndexes 按名字对比索引，名字不同但定义相同时视为同一个，不做重命名
+func diffIndexes(from, to *Table) (drops []string, adds []string) {
+	matched := make(map[*Index]bool)
+	for _, toIndex := range to.Indexes {
+		fromIndex := from.Index(toIndex.Name)
+		if fromIndex == nil {
+			for _, one := range from.Indexes {
+				if !matched[one] && to.Index(one.Name) == nil && indexEqual(one, toIndex) {
+					fromIndex = one
+					break
+				}
+			}
+		}
+		if fromIndex != nil {
+			matched[fromIndex] = true
+			if indexEqual(fromIndex, toIndex) {
+				continue
+			}
+			drops = append(drops, dropIndex(fromIndex))
+		}
+		adds = append(adds, "ADD "+IndexDefinition(toIndex))
+	}
+	for _, fromIndex := range from.Indexes {
+		if !matched[fromIndex] {
+			drops = append(drops, dropIndex(fromIndex))
+		}
+	}
+	return drops, adds
+}
+
+func dropIndex(index *Index) string {
+	if index.Type == IndexPrimary {
+		return "DROP PRIMARY KEY"
+	}
+	return "DROP INDEX " + quoteName(index.Name)
+}
+
+func addForeignKey(tableName string, fk *ForeignKey) *Statement {
+	return &Statement{
+		Table: tableName,
+		Kind:  StatementAddForeignKey,
+		Sql:   "ALTER TABLE " + quoteName(tableName) + " ADD " + ForeignKeyDefinition(fk),
+	}
+}
+
+func indexEqual(a, b *Index) bool {
+	if a.Type != b.Type || len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if !strings.EqualFold(a.Columns[i], b.Columns[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func foreignKeyEqual(a, b *ForeignKey) bool {
+	return strings.EqualFold(a.RefTable, b.RefTable) &&
+		strings.EqualFold(strings.Join(a.Columns, ","), strings.Join(b.Columns, ",")) &&
+		strings.EqualFold(strings.Join(a.RefColumns, ","), strings.Join(b.RefColumns, ",")) &&
+		strings.EqualFold(foreignKeyRule(a.OnUpdate), foreignKeyRule(b.OnUpdate)) &&
+		strings.EqualFold(foreignKeyRule(a.OnDelete), foreignKeyRule(b.OnDelete))
+}
+
+func foreignKeyRule(rule string) string {
+	if rule == "" {
+		return "RESTRICT"
+	}
+	// NO ACTION 在mysql中与 RESTRICT 相同
+	if strings.EqualFold(rule, "NO ACTION") {
+		return "RESTRICT"
+	}
+	return rule
+}
+
+func columnEqual(a, b *Column, o *diffOptions) bool {
+	if NormalizeType(a.Type) != NormalizeType(b.Type) || a.Nullable != b.Nullable || a.AutoIncrement != b.AutoIncrement {
+		return false
+	}
+	if !defaultEqual(a, b) || normalizeKeyword(a.OnUpdate) != normalizeKeyword(b.OnUpdate) {
+		return false
+	}
+	if spaceRegex.ReplaceAllString(a.Generated, "") != spaceRegex.ReplaceAllString(b.Generated, "") || a.Stored != b.Stored {
+		return false
+	}
+	if a.Collation != "" && b.Collation != "" && !strings.EqualFold(a.Collation, b.Collation) {
+		return false
+	}
+	return o.ignoreComment || a.Comment == b.Comment
+}
+
+func defaultEqual(a, b *Column) bool {
+	if a.Default == nil || b.Default == nil {
+		// 可为NULL的字段没有默认值即默认为NULL
+		return a.Default == nil && b.Default == nil
+	}
+	x, y := *a.Default, *b.Default
+	if isTimestampKeyword(x) || isTimestampKeyword(y) {
+		return normalizeKeyword(x) == normalizeKeyword(y)
+	}
+	if numericDefault.MatchString(x) && numericDefault.MatchString(y) {
+		fx, _ := strconv.ParseFloat(x, 64)
+		fy, _ := strconv.ParseFloat(y, 64)
+		return fx == fy
+	}
+	return x == y
+}
+
+func isTimestampKeyword(value string) bool {
+	upper := strings.ToUpper(value)
+	return strings.HasPrefix(upper, "CURRENT_TIMESTAMP") || strings.HasPrefix(upper, "NOW(") ||
+		strings.HasPrefix(upper, "LOCALTIMESTAMP") || strings.HasPrefix(upper, "LOCALTIME")
+}
+
+// normalizeKeyword CURRENT_TIMESTAMP 与 current_timestamp() 相同
+func normalizeKeyword(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(value, "()")
+	if value == "NOW" {
+		value = "CURRENT_TIMESTAMP"
+	}
+	return value
+}
+
+// NormalizeType 用于比较的类型：去掉整型的显示宽度，统一别名，enum和set的选项按原顺序和大小写统一引号
+func NormalizeType(columnType string) string {
+	t := strings.ToLower(strings.TrimSpace(spaceRegex.ReplaceAllString(columnType, " ")))
+	if options, ok := typeOptions(columnType); ok {
+		return t[:strings.IndexByte(t, '(')+1] + options + ")"
+	}
+	t = intWidthRegex.ReplaceAllStringFunc(t, func(s string) string {
+		if s == "tinyint(1)" {
+			return s
+		}
+		return s[:strings.IndexByte(s, '(')]
+	})
+	switch {
+	case t == "bool" || t == "boolean":
+		return "tinyint(1)"
+	case strings.HasPrefix(t, "integer"):
+		t = "int" + t[len("integer"):]
+	case strings.HasPrefix(t, "numeric"):
+		t = "decimal" + t[len("numeric"):]
+	case strings.HasPrefix(t, "double precision"):
+		t = "double" + t[len("double precision"):]
+	case strings.HasPrefix(t, "real"):
+		t = "double" + t[len("real"):]
+	}
+	if t == "decimal" || strings.HasPrefix(t, "decimal ") {
+		t = "decimal(10,0)" + t[len("decimal"):]
+	}
+	return t
+}
+
+// typeOptions enum和set的选项，解析引号中的值后重新引用，值中可以有逗号和引号
+func typeOptions(columnType string) (string, bool) {
+	columnType = strings.TrimSpace(columnType)
+	lower := strings.ToLower(columnType)
+	if !strings.HasPrefix(lower, "enum(") && !strings.HasPrefix(lower, "set(") {
+		return "", false
+	}
+	values, ok := parseTypeOptions(columnType[strings.IndexByte(columnType, '(')+1:])
+	if !ok {
+		return "", false
+	}
+	list := make([]string, 0, len(values))
+	for _, one := range values {
+		list = append(list, quoteString(one))
+	}
+	return strings.Join(list, ","), true
+}
+
+// parseTypeOptions 解析 'a','b') 形式的选项，值中的引号可以重复两次或用反斜杠转义
+func parseTypeOptions(str string) ([]string, bool) {
+	var values []string
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case c == ')':
+			return values, true
+		case c == ',' || c == ' ':
+			continue
+		case c != '\'' && c != '"':
+			return nil, false
+		default:
+			var value strings.Builder
+			for i++; i < len(str); i++ {
+				if str[i] == '\\' && i+1 < len(str) {
+					i++
+					value.WriteByte(str[i])
+				} else if str[i] == c && i+1 < len(str) && str[i+1] == c {
+					i++
+					value.WriteByte(c)
+				} else if str[i] == c {
+					break
+				} else {
+					value.WriteByte(str[i])
+				}
+			}
+			values = append(values, value.String())
+		}
+	}
+	return nil, false
+}
+
+// CreateTableSql 建表语句，外键单独添加
+func CreateTableSql(table *Table) string {
+	lines := make([]string, 0, len(table.Columns)+len(table.Indexes))
+	for _, col := range table.Columns {
+		lines = append(lines, ColumnDefinition(col))
+	}
+	for _, index := range table.Indexes {
+		lines = append(lines, IndexDefinition(index))
+	}
+	ret := "CREATE TABLE " + quoteName(table.Name) + " (\n  " + strings.Join(lines, ",\n  ") + "\n)"
+	if table.Engine != "" {
+		ret += " ENGINE=" + table.Engine
+	}
+	if table.Collation != "" {
+		ret += " " + collationOption(table.Collation)
+	}
+	if table.Comment != "" {
+		ret += " COMMENT=" + quoteString(table.Comment)
+	}
+	return ret
+}
+
+// ColumnDefinition 字段定义，用于 CREATE TABLE、ADD COLUMN、MODIFY COLUMN
+func ColumnDefinition(col *Column) string {
+	var b strings.Builder
+	b.WriteString(quoteName(col.Name) + " " + col.Type)
+	if col.Collation != "" {
+		b.WriteString(" COLLATE " + col.Collation)
+	}
+	if col.Generated != "" {
+		b.WriteString(" GENERATED ALWAYS AS (" + col.Generated + ")")
+		if col.Stored {
+			b.WriteString(" STORED")
+		} else {
+			b.WriteString(" VIRTUAL")
+		}
+	}
+	if col.Nullable {
+		b.WriteString(" NULL")
+	} else {
+		b.WriteString(" NOT NULL")
+	}
+	if col.AutoIncrement {
+		b.WriteString(" AUTO_INCREMENT")
+	}
+	if col.Default != nil {
+		b.WriteString(" DEFAULT " + defaultLiteral(col))
+	}
+	if col.OnUpdate != "" {
+		b.WriteString(" ON UPDATE " + col.OnUpdate)
+	}
+	if col.Comment != "" {
+		b.WriteString(" COMMENT " + quoteString(col.Comment))
+	}
+	return b.String()
+}
+
+func defaultLiteral(col *Column) string {
+	value := *col.Default
+	switch {
+	case col.DefaultExpr:
+		return "(" + value + ")"
+	case isTimestampKeyword(value):
+		return value
+	case strings.HasPrefix(value, "b'") || strings.HasPrefix(strings.ToLower(value), "0x"):
+		return value
+	case numericDefault.MatchString(value) && isNumericType(col.Type):
+		return value
+	}
+	return quoteString(value)
+}
+
+func isNumericType(columnType string) bool {
+	t := NormalizeType(columnType)
+	for _, prefix := range []string{"tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "float", "double", "bit", "year"} {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexDefinition 索引定义，用于 CREATE TABLE 和 ADD
+func IndexDefinition(index *Index) string {
+	columns := make([]string, len(index.Columns))
+	for i, one := range index.Columns {
+		columns[i] = quoteIndexColumn(one)
+	}
+	columnStr := "(" + strings.Join(columns, ", ") + ")"
+	switch index.Type {
+	case IndexPrimary:
+		return "PRIMARY KEY " + columnStr
+	case IndexUnique:
+		return "UNIQUE KEY " + quoteName(index.Name) + " " + columnStr
+	case IndexFulltext, IndexSpatial:
+		return index.Type + " KEY " + quoteName(index.Name) + " " + columnStr
+	}
+	return "KEY " + quoteName(index.Name) + " " + columnStr
+}
+
+// ForeignKeyDefinition 外键定义
+func ForeignKeyDefinition(fk *ForeignKey) string {
+	columns := make([]string, len(fk.Columns))
+	for i, one := range fk.Columns {
+		columns[i] = quoteName(one)
+	}
+	refColumns := make([]string, len(fk.RefColumns))
+	for i, one := range fk.RefColumns {
+		refColumns[i] = quoteName(one)
+	}
+	ret := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)", quoteName(fk.Name),
+		strings.Join(columns, ", "), quoteName(fk.RefTable), strings.Join(refColumns, ", "))
+	if fk.OnDelete != "" {
+		ret += " ON DELETE " + fk.OnDelete
+	}
+	if fk.OnUpdate != "" {
+		ret += " ON UPDATE " + fk.OnUpdate
+	}
+	return ret
+}
+
+// collationOption 表的字符集和排序规则，字符集取排序规则的前缀
+func collationOption(collation string) string {
+	if i := strings.IndexByte(collation, '_'); i > 0 {
+		return "DEFAULT CHARSET=" + collation[:i] + " COLLATE=" + collation
+	}
+	return "COLLATE=" + collation
+}
+
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteIndexColumn 带有前缀长度的字段，如 name(10)
+func quoteIndexColumn(column string) string {
+	if i := strings.IndexByte(column, '('); i > 0 && strings.HasSuffix(column, ")") {
+		return quoteName(column[:i]) + column[i:]
+	}
+	return quoteName(column)
+}
+
+func quoteString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,224 @@
+package schema_test
+
+import (
+	"github.com/magic-lib/go-plat-mysql/schema"
+	"strings"
+	"testing"
+	"time"
+)
+
+type diffUser struct {
+	Id        uint64    `xorm:"'id' pk autoincr"`
+	Name      string    `xorm:"'name' varchar(64) notnull default('') unique(uk_name)"`
+	Age       int       `xorm:"'age' notnull default(0) index(idx_age)"`
+	Email     *string   `xorm:"'email' varchar(128)"`
+	CreatedAt time.Time `xorm:"'created_at' notnull created"`
+}
+
+func (*diffUser) TableName() string {
+	return "user"
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestLoadStructs(t *testing.T) {
+	s, err := schema.LoadStructs([]any{new(diffUser)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := s.Table("user")
+	if table == nil || len(table.Columns) != 5 || !s.NoForeignKeys {
+		t.Fatalf("%+v", s)
+	}
+	id := table.Column("id")
+	if !id.AutoIncrement || id.Nullable || schema.NormalizeType(id.Type) != "bigint unsigned" {
+		t.Errorf("%+v", id)
+	}
+	name := table.Column("name")
+	if name.Default == nil || *name.Default != "" || name.Nullable || name.Type != "varchar(64)" {
+		t.Errorf("%+v", name)
+	}
+	if email := table.Column("email"); !email.Nullable || email.Default != nil {
+		t.Errorf("%+v", email)
+	}
+	if len(table.Indexes) != 3 || table.Indexes[0].Type != schema.IndexPrimary ||
+		table.Index("uk_name").Type != schema.IndexUnique || table.Index("idx_age").Columns[0] != "age" {
+		t.Errorf("%+v", table.Indexes)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	to, err := schema.LoadStructs([]any{new(diffUser)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := &schema.Schema{Tables: []*schema.Table{{
+		Name: "user",
+		Columns: []*schema.Column{
+			{Name: "id", Type: "bigint(20) unsigned", AutoIncrement: true},
+			{Name: "name", Type: "varchar(32)", Default: strPtr("")},
+			{Name: "age", Type: "int(11)", Default: strPtr("0")},
+			{Name: "created_at", Type: "datetime"},
+			{Name: "legacy", Type: "int", Nullable: true},
+		},
+		Indexes: []*schema.Index{
+			{Name: "PRIMARY", Type: schema.IndexPrimary, Columns: []string{"id"}},
+			{Name: "name", Type: schema.IndexUnique, Columns: []string{"name"}},
+			{Name: "idx_legacy", Type: schema.IndexNormal, Columns: []string{"legacy"}},
+		},
+	}, {
+		Name:    "old_table",
+		Columns: []*schema.Column{{Name: "id", Type: "int"}},
+	}}}
+
+	plan := schema.Diff(from, to)
+	if len(plan.Statements) != 1 {
+		t.Fatal(plan.String())
+	}
+	want := "ALTER TABLE `user`\n" +
+		"  DROP INDEX `idx_legacy`,\n" +
+		"  MODIFY COLUMN `name` varchar(64) NOT NULL DEFAULT '',\n" +
+		"  ADD COLUMN `email` varchar(128) NULL AFTER `age`,\n" +
+		"  ADD KEY `idx_age` (`age`)"
+	if plan.Statements[0].Sql != want {
+		t.Errorf("got:\n%s\nwant:\n%s", plan.Statements[0].Sql, want)
+	}
+
+	plan = schema.Diff(from, to, schema.WithAllowDrop())
+	if len(plan.Statements) != 2 || !strings.Contains(plan.Statements[0].Sql, "DROP COLUMN `legacy`") ||
+		plan.Statements[1].Sql != "DROP TABLE `old_table`" {
+		t.Error(plan.String())
+	}
+
+	// 新表
+	plan = schema.Diff(&schema.Schema{}, to)
+	if len(plan.Statements) != 1 || plan.Statements[0].Kind != schema.StatementCreateTable ||
+		!strings.Contains(plan.Statements[0].Sql, "UNIQUE KEY `uk_name` (`name`)") ||
+		!strings.Contains(plan.Statements[0].Sql, "`id` bigint(20) unsigned NOT NULL AUTO_INCREMENT") {
+		t.Error(plan.String())
+	}
+	if !schema.Diff(to, to).Empty() {
+		t.Error("same schema should have empty plan")
+	}
+}
+
+func TestDiffForeignKeys(t *testing.T) {
+	order := func(fks ...*schema.ForeignKey) *schema.Schema {
+		return &schema.Schema{Tables: []*schema.Table{{
+			Name:        "order",
+			Columns:     []*schema.Column{{Name: "user_id", Type: "bigint"}},
+			ForeignKeys: fks,
+		}}}
+	}
+	fk := &schema.ForeignKey{Name: "fk_user", Columns: []string{"user_id"}, RefTable: "user", RefColumns: []string{"id"}}
+	changed := *fk
+	changed.OnDelete = "CASCADE"
+
+	plan := schema.Diff(order(fk), order(&changed))
+	if len(plan.Statements) != 2 || plan.Statements[0].Kind != schema.StatementDropForeignKey ||
+		plan.Statements[1].Sql != "ALTER TABLE `order` ADD CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE" {
+		t.Error(plan.String())
+	}
+	if !schema.Diff(order(fk), order(), schema.WithIgnoreForeignKeys()).Empty() {
+		t.Error("foreign keys should be ignored")
+	}
+}
+
+type diffEnum struct {
+	Id     int64  `xorm:"pk autoincr 'id'"`
+	Status string `xorm:"enum('new','paid','Closed') notnull 'status'"`
+}
+
+func (diffEnum) TableName() string {
+	return "orders"
+}
+
+func TestNormalizeTypeOptions(t *testing.T) {
+	cases := map[string]string{
+		"ENUM('a', 'b''c')":   "enum('a','b''c')",
+		`enum('x,y',"z")`:     "enum('x,y','z')",
+		`set('a\'b','C')`:     "set('a''b','C')",
+		"INT(11) UNSIGNED":    "int unsigned",
+		"enum('int(11)','b')": "enum('int(11)','b')",
+	}
+	for in, want := range cases {
+		if got := schema.NormalizeType(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+	if schema.NormalizeType("enum('a','b')") == schema.NormalizeType("enum('b','a')") {
+		t.Error("reordered enum values should differ")
+	}
+	if schema.NormalizeType("enum('a','b')") == schema.NormalizeType("enum('A','b')") {
+		t.Error("case change of enum values should differ")
+	}
+
+	s, err := schema.LoadStructs([]any{new(diffEnum)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := s.Table("orders").Column("status")
+	if status.Type != "enum('new','paid','Closed')" {
+		t.Errorf("struct enum type: %s", status.Type)
+	}
+	db := &schema.Schema{Tables: []*schema.Table{{
+		Name: "orders",
+		Columns: []*schema.Column{
+			{Name: "id", Type: "bigint(20)", AutoIncrement: true},
+			{Name: "status", Type: "enum('new','paid','Closed')"},
+		},
+		Indexes: []*schema.Index{{Name: schema.PrimaryKeyName, Type: schema.IndexPrimary, Columns: []string{"id"}}},
+	}}}
+	if plan := schema.Diff(db, s); !plan.Empty() {
+		t.Errorf("same enum should not diff:\n%s", plan)
+	}
+	db.Tables[0].Columns[1].Type = "enum('paid','new','Closed')"
+	if plan := schema.Diff(db, s); plan.Empty() {
+		t.Error("reordered enum should diff")
+	}
+}
+
+func TestDiffStructUnspecified(t *testing.T) {
+	to, err := schema.LoadStructs([]any{new(diffUser)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := &schema.Schema{Tables: []*schema.Table{{
+		Name:    "user",
+		Engine:  "InnoDB",
+		Comment: "用户",
+		Columns: []*schema.Column{
+			{Name: "id", Type: "bigint(20) unsigned", AutoIncrement: true, Comment: "主键"},
+			{Name: "name", Type: "varchar(64)", Default: strPtr(""), Comment: "名字"},
+			{Name: "age", Type: "int(11)", Default: strPtr("0")},
+			{Name: "email", Type: "varchar(128)", Nullable: true, Collation: "utf8mb4_bin"},
+			{Name: "created_at", Type: "datetime", Default: strPtr("CURRENT_TIMESTAMP"),
+				OnUpdate: "CURRENT_TIMESTAMP", Comment: "创建时间"},
+		},
+		Indexes: []*schema.Index{
+			{Name: "PRIMARY", Type: schema.IndexPrimary, Columns: []string{"id"}},
+			{Name: "uk_name", Type: schema.IndexUnique, Columns: []string{"name"}},
+			{Name: "idx_age", Type: schema.IndexNormal, Columns: []string{"age"}},
+		},
+	}}}
+	if plan := schema.Diff(from, to); !plan.Empty() {
+		t.Errorf("unspecified struct attributes should not diff:\n%s", plan)
+	}
+
+	from.Tables[0].Column("name").Type = "varchar(32)"
+	from.Tables[0].Column("created_at").Type = "timestamp"
+	plan := schema.Diff(from, to)
+	want := "ALTER TABLE `user`\n" +
+		"  MODIFY COLUMN `name` varchar(64) NOT NULL DEFAULT '' COMMENT '名字',\n" +
+		"  MODIFY COLUMN `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '创建时间'"
+	if len(plan.Statements) != 1 || plan.Statements[0].Sql != want {
+		t.Errorf("got:\n%s\nwant:\n%s", plan, want)
+	}
+
+	// 来源是struct时照常比较
+	if plan = schema.Diff(to, from); plan.Empty() || !strings.Contains(plan.String(), "COMMENT='用户'") {
+		t.Errorf("database target should keep comments:\n%s", plan)
+	}
+}
@@ -0,0 +1,131 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"xorm.io/xorm/caches"
+	"xorm.io/xorm/dialects"
+	"xorm.io/xorm/names"
+	"xorm.io/xorm/schemas"
+	"xorm.io/xorm/tags"
+)
+
+type structOptions struct {
+	tagIdentifier string
+	tableMapper   names.Mapper
+	columnMapper  names.Mapper
+}
+
+// StructOption 解析struct的选项
+type StructOption func(*structOptions)
+
+// WithTagIdentifier 设置tag的名称，默认为xorm
+func WithTagIdentifier(tagName string) StructOption {
+	return func(o *structOptions) {
+		o.tagIdentifier = tagName
+	}
+}
+
+// WithMapper 设置表名和字段名的映射规则，默认与xorm相同为 names.SnakeMapper
+func WithMapper(tableMapper, columnMapper names.Mapper) StructOption {
+	return func(o *structOptions) {
+		o.tableMapper = tableMapper
+		o.columnMapper = columnMapper
+	}
+}
+
+// LoadStructs 由带有xorm tag的struct生成表结构，与 Dao 使用的规则相同，没有外键信息
+func LoadStructs(beans []any, opts ...StructOption) (*Schema, error) {
+	o := &structOptions{
+		tagIdentifier: "xorm",
+		tableMapper:   names.SnakeMapper{},
+		columnMapper:  names.SnakeMapper{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	dialect := dialects.QueryDialect(schemas.MYSQL)
+	if dialect == nil {
+		return nil, fmt.Errorf("mysql dialect not registered")
+	}
+	parser := tags.NewParser(o.tagIdentifier, dialect, o.tableMapper, o.columnMapper, caches.NewManager())
+
+	s := &Schema{NoForeignKeys: true}
+	for _, bean := range beans {
+		xormTable, err := parser.Parse(reflect.ValueOf(bean))
+		if err != nil {
+			return nil, fmt.Errorf("解析struct失败: %T, %w", bean, err)
+		}
+		s.Tables = append(s.Tables, structTable(dialect, xormTable))
+	}
+	return s, nil
+}
+
+func structTable(dialect dialects.Dialect, xormTable *schemas.Table) *Table {
+	table := &Table{
+		Name:      xormTable.Name,
+		Engine:    xormTable.StoreEngine,
+		Collation: xormTable.Collation,
+		Comment:   xormTable.Comment,
+	}
+	for _, col := range xormTable.Columns() {
+		column := &Column{
+			Name:          col.Name,
+			Type:          structColumnType(dialect, col),
+			Nullable:      col.Nullable,
+			AutoIncrement: col.IsAutoIncrement,
+			Collation:     col.Collation,
+			Comment:       col.Comment,
+		}
+		if !col.DefaultIsEmpty || col.IsVersion {
+			value := col.Default
+			if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+			}
+			column.Default = &value
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	if len(xormTable.PrimaryKeys) > 0 {
+		table.Indexes = append(table.Indexes, &Index{
+			Name:    PrimaryKeyName,
+			Type:    IndexPrimary,
+			Columns: append([]string{}, xormTable.PrimaryKeys...),
+		})
+	}
+	for _, one := range xormTable.Indexes {
+		index := &Index{Name: one.Name, Type: IndexNormal, Columns: append([]string{}, one.Cols...)}
+		if one.Type == schemas.UniqueType {
+			index.Type = IndexUnique
+		}
+		table.Indexes = append(table.Indexes, index)
+	}
+	sortIndexes(table.Indexes)
+	return table
+}
+
+// structColumnType 字段类型，xorm生成enum和set时遍历map，选项顺序不确定，按tag中的顺序重新生成
+func structColumnType(dialect dialects.Dialect, col *schemas.Column) string {
+	var options map[string]int
+	switch {
+	case len(col.EnumOptions) > 0:
+		options = col.EnumOptions
+	case len(col.SetOptions) > 0:
+		options = col.SetOptions
+	default:
+		return strings.ToLower(dialect.SQLType(col))
+	}
+	values := make([]string, 0, len(options))
+	for value := range options {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return options[values[i]] < options[values[j]]
+	})
+	for i, value := range values {
+		values[i] = quoteString(value)
+	}
+	return strings.ToLower(col.SQLType.Name) + "(" + strings.Join(values, ",") + ")"
+}
@@ -0,0 +1,342 @@
+package sqlcomm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/logs"
+	"math/rand/v2"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SqlAudit 一条语句的执行记录
+type SqlAudit struct {
+	Ctx          context.Context  `json:"-"`
+	Database     string           `json:"database,omitempty"`
+	Sql          string           `json:"sql"`
+	Fingerprint  string           `json:"fingerprint"`
+	Args         []any            `json:"args,omitempty"` // 已经脱敏
+	StartTime    time.Time        `json:"start_time"`
+	Duration     time.Duration    `json:"duration"`
+	RowsAffected int64            `json:"rows_affected"` // 查询语句为返回的行数，未知时为-1
+	Err          error            `json:"-"`
+	Error        string           `json:"error,omitempty"`
+	Caller       string           `json:"caller,omitempty"`
+	Slow         bool             `json:"slow"`
+	Explain      []map[string]any `json:"explain,omitempty"`
+}
+
+// SqlAuditHook 每条语句执行后的回调，不受采样影响，不能阻塞
+type SqlAuditHook func(audit *SqlAudit)
+
+// ExplainFunc 慢查询时获取执行计划
+type ExplainFunc func(ctx context.Context, sqlQuery string, args []any) ([]map[string]any, error)
+
+// AuditConfig sql审计配置
+type AuditConfig struct {
+	SlowThreshold time.Duration `json:"slow_threshold"` // 超过该耗时为慢查询，以WARN打印，为0时不检测
+	SampleRate    float64       `json:"sample_rate"`    // 非慢查询打印的采样率，0~1，为0时不打印
+	ExplainSlow   bool          `json:"explain_slow"`   // 慢查询时是否附带EXPLAIN，只对SELECT生效
+	RedactColumns []string      `json:"redact_columns"` // 需要脱敏的字段名，不区分大小写
+	MaxArgLength  int           `json:"max_arg_length"` // 字符串参数超过该长度时截断，为0时不截断
+	Stats         bool          `json:"stats"`          // 是否记录到 DefaultSqlStats，默认不记录
+	Logger        logs.ILogger  `json:"-"`              // 为nil时使用ctx中的日志
+}
+
+const redactedValue = "******"
+
+var (
+	// DefaultAuditConfig 默认的审计配置
+	DefaultAuditConfig = AuditConfig{
+		SlowThreshold: time.Second,
+		ExplainSlow:   true,
+		RedactColumns: []string{"password", "passwd", "pwd", "secret", "token"},
+		MaxArgLength:  256,
+	}
+
+	auditLock   sync.RWMutex
+	auditConfig = DefaultAuditConfig
+	auditHooks  []SqlAuditHook
+	// 慢查询的执行计划排队获取，同一个指纹的语句在间隔内只获取一次
+	slowExplainQueue = NewExplainAnalyzer(ExplainConfig{
+		Interval:  DefaultExplainConfig.Interval,
+		QueueSize: DefaultExplainConfig.QueueSize,
+	})
+
+	// 连接对应的数据库名，统计时按数据库区分
+	auditDbNames sync.Map
+
+	sqlCompareRegex  = regexp.MustCompile("(?i)`?(\\w+)`?\\s*(?:=|<>|!=|<=|>=|<|>|\\s+like|\\s+in\\s*\\()\\s*$")
+	sqlInsertColumns = regexp.MustCompile("(?is)^\\s*(?:insert|replace)\\s+(?:ignore\\s+)?(?:into\\s+)?\\S+\\s*\\(([^)]*)\\)\\s*values")
+)
+
+// SetAuditConfig 设置全局的sql审计配置
+func SetAuditConfig(cfg AuditConfig) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	auditConfig = cfg
+}
+
+// GetAuditConfig 获取全局的sql审计配置
+func GetAuditConfig() AuditConfig {
+	auditLock.RLock()
+	defer auditLock.RUnlock()
+	return auditConfig
+}
+
+// AddAuditHook 添加语句执行后的回调，如统计、链路追踪
+func AddAuditHook(hook SqlAuditHook) {
+	if hook == nil {
+		return
+	}
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	auditHooks = append(auditHooks, hook)
+}
+
+// AuditSql 记录一条语句的执行：脱敏、慢查询检测、采样打印并通知回调，explain 为nil时慢查询不附带执行计划
+func AuditSql(audit *SqlAudit, explain ExplainFunc) {
+	if audit == nil {
+		return
+	}
+	auditLock.RLock()
+	cfg := auditConfig
+	hooks := auditHooks
+	auditLock.RUnlock()
+
+	if audit.Ctx == nil {
+		audit.Ctx = context.Background()
+	}
+	if audit.Fingerprint == "" {
+		audit.Fingerprint = SqlFingerprint(audit.Sql)
+	}
+	if audit.Err != nil {
+		audit.Error = audit.Err.Error()
+	}
+	if audit.Caller == "" {
+		audit.Caller = sqlCaller()
+	}
+	args := audit.Args //执行计划需要原始的参数
+	audit.Args = redactArgs(audit.Sql, audit.Args, &cfg)
+	audit.Slow = cfg.SlowThreshold > 0 && audit.Duration >= cfg.SlowThreshold
+
+	if cfg.Stats {
+		DefaultSqlStats.Record(audit)
+	}
+	for _, hook := range hooks {
+		hook(audit)
+	}
+
+	if audit.Slow {
+		if cfg.ExplainSlow && explain != nil && isSelectSql(audit.Sql) {
+			// 执行计划排队异步获取，不增加调用方的耗时，没有排上时不附带执行计划
+			slowAudit := *audit
+			queued := slowExplainQueue.enqueue(audit.Ctx, audit.Fingerprint, func(ctx context.Context) {
+				explainList, err := explain(ctx, slowAudit.Sql, args)
+				if err != nil {
+					explainList = []map[string]any{{"error": err.Error()}}
+				}
+				slowAudit.Explain = explainList
+				logAudit(&slowAudit, &cfg)
+			})
+			if queued {
+				return
+			}
+		}
+		logAudit(audit, &cfg)
+		return
+	}
+	if audit.Err != nil || (cfg.SampleRate > 0 && rand.Float64() < cfg.SampleRate) {
+		logAudit(audit, &cfg)
+	}
+}
+
+func logAudit(audit *SqlAudit, cfg *AuditConfig) {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = logs.CtxLogger(audit.Ctx)
+	}
+	content, err := json.Marshal(audit)
+	if err != nil {
+		content = []byte(fmt.Sprintf("%s %v", audit.Sql, err))
+	}
+	if audit.Slow {
+		logger.Warn("[SQL SLOW]", string(content))
+		return
+	}
+	if audit.Err != nil {
+		logger.Error("[SQL AUDIT]", string(content))
+		return
+	}
+	logger.Info("[SQL AUDIT]", string(content))
+}
+
+// redactArgs 脱敏字段对应的参数替换为******，过长的字符串截断
+func redactArgs(sqlQuery string, args []any, cfg *AuditConfig) []any {
+	if len(args) == 0 || (len(cfg.RedactColumns) == 0 && cfg.MaxArgLength <= 0) {
+		return args
+	}
+	columns := placeholderColumns(sqlQuery, len(args))
+	ret := make([]any, len(args))
+	for i, one := range args {
+		if columns[i] != "" && isRedactColumn(columns[i], cfg.RedactColumns) {
+			ret[i] = redactedValue
+			continue
+		}
+		ret[i] = truncateArg(one, cfg.MaxArgLength)
+	}
+	return ret
+}
+
+func truncateArg(arg any, maxLen int) any {
+	if maxLen <= 0 {
+		return arg
+	}
+	switch v := arg.(type) {
+	case string:
+		if len(v) > maxLen {
+			return v[:maxLen] + "..."
+		}
+	case []byte:
+		if len(v) > maxLen {
+			return fmt.Sprintf("[%d bytes]", len(v))
+		}
+	}
+	return arg
+}
+
+func isRedactColumn(column string, redactColumns []string) bool {
+	for _, one := range redactColumns {
+		if strings.EqualFold(column, one) {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholderColumns 每个?对应的字段名，找不到时为空
+func placeholderColumns(sqlQuery string, argLen int) []string {
+	columns := make([]string, argLen)
+	var insertColumns []string
+	if match := sqlInsertColumns.FindStringSubmatch(sqlQuery); len(match) == 2 {
+		for _, one := range strings.Split(match[1], ",") {
+			insertColumns = append(insertColumns, strings.Trim(strings.TrimSpace(one), "`"))
+		}
+	}
+	index := 0
+	inQuote := byte(0)
+	for i := 0; i < len(sqlQuery) && index < argLen; i++ {
+		c := sqlQuery[i]
+		if inQuote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == inQuote {
+				inQuote = 0
+			}
+			continue
+		}
+		if c == '\'' || c == '"' {
+			inQuote = c
+			continue
+		}
+		if c != '?' {
+			continue
+		}
+		//只看?前面的一小段，避免批量插入时整句重复匹配
+		if match := sqlCompareRegex.FindStringSubmatch(sqlQuery[max(0, i-64):i]); len(match) == 2 {
+			columns[index] = match[1]
+		} else if len(insertColumns) > 0 {
+			columns[index] = insertColumns[index%len(insertColumns)]
+		}
+		index++
+	}
+	return columns
+}
+
+func isSelectSql(sqlQuery string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sqlQuery)), "SELECT")
+}
+
+// sqlCaller 调用方的位置，跳过本库、xorm和database/sql
+func sqlCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isInternalFrame(frame) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func isInternalFrame(frame runtime.Frame) bool {
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	for _, prefix := range []string{"github.com/magic-lib/go-plat-mysql/", "xorm.io/", "database/sql", "runtime."} {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditStart 记录开始时间并开始span，返回结束时调用的函数和带有span的ctx
+func auditStart(ctx context.Context, dbConn *sql.DB, sqlQuery string, args []any) (context.Context, func(rowsAffected int64, err error)) {
+	dbName := auditDbName(ctx, dbConn)
+	start := time.Now()
+	ctx, span := StartSqlSpan(ctx, dbName, sqlQuery)
+	return ctx, func(rowsAffected int64, err error) {
+		EndSqlSpan(span, rowsAffected, err)
+		AuditSql(&SqlAudit{
+			Ctx:          ctx,
+			Database:     dbName,
+			Sql:          sqlQuery,
+			Args:         args,
+			StartTime:    start,
+			Duration:     time.Since(start),
+			RowsAffected: rowsAffected,
+			Err:          err,
+		}, DbExplainFunc(dbConn))
+	}
+}
+
+// auditDbName 获取连接的数据库名，每个连接只查询一次，失败时下次再查，不会被审计
+func auditDbName(ctx context.Context, dbConn *sql.DB) string {
+	if dbConn == nil {
+		return ""
+	}
+	if name, ok := auditDbNames.Load(dbConn); ok {
+		return name.(string)
+	}
+	var name sql.NullString
+	if err := dbConn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&name); err != nil {
+		return ""
+	}
+	auditDbNames.Store(dbConn, name.String)
+	return name.String
+}
+
+// DbExplainFunc 使用连接获取执行计划，不会被审计
+func DbExplainFunc(dbConn *sql.DB) ExplainFunc {
+	if dbConn == nil {
+		return nil
+	}
+	return func(ctx context.Context, sqlQuery string, args []any) ([]map[string]any, error) {
+		rows, err := dbConn.QueryContext(ctx, "EXPLAIN "+sqlQuery, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer closeRows(rows)
+		return MysqlColumnRowsToMaps(rows)
+	}
+}
@@ -0,0 +1,80 @@
+package sqlcomm_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAuditSql(t *testing.T) {
+	var got *sqlcomm.SqlAudit
+	sqlcomm.AddAuditHook(func(audit *sqlcomm.SqlAudit) {
+		got = audit
+	})
+	oldCfg := sqlcomm.GetAuditConfig()
+	defer sqlcomm.SetAuditConfig(oldCfg)
+	cfg := sqlcomm.DefaultAuditConfig
+	cfg.SlowThreshold = 10 * time.Millisecond
+	cfg.MaxArgLength = 4
+	sqlcomm.SetAuditConfig(cfg)
+
+	sqlcomm.AuditSql(&sqlcomm.SqlAudit{
+		Sql:      "UPDATE user SET `password` = ?, name = ? WHERE id = 10 AND token= ?",
+		Args:     []any{"abc", "long name", "xyz"},
+		Duration: 20 * time.Millisecond,
+	}, nil)
+	if got == nil || !got.Slow || got.RowsAffected != 0 {
+		t.Fatal(got)
+	}
+	if got.Args[0] != "******" || got.Args[1] != "long..." || got.Args[2] != "******" {
+		t.Error(got.Args)
+	}
+	if got.Fingerprint != "update user set `password` = ?, name = ? where id = ? and token= ?" {
+		t.Error(got.Fingerprint)
+	}
+	if got.Caller == "" {
+		t.Error("caller is empty")
+	}
+
+	sqlcomm.AuditSql(&sqlcomm.SqlAudit{
+		Sql:  "INSERT INTO user (name, pwd) VALUES (?, ?), (?, ?)",
+		Args: []any{"a", "b", "c", "d"},
+	}, nil)
+	if got.Slow || got.Args[0] != "a" || got.Args[1] != "******" || got.Args[2] != "c" || got.Args[3] != "******" {
+		t.Error(got.Slow, got.Args)
+	}
+}
+
+func TestAuditSqlExplainDedupe(t *testing.T) {
+	oldCfg := sqlcomm.GetAuditConfig()
+	defer sqlcomm.SetAuditConfig(oldCfg)
+	cfg := sqlcomm.DefaultAuditConfig
+	cfg.SlowThreshold = 10 * time.Millisecond
+	sqlcomm.SetAuditConfig(cfg)
+
+	var calls atomic.Int32
+	done := make(chan struct{}, 10)
+	explain := func(ctx context.Context, sqlQuery string, args []any) ([]map[string]any, error) {
+		calls.Add(1)
+		done <- struct{}{}
+		return []map[string]any{{"type": "ALL"}}, nil
+	}
+	for i := 0; i < 5; i++ {
+		sqlcomm.AuditSql(&sqlcomm.SqlAudit{
+			Sql:      fmt.Sprintf("SELECT * FROM audit_dedupe WHERE id = %d", i),
+			Duration: 20 * time.Millisecond,
+		}, explain)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("explain not called")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("explain called %d times", n)
+	}
+}
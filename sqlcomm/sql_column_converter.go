@@ -0,0 +1,262 @@
+package sqlcomm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/shopspring/decimal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xorm.io/xorm/schemas"
+)
+
+// ColumnConverter 将数据库返回的值转换为需要的类型，val 不会为 nil
+type ColumnConverter func(val any, columnType *sql.ColumnType) (any, error)
+
+// ColumnConverterRegistry 按字段类型或字段名转换查询结果，字段名的优先级高于类型
+type ColumnConverterRegistry struct {
+	mu       sync.RWMutex
+	byType   map[string]ColumnConverter
+	byColumn map[string]ColumnConverter
+}
+
+// MysqlGeometry 空间类型，MySQL内部格式为 4字节SRID(小端) + WKB
+type MysqlGeometry struct {
+	SRID uint32
+	WKB  []byte
+}
+
+// Value 转回MySQL内部格式，可以直接写入空间字段
+func (g MysqlGeometry) Value() (driver.Value, error) {
+	data := make([]byte, 4+len(g.WKB))
+	binary.LittleEndian.PutUint32(data, g.SRID)
+	copy(data[4:], g.WKB)
+	return data, nil
+}
+
+// DefaultColumnConverters 默认的转换规则，MysqlColumnRowsToMaps 没有指定时使用
+var DefaultColumnConverters = NewColumnConverterRegistry()
+
+// NewColumnConverterRegistry 创建转换规则，已包含默认的类型转换
+func NewColumnConverterRegistry() *ColumnConverterRegistry {
+	r := &ColumnConverterRegistry{
+		byType:   make(map[string]ColumnConverter),
+		byColumn: make(map[string]ColumnConverter),
+	}
+	for _, typeName := range []string{schemas.TinyInt, schemas.SmallInt, schemas.MediumInt, schemas.Int, schemas.BigInt, schemas.Year} {
+		r.byType[typeName] = convertInt64
+	}
+	for _, typeName := range []string{"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT"} {
+		r.byType[typeName] = convertUint64
+	}
+	for _, typeName := range []string{schemas.Float, schemas.Double} {
+		r.byType[typeName] = convertFloat64
+	}
+	r.byType[schemas.Decimal] = convertDecimal
+	for _, typeName := range []string{schemas.Char, schemas.Varchar, schemas.TinyText, schemas.Text, schemas.MediumText,
+		schemas.LongText, schemas.Enum, schemas.Set, schemas.Time} {
+		r.byType[typeName] = convertString
+	}
+	for _, typeName := range []string{schemas.Binary, schemas.VarBinary, schemas.TinyBlob, schemas.Blob, schemas.MediumBlob,
+		schemas.LongBlob, "VECTOR"} {
+		r.byType[typeName] = convertBytes
+	}
+	r.byType[schemas.Json] = convertJson
+	r.byType[schemas.Bit] = convertBit
+	r.byType["GEOMETRY"] = convertGeometry
+	r.setTimeConverter(time.Local)
+	return r
+}
+
+var timeTypeNames = []string{schemas.Date, schemas.DateTime, schemas.TimeStamp}
+
+func (r *ColumnConverterRegistry) setTimeConverter(loc *time.Location) {
+	for _, typeName := range timeTypeNames {
+		r.byType[typeName] = TimeConverter(loc)
+	}
+}
+
+// RegisterType 设置某个类型的转换，类型名与 sql.ColumnType.DatabaseTypeName 一致，如 DECIMAL、UNSIGNED BIGINT
+func (r *ColumnConverterRegistry) RegisterType(typeName string, converter ColumnConverter) *ColumnConverterRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byType[strings.ToUpper(strings.TrimSpace(typeName))] = converter
+	return r
+}
+
+// RegisterColumn 设置某个字段的转换
+func (r *ColumnConverterRegistry) RegisterColumn(columnName string, converter ColumnConverter) *ColumnConverterRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byColumn[columnName] = converter
+	return r
+}
+
+// SetLocation 设置时间的时区，连接没有设置 parseTime 时用于解析 DATE/DATETIME/TIMESTAMP，会覆盖这几个类型已注册的转换
+func (r *ColumnConverterRegistry) SetLocation(loc *time.Location) *ColumnConverterRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if loc != nil {
+		r.setTimeConverter(loc)
+	}
+	return r
+}
+
+// Clone 复制一份，在默认规则上修改时不影响全局
+func (r *ColumnConverterRegistry) Clone() *ColumnConverterRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	newRegistry := NewColumnConverterRegistry()
+	for k, v := range r.byType {
+		newRegistry.byType[k] = v
+	}
+	for k, v := range r.byColumn {
+		newRegistry.byColumn[k] = v
+	}
+	return newRegistry
+}
+
+// Convert 转换一个字段的值
+func (r *ColumnConverterRegistry) Convert(columnName string, columnType *sql.ColumnType, val any) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+	r.mu.RLock()
+	converter, ok := r.byColumn[columnName]
+	if !ok && columnType != nil {
+		converter, ok = r.byType[columnType.DatabaseTypeName()]
+	}
+	r.mu.RUnlock()
+	if !ok {
+		// 未知类型，[]byte 转为字符串，其他直接使用
+		if v, isBytes := val.([]byte); isBytes {
+			return string(v), nil
+		}
+		return val, nil
+	}
+	ret, err := converter(val, columnType)
+	if err != nil {
+		return nil, fmt.Errorf("column %s convert error: %w", columnName, err)
+	}
+	return ret, nil
+}
+
+// bytesToString 未设置parseTime或文本协议时，数值也是以[]byte返回
+func bytesToString(val any) (string, bool) {
+	switch v := val.(type) {
+	case []byte:
+		return string(v), true
+	case string:
+		return v, true
+	}
+	return "", false
+}
+
+func convertInt64(val any, _ *sql.ColumnType) (any, error) {
+	if s, ok := bytesToString(val); ok {
+		return strconv.ParseInt(s, 10, 64)
+	}
+	return conv.Convert[int64](val)
+}
+
+func convertUint64(val any, _ *sql.ColumnType) (any, error) {
+	if s, ok := bytesToString(val); ok {
+		return strconv.ParseUint(s, 10, 64)
+	}
+	return conv.Convert[uint64](val)
+}
+
+func convertFloat64(val any, _ *sql.ColumnType) (any, error) {
+	if s, ok := bytesToString(val); ok {
+		return strconv.ParseFloat(s, 64)
+	}
+	return conv.Convert[float64](val)
+}
+
+func convertDecimal(val any, _ *sql.ColumnType) (any, error) {
+	if s, ok := bytesToString(val); ok {
+		return decimal.NewFromString(s)
+	}
+	d := decimal.Decimal{}
+	err := d.Scan(val)
+	return d, err
+}
+
+func convertString(val any, _ *sql.ColumnType) (any, error) {
+	if s, ok := bytesToString(val); ok {
+		return s, nil
+	}
+	return conv.String(val), nil
+}
+
+func convertBytes(val any, _ *sql.ColumnType) (any, error) {
+	if v, ok := val.([]byte); ok {
+		// 驱动返回的[]byte在下一次Scan时会被复用
+		return append([]byte{}, v...), nil
+	}
+	return []byte(conv.String(val)), nil
+}
+
+func convertJson(val any, _ *sql.ColumnType) (any, error) {
+	switch v := val.(type) {
+	case []byte:
+		return json.RawMessage(append([]byte{}, v...)), nil
+	case string:
+		return json.RawMessage(v), nil
+	}
+	return nil, fmt.Errorf("unsupported json value %T", val)
+}
+
+// convertBit BIT(M) 按大端转为 uint64，需要 bool 时可以对字段注册 BitToBoolConverter
+func convertBit(val any, _ *sql.ColumnType) (any, error) {
+	if v, ok := val.([]byte); ok {
+		return bitToInt(v), nil
+	}
+	return conv.Convert[uint64](val)
+}
+
+// BitToBoolConverter 将 BIT(1) 转换为 bool
+func BitToBoolConverter(val any, _ *sql.ColumnType) (any, error) {
+	if v, ok := val.([]byte); ok {
+		return bitToInt(v) != 0, nil
+	}
+	return conv.Convert[bool](val)
+}
+
+func convertGeometry(val any, _ *sql.ColumnType) (any, error) {
+	v, ok := val.([]byte)
+	if !ok || len(v) < 4 {
+		return nil, fmt.Errorf("invalid geometry value")
+	}
+	return MysqlGeometry{
+		SRID: binary.LittleEndian.Uint32(v[:4]),
+		WKB:  append([]byte{}, v[4:]...),
+	}, nil
+}
+
+// TimeConverter 将 DATE/DATETIME/TIMESTAMP 转为指定时区的 time.Time，零值日期转为 time.Time{}
+func TimeConverter(loc *time.Location) ColumnConverter {
+	return func(val any, _ *sql.ColumnType) (any, error) {
+		if t, ok := val.(time.Time); ok {
+			return t, nil
+		}
+		s, ok := bytesToString(val)
+		if !ok {
+			return conv.Convert[time.Time](val)
+		}
+		if s == "" || strings.HasPrefix(s, "0000-00-00") {
+			return time.Time{}, nil
+		}
+		for _, layout := range []string{"2006-01-02 15:04:05.999999", time.DateOnly} {
+			if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid time value: %s", s)
+	}
+}
@@ -1,6 +1,7 @@
 package sqlcomm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/magic-lib/go-plat-utils/cond"
@@ -207,6 +208,9 @@ func MysqlColumnValidValue(v any, oneColumn *MysqlColumn) any {
 	defaultTime, ok := getDefaultTime(oneColumn)
 	if ok {
 		timeDay := conv.String(v)
+		if t, isTime := v.(time.Time); isTime && t.IsZero() {
+			timeDay = ""
+		}
 		if strings.HasPrefix(timeDay, "000") ||
 			timeDay == "" {
 			if oneColumn.IsNullable {
@@ -255,93 +259,39 @@ func MysqlColumnAutoIncrement(dbConn *sql.DB, tableName string) (columnName stri
 	return columnName, autoInc.Int64, nil
 }
 
-// MysqlColumnRowsToMaps 将sql.Rows转换为[]map[string]any
-func MysqlColumnRowsToMaps(rows *sql.Rows) ([]map[string]any, error) {
-	// 获取列名
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, err
-	}
-	columnsType, err := rows.ColumnTypes()
-	if err != nil {
-		return nil, err
-	}
-
+// MysqlColumnRowsToMaps 将sql.Rows转换为[]map[string]any，按字段类型转换，可传入自定义的转换规则，默认为 DefaultColumnConverters
+func MysqlColumnRowsToMaps(rows *sql.Rows, registry ...*ColumnConverterRegistry) ([]map[string]any, error) {
 	// 创建结果切片
 	var result []map[string]any
-
-	// 创建与列数相同长度的interface{}切片，用于存储每一行的值
-	values := make([]any, len(columns))
-	// 创建指向values中每个元素的指针切片
-	valuePtr := make([]any, len(columns))
-
-	// 遍历结果集的每一行
-	for rows.Next() {
-		// 初始化指针切片，每个元素指向values中对应位置的指针
-		for i := range columns {
-			valuePtr[i] = &values[i]
-		}
-
-		// 扫描当前行的数据到values中
-		if err := rows.Scan(valuePtr...); err != nil {
+	for row, err := range MysqlColumnRowsIter(context.Background(), rows, registry...) {
+		if err != nil {
 			return nil, err
 		}
-
-		// 创建当前行的map
-		row := make(map[string]any)
-		for i, colName := range columns {
-			// 获取值的指针
-			val := values[i]
-			// 处理空值
-			if val == nil {
-				row[colName] = nil
-				continue
-			}
-
-			valType := columnsType[i]
-
-			// 处理不同类型的值
-			switch v := val.(type) {
-			case []byte:
-				// 字节切片通常是字符串或二进制数据
-				typeName := valType.DatabaseTypeName()
-
-				if ok, _ := cond.Contains([]string{schemas.Char, schemas.Varchar, schemas.Text, schemas.LongText}, typeName); ok {
-					row[colName] = string(v)
-				} else if ok, _ = cond.Contains([]string{schemas.Bit, schemas.UnsignedBit}, typeName); ok {
-					if len(v) == 1 {
-						isAscII := isPrintableASCII(v)
-						if isAscII {
-							row[colName] = string(v)
-						} else {
-							row[colName] = bitToBool(v)
-						}
-					} else {
-						row[colName] = bitToInt(v)
-					}
-				} else {
-					row[colName] = string(v)
-				}
-
-			case time.Time:
-				// 时间类型，可根据需要格式化为字符串
-				row[colName] = v.Format(time.RFC3339)
-			default:
-				// 其他类型直接使用
-				row[colName] = v
-			}
-		}
-
 		// 将当前行添加到结果中
 		result = append(result, row)
 	}
+	return result, nil
+}
 
-	// 检查遍历过程中是否有错误
-	if err := rows.Err(); err != nil {
-		return nil, err
+func getColumnConverters(registry []*ColumnConverterRegistry) *ColumnConverterRegistry {
+	if len(registry) > 0 && registry[0] != nil {
+		return registry[0]
 	}
+	return DefaultColumnConverters
+}
 
-	return result, nil
+// mysqlColumnRowToMap 将一行数据转换为map
+func mysqlColumnRowToMap(registry *ColumnConverterRegistry, columns []string, columnsType []*sql.ColumnType, values []any) (map[string]any, error) {
+	// 创建当前行的map
+	row := make(map[string]any, len(columns))
+	for i, colName := range columns {
+		val, err := registry.Convert(colName, columnsType[i], values[i])
+		if err != nil {
+			return nil, err
+		}
+		row[colName] = val
+	}
+	return row, nil
 }
 
 // 处理 BIT(1) 类型（布尔值）
@@ -1,6 +1,7 @@
 package sqlcomm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/magic-lib/go-plat-utils/conv"
@@ -8,12 +9,19 @@ import (
 
 // MysqlQuery 执行查询语句
 func MysqlQuery(dbConn *sql.DB, sqlQuery string, params ...any) ([]map[string]any, error) {
+	return MysqlQueryContext(context.Background(), dbConn, sqlQuery, params...)
+}
+
+// MysqlQueryContext 执行查询语句，ctx中有span时会作为语句span的父span
+func MysqlQueryContext(ctx context.Context, dbConn *sql.DB, sqlQuery string, params ...any) ([]map[string]any, error) {
 	if sqlQuery == "" {
 		return nil, fmt.Errorf("查询语句不能为空")
 	}
 
-	rows, err := dbConn.Query(sqlQuery, params...)
+	ctx, done := auditStart(ctx, dbConn, sqlQuery, params)
+	rows, err := dbConn.QueryContext(ctx, sqlQuery, params...)
 	if err != nil {
+		done(-1, err)
 		return nil, fmt.Errorf("执行查询失败: sql: %s, param: %s, err: %w", sqlQuery, conv.String(params), err)
 	}
 	defer func(rows *sql.Rows) {
@@ -25,19 +33,40 @@ func MysqlQuery(dbConn *sql.DB, sqlQuery string, params ...any) ([]map[string]an
 
 	result, err := MysqlColumnRowsToMaps(rows)
 	if err != nil {
+		done(-1, err)
 		return nil, fmt.Errorf("将查询结果转换为map失败: %w", err)
 	}
+	done(int64(len(result)), nil)
 	return result, nil
 }
 
 // MysqlExec 执行变更语句
 func MysqlExec(dbConn *sql.DB, sqlQuery string, params ...any) (sql.Result, error) {
+	return MysqlExecContext(context.Background(), dbConn, sqlQuery, params...)
+}
+
+// MysqlExecContext 执行变更语句，ctx中有span时会作为语句span的父span
+func MysqlExecContext(ctx context.Context, dbConn *sql.DB, sqlQuery string, params ...any) (sql.Result, error) {
 	if sqlQuery == "" {
 		return nil, fmt.Errorf("执行语句不能为空")
 	}
-	result, err := dbConn.Exec(sqlQuery, params...)
+	ctx, done := auditStart(ctx, dbConn, sqlQuery, params)
+	result, err := dbConn.ExecContext(ctx, sqlQuery, params...)
 	if err != nil {
+		done(-1, err)
 		return nil, fmt.Errorf("sql执行失败: %s, %w", sqlQuery, err)
 	}
+	done(resultRowsAffected(result), nil)
 	return result, nil
 }
+
+func resultRowsAffected(result sql.Result) int64 {
+	if result == nil {
+		return -1
+	}
+	num, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return num
+}
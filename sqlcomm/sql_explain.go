@@ -0,0 +1,300 @@
+package sqlcomm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/logs"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 执行计划中发现的问题类型
+const (
+	ExplainIssueFullScan     = "full_scan"          // 全表扫描
+	ExplainIssueFilesort     = "filesort"           // 使用了文件排序
+	ExplainIssueTempTable    = "temporary_table"    // 使用了临时表
+	ExplainIssueRowsExamined = "rows_examined"      // 扫描行数超过阈值
+	ExplainIssueJoinNoIndex  = "join_without_index" // 关联的表没有使用索引
+)
+
+// ExplainIssue 执行计划中的一个问题
+type ExplainIssue struct {
+	Type   string `json:"type"`
+	Table  string `json:"table,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ExplainReport 一条语句的分析结果
+type ExplainReport struct {
+	Fingerprint string         `json:"fingerprint"`
+	Sql         string         `json:"sql"`
+	Issues      []ExplainIssue `json:"issues"`
+	Explain     string         `json:"-"` // EXPLAIN FORMAT=JSON 的原始结果
+}
+
+// ExplainJsonFunc 获取 EXPLAIN FORMAT=JSON 的结果
+type ExplainJsonFunc func(ctx context.Context, sqlQuery string, args []any) (string, error)
+
+// ExplainConfig 执行计划分析的配置
+type ExplainConfig struct {
+	SampleRate      float64                     `json:"sample_rate"`      // 采样率，0~1，为0时不分析
+	RowsThreshold   int64                       `json:"rows_threshold"`   // 单表扫描行数超过该值时告警，为0时不检测
+	Interval        time.Duration               `json:"interval"`         // 同一个指纹的语句在该时间内只分析一次，为0时只分析一次
+	QueueSize       int                         `json:"queue_size"`       // 等待分析的队列长度，满了时丢弃
+	MaxFingerprints int                         `json:"max_fingerprints"` // 去重记录的最大指纹数，满了时先清理过期的，仍然满时清空
+	OnReport        func(report *ExplainReport) `json:"-"`                // 有问题时的回调，为nil时打印日志
+}
+
+// DefaultExplainConfig 默认的执行计划分析配置
+var DefaultExplainConfig = ExplainConfig{
+	SampleRate:      0.1,
+	RowsThreshold:   10000,
+	Interval:        time.Hour,
+	QueueSize:       100,
+	MaxFingerprints: defaultStatsMaxFingerprints,
+}
+
+type explainTask struct {
+	ctx context.Context
+	run func(ctx context.Context)
+}
+
+// ExplainAnalyzer 异步分析查询语句的执行计划，按指纹去重，可以在多个Dao之间共用
+type ExplainAnalyzer struct {
+	cfg       ExplainConfig
+	lock      sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+	queue     chan *explainTask
+	startOnce sync.Once
+}
+
+// NewExplainAnalyzer 新建执行计划分析器
+func NewExplainAnalyzer(cfg ExplainConfig) *ExplainAnalyzer {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultExplainConfig.QueueSize
+	}
+	if cfg.MaxFingerprints <= 0 {
+		cfg.MaxFingerprints = DefaultExplainConfig.MaxFingerprints
+	}
+	return &ExplainAnalyzer{
+		cfg:   cfg,
+		seen:  make(map[string]time.Time),
+		queue: make(chan *explainTask, cfg.QueueSize),
+	}
+}
+
+// Submit 提交一条语句，只分析SELECT，按采样和指纹去重后放入队列，不会阻塞
+func (a *ExplainAnalyzer) Submit(ctx context.Context, sqlQuery string, args []any, explain ExplainJsonFunc) bool {
+	if a == nil || explain == nil || !isSelectSql(sqlQuery) {
+		return false
+	}
+	if a.cfg.SampleRate <= 0 || rand.Float64() >= a.cfg.SampleRate {
+		return false
+	}
+	fingerprint := SqlFingerprint(sqlQuery)
+	return a.enqueue(ctx, fingerprint, func(ctx context.Context) {
+		a.analyze(ctx, sqlQuery, args, fingerprint, explain)
+	})
+}
+
+// enqueue 按指纹去重后放入队列，由一个协程依次执行，队列满了时丢弃
+func (a *ExplainAnalyzer) enqueue(ctx context.Context, fingerprint string, run func(ctx context.Context)) bool {
+	if !a.markSeen(fingerprint) {
+		return false
+	}
+	a.startOnce.Do(func() {
+		go a.run()
+	})
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case a.queue <- &explainTask{ctx: context.WithoutCancel(ctx), run: run}:
+		return true
+	default:
+		a.unmarkSeen(fingerprint) //队列满了，下次再分析
+		return false
+	}
+}
+
+func (a *ExplainAnalyzer) markSeen(fingerprint string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if last, ok := a.seen[fingerprint]; ok {
+		if a.cfg.Interval <= 0 || time.Since(last) < a.cfg.Interval {
+			return false
+		}
+	}
+	now := time.Now()
+	if a.cfg.Interval > 0 && now.Sub(a.lastPrune) >= a.cfg.Interval {
+		a.pruneSeen(now)
+	}
+	if len(a.seen) >= a.cfg.MaxFingerprints {
+		a.pruneSeen(now)
+		if len(a.seen) >= a.cfg.MaxFingerprints {
+			clear(a.seen) //都没过期，清空后重新去重，最多多分析一次
+		}
+	}
+	a.seen[fingerprint] = now
+	return true
+}
+
+// pruneSeen 清理超过 Interval 的指纹，Interval 为0时不会过期
+func (a *ExplainAnalyzer) pruneSeen(now time.Time) {
+	a.lastPrune = now
+	if a.cfg.Interval <= 0 {
+		return
+	}
+	for fingerprint, last := range a.seen {
+		if now.Sub(last) >= a.cfg.Interval {
+			delete(a.seen, fingerprint)
+		}
+	}
+}
+
+func (a *ExplainAnalyzer) unmarkSeen(fingerprint string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.seen, fingerprint)
+}
+
+func (a *ExplainAnalyzer) run() {
+	for task := range a.queue {
+		task.run(task.ctx)
+	}
+}
+
+func (a *ExplainAnalyzer) analyze(ctx context.Context, sqlQuery string, args []any, fingerprint string, explain ExplainJsonFunc) {
+	explainJson, err := explain(ctx, sqlQuery, args)
+	if err != nil {
+		logs.CtxLogger(ctx).Error("explain error:", sqlQuery, err.Error())
+		return
+	}
+	issues, err := AnalyzeExplainJson(explainJson, a.cfg.RowsThreshold)
+	if err != nil {
+		logs.CtxLogger(ctx).Error("explain parse error:", sqlQuery, err.Error())
+		return
+	}
+	if len(issues) == 0 {
+		return
+	}
+	report := &ExplainReport{
+		Fingerprint: fingerprint,
+		Sql:         sqlQuery,
+		Issues:      issues,
+		Explain:     explainJson,
+	}
+	if a.cfg.OnReport != nil {
+		a.cfg.OnReport(report)
+		return
+	}
+	content, _ := json.Marshal(report)
+	logs.CtxLogger(ctx).Warn("[SQL EXPLAIN]", string(content))
+}
+
+// AnalyzeExplainJson 分析 EXPLAIN FORMAT=JSON 的结果，rowsThreshold 为0时不检测扫描行数
+func AnalyzeExplainJson(explainJson string, rowsThreshold int64) ([]ExplainIssue, error) {
+	var root map[string]any
+	if err := json.Unmarshal([]byte(explainJson), &root); err != nil {
+		return nil, fmt.Errorf("explain json error: %w", err)
+	}
+	w := &explainWalker{rowsThreshold: rowsThreshold}
+	w.walk(root, false)
+	return w.issues, nil
+}
+
+type explainWalker struct {
+	rowsThreshold int64
+	issues        []ExplainIssue
+}
+
+func (w *explainWalker) add(issueType, table, detail string) {
+	for _, one := range w.issues {
+		if one.Type == issueType && one.Table == table {
+			return
+		}
+	}
+	w.issues = append(w.issues, ExplainIssue{Type: issueType, Table: table, Detail: detail})
+}
+
+// walk 遍历执行计划，isJoin 表示在 nested_loop 中且不是第一个表
+func (w *explainWalker) walk(node any, isJoin bool) {
+	switch v := node.(type) {
+	case []any:
+		for _, one := range v {
+			w.walk(one, isJoin)
+		}
+	case map[string]any:
+		if using, _ := v["using_filesort"].(bool); using {
+			w.add(ExplainIssueFilesort, "", "")
+		}
+		if using, _ := v["using_temporary_table"].(bool); using {
+			w.add(ExplainIssueTempTable, "", "")
+		}
+		for key, child := range v {
+			switch key {
+			case "table":
+				if table, ok := child.(map[string]any); ok {
+					w.checkTable(table, isJoin)
+				}
+				w.walk(child, false)
+			case "nested_loop":
+				loop, _ := child.([]any)
+				for i, one := range loop {
+					w.walk(one, i > 0)
+				}
+			default:
+				w.walk(child, false)
+			}
+		}
+	}
+}
+
+func (w *explainWalker) checkTable(table map[string]any, isJoin bool) {
+	tableName, _ := table["table_name"].(string)
+	accessType, _ := table["access_type"].(string)
+	rows := explainNumber(table["rows_examined_per_scan"])
+	_, usingJoinBuffer := table["using_join_buffer"]
+
+	if isJoin && (accessType == "ALL" || usingJoinBuffer) {
+		detail := fmt.Sprintf("access_type: %s", accessType)
+		if cond, ok := table["attached_condition"].(string); ok {
+			detail += ", condition: " + cond
+		}
+		w.add(ExplainIssueJoinNoIndex, tableName, detail)
+	} else if accessType == "ALL" {
+		w.add(ExplainIssueFullScan, tableName, fmt.Sprintf("rows: %d", rows))
+	}
+	if w.rowsThreshold > 0 && rows > w.rowsThreshold {
+		w.add(ExplainIssueRowsExamined, tableName, fmt.Sprintf("rows: %d > %d", rows, w.rowsThreshold))
+	}
+}
+
+func explainNumber(v any) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case string:
+		var ret int64
+		_, _ = fmt.Sscan(strings.TrimSpace(n), &ret)
+		return ret
+	}
+	return 0
+}
+
+// DbExplainJsonFunc 使用连接获取 EXPLAIN FORMAT=JSON，不会被审计
+func DbExplainJsonFunc(dbConn *sql.DB) ExplainJsonFunc {
+	if dbConn == nil {
+		return nil
+	}
+	return func(ctx context.Context, sqlQuery string, args []any) (string, error) {
+		var ret string
+		err := dbConn.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+sqlQuery, args...).Scan(&ret)
+		return ret, err
+	}
+}
@@ -0,0 +1,106 @@
+package sqlcomm_test
+
+import (
+	"context"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"testing"
+	"time"
+)
+
+const explainJoinJson = `{
+  "query_block": {
+    "select_id": 1,
+    "ordering_operation": {
+      "using_filesort": true,
+      "grouping_operation": {
+        "using_temporary_table": true,
+        "nested_loop": [
+          {"table": {"table_name": "o", "access_type": "ALL", "rows_examined_per_scan": 50000}},
+          {"table": {"table_name": "u", "access_type": "ALL", "rows_examined_per_scan": 20,
+            "using_join_buffer": "hash join", "attached_condition": "(u.id = o.user_id)"}}
+        ]
+      }
+    }
+  }
+}`
+
+func TestAnalyzeExplainJson(t *testing.T) {
+	issues, err := sqlcomm.AnalyzeExplainJson(explainJoinJson, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]string)
+	for _, one := range issues {
+		found[one.Type] = one.Table
+	}
+	want := map[string]string{
+		sqlcomm.ExplainIssueFilesort:     "",
+		sqlcomm.ExplainIssueTempTable:    "",
+		sqlcomm.ExplainIssueFullScan:     "o",
+		sqlcomm.ExplainIssueRowsExamined: "o",
+		sqlcomm.ExplainIssueJoinNoIndex:  "u",
+	}
+	for k, v := range want {
+		if table, ok := found[k]; !ok || table != v {
+			t.Error(k, found)
+		}
+	}
+
+	issues, err = sqlcomm.AnalyzeExplainJson(`{"query_block": {"table": {"table_name": "u", "access_type": "const", "key": "PRIMARY"}}}`, 10000)
+	if err != nil || len(issues) != 0 {
+		t.Error(issues, err)
+	}
+}
+
+func TestExplainAnalyzer(t *testing.T) {
+	reports := make(chan *sqlcomm.ExplainReport, 4)
+	calls := 0
+	analyzer := sqlcomm.NewExplainAnalyzer(sqlcomm.ExplainConfig{
+		SampleRate: 1,
+		OnReport: func(report *sqlcomm.ExplainReport) {
+			reports <- report
+		},
+	})
+	explain := func(context.Context, string, []any) (string, error) {
+		calls++
+		return explainJoinJson, nil
+	}
+	if !analyzer.Submit(context.Background(), "SELECT * FROM o WHERE id = 1", nil, explain) {
+		t.Fatal("first submit should be accepted")
+	}
+	if analyzer.Submit(context.Background(), "SELECT * FROM o WHERE id = 2", nil, explain) {
+		t.Error("same fingerprint should be skipped")
+	}
+	if analyzer.Submit(context.Background(), "UPDATE o SET a = 1", nil, explain) {
+		t.Error("only select is analyzed")
+	}
+	select {
+	case report := <-reports:
+		if report.Fingerprint != "select * from o where id = ?" || len(report.Issues) == 0 {
+			t.Error(report)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no report")
+	}
+	if calls != 1 {
+		t.Error(calls)
+	}
+
+	small := sqlcomm.NewExplainAnalyzer(sqlcomm.ExplainConfig{
+		SampleRate:      1,
+		MaxFingerprints: 2,
+		OnReport:        func(*sqlcomm.ExplainReport) {},
+	})
+	for i, query := range []string{"SELECT * FROM a", "SELECT * FROM b", "SELECT * FROM c", "SELECT * FROM a"} {
+		if !small.Submit(context.Background(), query, nil, func(context.Context, string, []any) (string, error) {
+			return "{}", nil
+		}) {
+			t.Errorf("submit %d should be accepted after the seen fingerprints are cleared", i)
+		}
+	}
+
+	none := sqlcomm.NewExplainAnalyzer(sqlcomm.ExplainConfig{})
+	if none.Submit(context.Background(), "SELECT * FROM o WHERE id = 1", nil, explain) {
+		t.Error("sample rate 0 should analyze nothing")
+	}
+}
@@ -0,0 +1,118 @@
+package sqlcomm
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+var (
+	sqlInListRegex     = regexp.MustCompile(`\bin \(\?(?:, ?\?)*\)`)
+	sqlValuesListRegex = regexp.MustCompile(`\bvalues ?\(\?(?:, ?\?)*\)(?:, ?\(\?(?:, ?\?)*\))*`)
+)
+
+// SqlFingerprint 归一化语句：去掉注释和常量，合并IN列表和多行VALUES，关键字转为小写，
+// 相同结构的语句得到相同的结果，反引号中的标识符保持不变
+func SqlFingerprint(sqlQuery string) string {
+	var b strings.Builder
+	b.Grow(len(sqlQuery))
+	lastSpace := true
+	writeSpace := func() {
+		if !lastSpace {
+			b.WriteByte(' ')
+			lastSpace = true
+		}
+	}
+	n := len(sqlQuery)
+	for i := 0; i < n; i++ {
+		c := sqlQuery[i]
+		switch {
+		case c == '\'' || c == '"':
+			// 字符串常量
+			for i++; i < n; i++ {
+				if sqlQuery[i] == '\\' {
+					i++
+				} else if sqlQuery[i] == c {
+					if i+1 < n && sqlQuery[i+1] == c { //两个引号为转义
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+			lastSpace = false
+		case c == '`':
+			// 标识符原样保留
+			end := strings.IndexByte(sqlQuery[i+1:], '`')
+			if end < 0 {
+				b.WriteString(sqlQuery[i:])
+				i = n
+			} else {
+				b.WriteString(sqlQuery[i : i+end+2])
+				i += end + 1
+			}
+			lastSpace = false
+		case c == '/' && i+1 < n && sqlQuery[i+1] == '*':
+			end := strings.Index(sqlQuery[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 3
+			}
+			writeSpace()
+		case c == '#' || (c == '-' && i+2 < n && sqlQuery[i+1] == '-' && (sqlQuery[i+2] == ' ' || sqlQuery[i+2] == '\t')):
+			end := strings.IndexByte(sqlQuery[i:], '\n')
+			if end < 0 {
+				i = n
+			} else {
+				i += end
+			}
+			writeSpace()
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			writeSpace()
+		case isSqlDigit(c) && (i == 0 || !isSqlWordChar(sqlQuery[i-1])):
+			// 数字常量，包括小数、科学计数和0x开头的十六进制
+			i++
+			if c == '0' && i < n && (sqlQuery[i] == 'x' || sqlQuery[i] == 'X') {
+				i++
+			}
+			for i < n && (isSqlWordChar(sqlQuery[i]) || sqlQuery[i] == '.') {
+				i++
+			}
+			i--
+			b.WriteByte('?')
+			lastSpace = false
+		default:
+			if c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			b.WriteByte(c)
+			lastSpace = false
+		}
+	}
+	ret := strings.TrimSpace(b.String())
+	ret = sqlInListRegex.ReplaceAllString(ret, "in (?+)")
+	ret = sqlValuesListRegex.ReplaceAllString(ret, "values (?+)")
+	return ret
+}
+
+// SqlDigest 语句归一化后的哈希值，用于统计和去重
+func SqlDigest(sqlQuery string) string {
+	return FingerprintDigest(SqlFingerprint(sqlQuery))
+}
+
+// FingerprintDigest 指纹的哈希值
+func FingerprintDigest(fingerprint string) string {
+	sum := sha1.Sum([]byte(fingerprint))
+	return hex.EncodeToString(sum[:8])
+}
+
+func isSqlDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSqlWordChar(c byte) bool {
+	return isSqlDigit(c) || c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
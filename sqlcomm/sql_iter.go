@@ -0,0 +1,172 @@
+package sqlcomm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"iter"
+)
+
+// MysqlQueryIter 流式执行查询语句，逐行转换为map，不会一次加载全部结果，适合大结果集
+// 遍历结束或中途break时会自动关闭结果集
+func MysqlQueryIter(ctx context.Context, dbConn *sql.DB, sqlQuery string, params ...any) iter.Seq2[map[string]any, error] {
+	return func(yield func(map[string]any, error) bool) {
+		ctx, rows, done, err := queryRows(ctx, dbConn, sqlQuery, params...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		var num int64
+		var iterErr error
+		defer func() {
+			closeRows(rows)
+			done(num, iterErr)
+		}()
+		for row, err := range MysqlColumnRowsIter(ctx, rows) {
+			if err != nil {
+				iterErr = err
+			} else {
+				num++
+			}
+			if !yield(row, err) {
+				return
+			}
+		}
+	}
+}
+
+// QueryIter 流式执行查询语句，逐行转换为T，规则与 QueryInto 一致，params 中可以传入 ScanOption
+func QueryIter[T any](ctx context.Context, dbConn *sql.DB, sqlQuery string, params ...any) iter.Seq2[T, error] {
+	params, opts := splitScanOptions(params)
+	return func(yield func(T, error) bool) {
+		var zero T
+		ctx, rows, done, err := queryRows(ctx, dbConn, sqlQuery, params...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		var num int64
+		var iterErr error
+		defer func() {
+			closeRows(rows)
+			done(num, iterErr)
+		}()
+		for one, err := range ScanRowsIter[T](ctx, rows, opts...) {
+			if err != nil {
+				iterErr = err
+			} else {
+				num++
+			}
+			if !yield(one, err) {
+				return
+			}
+		}
+	}
+}
+
+// MysqlColumnRowsIter 将sql.Rows逐行转换为map，复用同一个扫描缓冲区，rows由调用方关闭
+// 转换规则与 MysqlColumnRowsToMaps 一致
+func MysqlColumnRowsIter(ctx context.Context, rows *sql.Rows, registry ...*ColumnConverterRegistry) iter.Seq2[map[string]any, error] {
+	converters := getColumnConverters(registry)
+	return func(yield func(map[string]any, error) bool) {
+		columns, err := rows.Columns()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		columnsType, err := rows.ColumnTypes()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for values, err := range scanRowValues(ctx, rows, len(columns)) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			row, err := mysqlColumnRowToMap(converters, columns, columnsType, values)
+			if !yield(row, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ScanRowsIter 将sql.Rows逐行转换为T，复用同一个扫描缓冲区，rows由调用方关闭
+func ScanRowsIter[T any](ctx context.Context, rows *sql.Rows, opts ...ScanOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		columns, err := rows.Columns()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		scanner, err := newRowScanner[T](columns, newScanConfig(opts...))
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for values, err := range scanRowValues(ctx, rows, len(columns)) {
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			one, err := scanner.scan(values)
+			if !yield(one, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// scanRowValues 逐行扫描，每一行都复用同一个values，只在本次迭代内有效
+func scanRowValues(ctx context.Context, rows *sql.Rows, columnLen int) iter.Seq2[[]any, error] {
+	return func(yield func([]any, error) bool) {
+		// 创建与列数相同长度的interface{}切片，用于存储每一行的值
+		values := make([]any, columnLen)
+		// 创建指向values中每个元素的指针切片
+		valuePtr := make([]any, columnLen)
+		for i := range values {
+			valuePtr[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			clear(values)
+			if err := rows.Scan(valuePtr...); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(values, nil) {
+				return
+			}
+		}
+		// 检查遍历过程中是否有错误
+		if err := rows.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// queryRows 执行查询并开始审计，关闭结果集后调用 done 传入读取的行数，结束审计
+func queryRows(ctx context.Context, dbConn *sql.DB, sqlQuery string, params ...any) (context.Context, *sql.Rows, func(int64, error), error) {
+	if sqlQuery == "" {
+		return ctx, nil, nil, fmt.Errorf("查询语句不能为空")
+	}
+	ctx, done := auditStart(ctx, dbConn, sqlQuery, params)
+	rows, err := dbConn.QueryContext(ctx, sqlQuery, params...)
+	if err != nil {
+		done(-1, err)
+		return ctx, nil, nil, fmt.Errorf("执行查询失败: sql: %s, param: %s, err: %w", sqlQuery, conv.String(params), err)
+	}
+	return ctx, rows, done, nil
+}
+
+func closeRows(rows *sql.Rows) {
+	if err := rows.Close(); err != nil {
+		fmt.Printf("关闭查询结果集失败: %v", err)
+	}
+}
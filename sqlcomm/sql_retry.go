@@ -0,0 +1,217 @@
+package sqlcomm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// mysql 错误码
+const (
+	ErrNumTooManyConnections uint16 = 1040 // Too many connections
+	ErrNumLockWaitTimeout    uint16 = 1205 // Lock wait timeout exceeded
+	ErrNumDeadlock           uint16 = 1213 // Deadlock found when trying to get lock
+	ErrNumReadOnly           uint16 = 1290 // --read-only，主从切换时写到了只读库
+	ErrNumServerGone         uint16 = 2006 // MySQL server has gone away
+	ErrNumServerLost         uint16 = 2013 // Lost connection to MySQL server during query
+)
+
+// RetryableErrorNumbers 可以重试的mysql错误码，其他错误码为不可重试的错误
+var RetryableErrorNumbers = map[uint16]bool{
+	ErrNumTooManyConnections: true,
+	ErrNumLockWaitTimeout:    true,
+	ErrNumDeadlock:           true,
+	ErrNumReadOnly:           true,
+	ErrNumServerGone:         true,
+	ErrNumServerLost:         true,
+}
+
+// RetryPolicy 重试策略，指数退避并加上随机抖动
+// 注意：连接断开时语句可能已经执行成功，非幂等的语句需要自行判断是否可以重试
+// json 中的时间为毫秒数，如 {"max_attempts":3,"base_delay_ms":50,"max_delay_ms":2000,"budget_ms":10000}
+type RetryPolicy struct {
+	MaxAttempts int                                               // 最多执行次数，包含第一次，小于等于1时不重试
+	BaseDelay   time.Duration                                     // 第一次重试的等待时间
+	MaxDelay    time.Duration                                     // 单次等待的最大时间
+	Budget      time.Duration                                     // 单次调用包含重试的总耗时上限，为0时不限制
+	Retryable   func(error) bool                                  // 自定义可重试的判断，默认为 IsRetryableError
+	OnRetry     func(attempt int, err error, delay time.Duration) // 每次重试前回调，用于打印日志
+}
+
+// retryPolicyJson RetryPolicy 在配置文件中的格式
+type retryPolicyJson struct {
+	MaxAttempts int   `json:"max_attempts"`
+	BaseDelayMs int64 `json:"base_delay_ms"`
+	MaxDelayMs  int64 `json:"max_delay_ms"`
+	BudgetMs    int64 `json:"budget_ms"`
+}
+
+// MarshalJSON 时间转为毫秒数
+func (p RetryPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(retryPolicyJson{
+		MaxAttempts: p.MaxAttempts,
+		BaseDelayMs: p.BaseDelay.Milliseconds(),
+		MaxDelayMs:  p.MaxDelay.Milliseconds(),
+		BudgetMs:    p.Budget.Milliseconds(),
+	})
+}
+
+// UnmarshalJSON 时间为毫秒数
+func (p *RetryPolicy) UnmarshalJSON(data []byte) error {
+	var one retryPolicyJson
+	if err := json.Unmarshal(data, &one); err != nil {
+		return err
+	}
+	p.MaxAttempts = one.MaxAttempts
+	p.BaseDelay = time.Duration(one.BaseDelayMs) * time.Millisecond
+	p.MaxDelay = time.Duration(one.MaxDelayMs) * time.Millisecond
+	p.Budget = time.Duration(one.BudgetMs) * time.Millisecond
+	return nil
+}
+
+// DefaultRetryPolicy 默认的重试策略
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Budget:      10 * time.Second,
+}
+
+// MysqlErrorNumber 获取mysql的错误码
+func MysqlErrorNumber(err error) (uint16, bool) {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number, true
+	}
+	return 0, false
+}
+
+// IsRetryableError 是否是可以重试的错误：死锁、锁等待超时、连接断开、主从切换后的只读错误等
+// 只读事务中的写入错误(1792)重试也不会成功，不可重试
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if num, ok := MysqlErrorNumber(err); ok {
+		return RetryableErrorNumbers[num]
+	}
+	return IsConnectionError(err)
+}
+
+// IsDeadlockError 是否是死锁或锁等待超时的错误，这时事务已经回滚或需要回滚，可以整体重新执行
+func IsDeadlockError(err error) bool {
+	num, ok := MysqlErrorNumber(err)
+	return ok && (num == ErrNumDeadlock || num == ErrNumLockWaitTimeout)
+}
+
+// IsConnectionError 是否是连接断开的错误
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Retry 按重试策略执行，policy 为nil时使用 DefaultRetryPolicy
+func Retry(ctx context.Context, policy *RetryPolicy, fn func(ctx context.Context) error) error {
+	_, err := RetryValue(ctx, policy, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// RetryValue 按重试策略执行并返回结果
+func RetryValue[T any](ctx context.Context, policy *RetryPolicy, fn func(ctx context.Context) (T, error)) (T, error) {
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if policy.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Budget)
+		defer cancel()
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryableError
+	}
+
+	for attempt := 1; ; attempt++ {
+		ret, err := fn(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || !retryable(err) {
+			return ret, err
+		}
+
+		delay := policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return ret, fmt.Errorf("retry budget exhausted after %d attempts: %w", attempt, err)
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ret, fmt.Errorf("retry canceled after %d attempts: %w", attempt, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff 指数退避，使用 full jitter 避免多个调用同时重试
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(delay))) + 1
+}
+
+// MysqlExecRetry 执行变更语句，遇到可重试的错误时按策略重试，语句需要是幂等的
+func MysqlExecRetry(ctx context.Context, dbConn *sql.DB, policy *RetryPolicy, sqlQuery string, params ...any) (sql.Result, error) {
+	if sqlQuery == "" {
+		return nil, fmt.Errorf("执行语句不能为空")
+	}
+	return RetryValue(ctx, policy, func(ctx context.Context) (sql.Result, error) {
+		return MysqlExecContext(ctx, dbConn, sqlQuery, params...)
+	})
+}
+
+// MysqlQueryRetry 执行查询语句，遇到可重试的错误时按策略重试
+func MysqlQueryRetry(ctx context.Context, dbConn *sql.DB, policy *RetryPolicy, sqlQuery string, params ...any) ([]map[string]any, error) {
+	return RetryValue(ctx, policy, func(ctx context.Context) ([]map[string]any, error) {
+		return MysqlQueryContext(ctx, dbConn, sqlQuery, params...)
+	})
+}
@@ -0,0 +1,117 @@
+package sqlcomm_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1213}, true},
+		{fmt.Errorf("exec: %w", &mysql.MySQLError{Number: 1205}), true},
+		{&mysql.MySQLError{Number: 1290}, true},
+		{&mysql.MySQLError{Number: 1792}, false},
+		{&mysql.MySQLError{Number: 2013}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{driver.ErrBadConn, true},
+		{mysql.ErrInvalidConn, true},
+		{context.Canceled, false},
+		{errors.New("syntax error"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := sqlcomm.IsRetryableError(c.err); got != c.want {
+			t.Errorf("%v: got %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestIsDeadlockError(t *testing.T) {
+	if !sqlcomm.IsDeadlockError(fmt.Errorf("commit: %w", &mysql.MySQLError{Number: 1213})) {
+		t.Error("1213 should be deadlock")
+	}
+	if !sqlcomm.IsDeadlockError(&mysql.MySQLError{Number: 1205}) {
+		t.Error("1205 should be deadlock")
+	}
+	if sqlcomm.IsDeadlockError(driver.ErrBadConn) || sqlcomm.IsDeadlockError(&mysql.MySQLError{Number: 1062}) {
+		t.Error("should not be deadlock")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := &sqlcomm.RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+	}
+	attempts := 0
+	ret, err := sqlcomm.RetryValue(context.Background(), policy, func(context.Context) (int, error) {
+		attempts++
+		if attempts < 3 {
+			return 0, &mysql.MySQLError{Number: 1213}
+		}
+		return 10, nil
+	})
+	if err != nil || ret != 10 || attempts != 3 {
+		t.Error(ret, err, attempts)
+	}
+
+	attempts = 0
+	err = sqlcomm.Retry(context.Background(), policy, func(context.Context) error {
+		attempts++
+		return &mysql.MySQLError{Number: 1062}
+	})
+	if attempts != 1 || err == nil {
+		t.Error(attempts, err)
+	}
+
+	attempts = 0
+	err = sqlcomm.Retry(context.Background(), policy, func(context.Context) error {
+		attempts++
+		return driver.ErrBadConn
+	})
+	if attempts != 4 || !errors.Is(err, driver.ErrBadConn) {
+		t.Error(attempts, err)
+	}
+
+	attempts = 0
+	budgetPolicy := &sqlcomm.RetryPolicy{
+		MaxAttempts: 100,
+		BaseDelay:   20 * time.Millisecond,
+		MaxDelay:    20 * time.Millisecond,
+		Budget:      50 * time.Millisecond,
+	}
+	err = sqlcomm.Retry(context.Background(), budgetPolicy, func(context.Context) error {
+		attempts++
+		return driver.ErrBadConn
+	})
+	if attempts >= 100 || !errors.Is(err, driver.ErrBadConn) {
+		t.Error(attempts, err)
+	}
+}
+
+func TestRetryPolicyJson(t *testing.T) {
+	policy := new(sqlcomm.RetryPolicy)
+	err := json.Unmarshal([]byte(`{"max_attempts":3,"base_delay_ms":50,"max_delay_ms":2000,"budget_ms":10000}`), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MaxAttempts != 3 || policy.BaseDelay != 50*time.Millisecond || policy.MaxDelay != 2*time.Second ||
+		policy.Budget != 10*time.Second {
+		t.Errorf("%+v", policy)
+	}
+	data, err := json.Marshal(policy)
+	if err != nil || string(data) != `{"max_attempts":3,"base_delay_ms":50,"max_delay_ms":2000,"budget_ms":10000}` {
+		t.Error(string(data), err)
+	}
+}
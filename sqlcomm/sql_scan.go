@@ -0,0 +1,410 @@
+package sqlcomm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/go-plat-utils/utils"
+	"github.com/shopspring/decimal"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	scannerType    = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType       = reflect.TypeOf(time.Time{})
+	decimalType    = reflect.TypeOf(decimal.Decimal{})
+	bytesType      = reflect.TypeOf([]byte{})
+	scanFieldCache sync.Map // scanCacheKey -> map[string][]int
+
+	// scanBaseTypes 基础类型先转为对应的通用类型，再转为字段的类型，兼容 type Status int 这种自定义类型
+	scanBaseTypes = map[reflect.Kind]reflect.Type{
+		reflect.String:  reflect.TypeOf(""),
+		reflect.Bool:    reflect.TypeOf(true),
+		reflect.Int:     reflect.TypeOf(int64(0)),
+		reflect.Int8:    reflect.TypeOf(int64(0)),
+		reflect.Int16:   reflect.TypeOf(int64(0)),
+		reflect.Int32:   reflect.TypeOf(int64(0)),
+		reflect.Int64:   reflect.TypeOf(int64(0)),
+		reflect.Uint:    reflect.TypeOf(uint64(0)),
+		reflect.Uint8:   reflect.TypeOf(uint64(0)),
+		reflect.Uint16:  reflect.TypeOf(uint64(0)),
+		reflect.Uint32:  reflect.TypeOf(uint64(0)),
+		reflect.Uint64:  reflect.TypeOf(uint64(0)),
+		reflect.Float32: reflect.TypeOf(float64(0)),
+		reflect.Float64: reflect.TypeOf(float64(0)),
+	}
+)
+
+type scanCacheKey struct {
+	typ         reflect.Type
+	convertType utils.VariableType
+	tagNames    string
+}
+
+type scanConfig struct {
+	convertType utils.VariableType
+	tagNames    []string
+}
+
+// ScanOption 查询结果转结构体的配置
+type ScanOption func(*scanConfig)
+
+// WithScanTagNames 设置字段tag，按顺序查找，都没有时按 convertType 转换字段名，与 sqlstatement.StructToColumnsAndValues 一致
+// 默认不使用tag，与 sqlstatement.SqlStruct 没有设置 SetColumnTagName 时一致
+func WithScanTagNames(tagNames ...string) ScanOption {
+	return func(c *scanConfig) {
+		c.tagNames = tagNames
+	}
+}
+
+// WithScanConvertType 设置没有tag时字段名的转换方式，默认为 utils.Snake
+func WithScanConvertType(convertType utils.VariableType) ScanOption {
+	return func(c *scanConfig) {
+		c.convertType = convertType
+	}
+}
+
+func newScanConfig(opts ...ScanOption) *scanConfig {
+	c := &scanConfig{
+		convertType: utils.Snake,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// splitScanOptions 从参数中取出 ScanOption，ScanOption 不会是sql的参数
+func splitScanOptions(params []any) ([]any, []ScanOption) {
+	var opts []ScanOption
+	sqlParams := make([]any, 0, len(params))
+	for _, one := range params {
+		if opt, ok := one.(ScanOption); ok {
+			opts = append(opts, opt)
+			continue
+		}
+		sqlParams = append(sqlParams, one)
+	}
+	return sqlParams, opts
+}
+
+// QueryInto 执行查询语句，并将结果转换为 []T，T 可以是结构体、结构体指针或单列的基础类型
+// params 中可以传入 ScanOption，如 WithScanTagNames("db")，不作为sql的参数
+func QueryInto[T any](dbConn *sql.DB, sqlQuery string, params ...any) ([]T, error) {
+	params, opts := splitScanOptions(params)
+	_, rows, done, err := queryRows(context.Background(), dbConn, sqlQuery, params...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ScanRowsInto[T](rows, opts...)
+	closeRows(rows)
+	if err != nil {
+		done(-1, err)
+		return nil, fmt.Errorf("将查询结果转换为结构体失败: %w", err)
+	}
+	done(int64(len(result)), nil)
+	return result, nil
+}
+
+// QueryOne 执行查询语句，返回第一条记录，没有记录时返回 false，params 与 QueryInto 一致
+func QueryOne[T any](dbConn *sql.DB, sqlQuery string, params ...any) (T, bool, error) {
+	var zero T
+	list, err := QueryInto[T](dbConn, sqlQuery, params...)
+	if err != nil {
+		return zero, false, err
+	}
+	if len(list) == 0 {
+		return zero, false, nil
+	}
+	return list[0], true, nil
+}
+
+// ScanRowsInto 将sql.Rows转换为[]T
+func ScanRowsInto[T any](rows *sql.Rows, opts ...ScanOption) ([]T, error) {
+	result := make([]T, 0)
+	for one, err := range ScanRowsIter[T](context.Background(), rows, opts...) {
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, one)
+	}
+	return result, nil
+}
+
+// rowScanner 将一行数据转换为T，列与字段的对应关系只计算一次
+type rowScanner[T any] struct {
+	columns  []string
+	elemType reflect.Type
+	isPtr    bool
+	indexes  [][]int // 每一列对应的字段，nil表示没有对应字段；非结构体时为nil
+}
+
+func newRowScanner[T any](columns []string, c *scanConfig) (*rowScanner[T], error) {
+	var zero T
+	targetType := reflect.TypeOf(zero)
+	if targetType == nil {
+		return nil, fmt.Errorf("unsupported scan type: %T", zero)
+	}
+	rs := &rowScanner[T]{
+		columns:  columns,
+		elemType: targetType,
+		isPtr:    targetType.Kind() == reflect.Ptr,
+	}
+	if rs.isPtr {
+		rs.elemType = targetType.Elem()
+	}
+
+	if !isScanStruct(rs.elemType) {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("scan into %s need one column, got %d", rs.elemType.String(), len(columns))
+		}
+		return rs, nil
+	}
+	fieldMap := getScanFieldMap(rs.elemType, c)
+	rs.indexes = make([][]int, len(columns))
+	for i, colName := range columns {
+		index, ok := fieldMap[colName]
+		if !ok {
+			index = fieldMap[strings.ToLower(colName)]
+		}
+		rs.indexes[i] = index
+	}
+	return rs, nil
+}
+
+func (rs *rowScanner[T]) scan(values []any) (T, error) {
+	var zero T
+	oneValue := reflect.New(rs.elemType).Elem()
+	if rs.indexes == nil {
+		if err := assignScanValue(oneValue, values[0]); err != nil {
+			return zero, fmt.Errorf("column %s: %w", rs.columns[0], err)
+		}
+	} else {
+		for i, index := range rs.indexes {
+			if index == nil {
+				continue
+			}
+			if err := assignScanValue(fieldByIndexAlloc(oneValue, index), values[i]); err != nil {
+				return zero, fmt.Errorf("column %s: %w", rs.columns[i], err)
+			}
+		}
+	}
+	if rs.isPtr {
+		return oneValue.Addr().Interface().(T), nil
+	}
+	return oneValue.Interface().(T), nil
+}
+
+// isScanStruct 是否按字段映射，time.Time、decimal.Decimal、sql.NullXXX 等作为单个值处理
+func isScanStruct(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+	if typ == timeType || typ == decimalType {
+		return false
+	}
+	return !reflect.PointerTo(typ).Implements(scannerType)
+}
+
+// getScanFieldMap 获取列名与字段的对应关系，匿名结构体字段会展开
+func getScanFieldMap(typ reflect.Type, c *scanConfig) map[string][]int {
+	key := scanCacheKey{typ: typ, convertType: c.convertType, tagNames: strings.Join(c.tagNames, ",")}
+	if cached, ok := scanFieldCache.Load(key); ok {
+		return cached.(map[string][]int)
+	}
+	fieldMap := make(map[string][]int)
+	buildScanFieldMap(typ, nil, c, fieldMap)
+	scanFieldCache.Store(key, fieldMap)
+	return fieldMap
+}
+
+func buildScanFieldMap(typ reflect.Type, parentIndex []int, c *scanConfig, fieldMap map[string][]int) {
+	for i := 0; i < typ.NumField(); i++ {
+		fi := typ.Field(i)
+		if !fi.IsExported() {
+			continue
+		}
+		index := append(append([]int{}, parentIndex...), i)
+		column, hasTag := getScanColumnName(fi, c)
+		if column == "" {
+			continue
+		}
+		if fi.Anonymous && !hasTag {
+			fieldType := fi.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if isScanStruct(fieldType) {
+				buildScanFieldMap(fieldType, index, c, fieldMap)
+				continue
+			}
+		}
+		//外层的字段优先
+		if _, ok := fieldMap[column]; !ok || len(fieldMap[column]) > len(index) {
+			fieldMap[column] = index
+		}
+	}
+}
+
+// getScanColumnName 与 utils.GetFieldListByTag 的规则一致，tag为-时忽略
+func getScanColumnName(fi reflect.StructField, c *scanConfig) (string, bool) {
+	for _, tagName := range c.tagNames {
+		tagName = strings.TrimSpace(tagName)
+		if tagName == "" {
+			continue
+		}
+		tagV := strings.TrimSpace(strings.Split(fi.Tag.Get(tagName), ",")[0])
+		if tagV == "-" {
+			return "", true
+		}
+		if tagV != "" {
+			return tagV, true
+		}
+	}
+	return utils.VarNameConverter(fi.Name, c.convertType), false
+}
+
+// fieldByIndexAlloc 获取嵌套字段，匿名结构体指针为nil时自动创建
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// assignScanValue 将数据库的值赋给字段
+func assignScanValue(field reflect.Value, src any) error {
+	if src == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	fieldType := field.Type()
+
+	if fieldType.Kind() == reflect.Ptr && !fieldType.Implements(scannerType) {
+		elem := reflect.New(fieldType.Elem())
+		if err := assignScanValue(elem.Elem(), src); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if field.CanAddr() && field.Addr().Type().Implements(scannerType) {
+		if fieldType == reflect.TypeOf(sql.NullTime{}) {
+			t, err := scanTime(src)
+			if err != nil {
+				return err
+			}
+			src = t
+		}
+		return field.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+
+	switch {
+	case fieldType == timeType:
+		t, err := scanTime(src)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	case fieldType == bytesType:
+		if b, ok := src.([]byte); ok {
+			field.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+		field.SetBytes([]byte(conv.String(src)))
+		return nil
+	case fieldType.Kind() == reflect.Struct, fieldType.Kind() == reflect.Map,
+		fieldType.Kind() == reflect.Slice, fieldType.Kind() == reflect.Array:
+		// JSON 字段
+		var data []byte
+		switch v := src.(type) {
+		case []byte:
+			data = v
+		case string:
+			data = []byte(v)
+		default:
+			return fmt.Errorf("can not scan %T into %s", src, fieldType.String())
+		}
+		if len(data) == 0 {
+			field.Set(reflect.Zero(fieldType))
+			return nil
+		}
+		return json.Unmarshal(data, field.Addr().Interface())
+	case fieldType.Kind() == reflect.Bool:
+		if b, ok := src.([]byte); ok && len(b) == 1 && !isPrintableASCII(b) {
+			field.SetBool(bitToBool(b)) // BIT(1)
+			return nil
+		}
+	case fieldType.Kind() == reflect.Interface:
+		if b, ok := src.([]byte); ok {
+			src = string(b)
+		}
+		field.Set(reflect.ValueOf(src))
+		return nil
+	}
+
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+	baseType, ok := scanBaseTypes[fieldType.Kind()]
+	if !ok {
+		return fmt.Errorf("can not scan %T into %s", src, fieldType.String())
+	}
+	ret, err := conv.ConvertForType(baseType, src)
+	if err != nil {
+		return err
+	}
+	retValue := reflect.ValueOf(ret)
+	if scanOverflow(field, retValue) {
+		return fmt.Errorf("value %v overflows %s", ret, fieldType.String())
+	}
+	field.Set(retValue.Convert(fieldType))
+	return nil
+}
+
+// scanOverflow 数值是否超出字段类型的范围
+func scanOverflow(field reflect.Value, retValue reflect.Value) bool {
+	switch retValue.Kind() {
+	case reflect.Int64:
+		return field.OverflowInt(retValue.Int())
+	case reflect.Uint64:
+		return field.OverflowUint(retValue.Uint())
+	case reflect.Float64:
+		return field.OverflowFloat(retValue.Float())
+	default:
+		return false
+	}
+}
+
+// scanTime 将数据库返回的时间转为time.Time，未设置parseTime时返回的是[]byte
+func scanTime(src any) (time.Time, error) {
+	switch v := src.(type) {
+	case time.Time:
+		return v, nil
+	case []byte:
+		src = string(v)
+	}
+	str := conv.String(src)
+	if str == "" || strings.HasPrefix(str, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04:05.999999", time.DateOnly, time.RFC3339Nano} {
+		if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return conv.Convert[time.Time](src)
+}
@@ -0,0 +1,240 @@
+package sqlcomm_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"github.com/shopspring/decimal"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDriver 返回固定结果的驱动，用于测试查询结果转换
+type fakeDriver struct {
+	columns []string
+	types   []string
+	rows    [][]driver.Value
+}
+
+type fakeConn struct{ d *fakeDriver }
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+type fakeRows struct {
+	d   *fakeDriver
+	pos int
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d: d}, nil }
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{d: c.d, query: query}, nil
+}
+func (c *fakeConn) Close() error                               { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                  { return nil, io.EOF }
+func (s *fakeStmt) Close() error                               { return nil }
+func (s *fakeStmt) NumInput() int                              { return -1 }
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) { return nil, io.EOF }
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.query == "SELECT DATABASE()" {
+		return &fakeRows{d: &fakeDriver{columns: []string{"DATABASE()"}, rows: [][]driver.Value{{[]byte("test")}}}}, nil
+	}
+	return &fakeRows{d: s.d}, nil
+}
+func (r *fakeRows) Columns() []string { return r.d.columns }
+func (r *fakeRows) ColumnTypeDatabaseTypeName(i int) string {
+	if i < len(r.d.types) {
+		return r.d.types[i]
+	}
+	return ""
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.d.rows) {
+		return io.EOF
+	}
+	copy(dest, r.d.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+type BaseModel struct {
+	Id        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type ScanUser struct {
+	BaseModel
+	Name    string            `db:"name"`
+	Nick    *string           `db:"nick"`
+	Remark  sql.NullString    `db:"remark"`
+	Amount  decimal.Decimal   `db:"amount"`
+	Extra   map[string]string `db:"extra"`
+	Enabled bool              `db:"enabled"`
+	Ignore  string            `db:"-"`
+	UserAge int
+}
+
+func TestQueryInto(t *testing.T) {
+	sql.Register("sqlcomm_fake", &fakeDriver{
+		columns: []string{"id", "created_at", "name", "nick", "remark", "amount", "extra", "enabled", "user_age", "Ignore"},
+		rows: [][]driver.Value{
+			{int64(1), []byte("2024-01-02 03:04:05"), []byte("tom"), []byte("t"), nil, []byte("12.345"), []byte(`{"a":"b"}`), []byte{1}, int64(18), []byte("x")},
+			{int64(2), nil, []byte("jack"), nil, []byte("r"), []byte("0.1"), nil, []byte{0}, nil, nil},
+		},
+	})
+	db, err := sql.Open("sqlcomm_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := sqlcomm.QueryInto[ScanUser](db, "select * from user", sqlcomm.WithScanTagNames("db"))
+	if err != nil || len(list) != 2 {
+		t.Fatal(list, err)
+	}
+	one := list[0]
+	if one.Id != 1 || one.Name != "tom" || one.Nick == nil || *one.Nick != "t" || one.Remark.Valid ||
+		one.Amount.String() != "12.345" || one.Extra["a"] != "b" || !one.Enabled || one.UserAge != 18 || one.Ignore != "" ||
+		one.CreatedAt.Format(time.DateTime) != "2024-01-02 03:04:05" {
+		t.Errorf("%+v", one)
+	}
+	two := list[1]
+	if two.Nick != nil || two.Remark.String != "r" || two.Extra != nil || two.Enabled || !two.CreatedAt.IsZero() {
+		t.Errorf("%+v", two)
+	}
+
+	ptr, ok, err := sqlcomm.QueryOne[*ScanUser](db, "select * from user", sqlcomm.WithScanTagNames("db"))
+	if err != nil || !ok || ptr.Id != 1 || ptr.Ignore != "" {
+		t.Error(ptr, ok, err)
+	}
+
+	// 默认不使用tag，与 SqlStruct 一致按字段名转换
+	ptr, ok, err = sqlcomm.QueryOne[*ScanUser](db, "select * from user")
+	if err != nil || !ok || ptr.Id != 1 || ptr.Name != "tom" || ptr.Ignore != "x" {
+		t.Error(ptr, ok, err)
+	}
+}
+
+func TestQueryIter(t *testing.T) {
+	sql.Register("sqlcomm_fake_iter", &fakeDriver{
+		columns: []string{"id", "name"},
+		rows: [][]driver.Value{
+			{int64(1), []byte("tom")},
+			{int64(2), []byte("jack")},
+			{int64(3), []byte("lucy")},
+		},
+	})
+	db, err := sql.Open("sqlcomm_fake_iter", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audits := make(map[string]*sqlcomm.SqlAudit)
+	sqlcomm.AddAuditHook(func(audit *sqlcomm.SqlAudit) {
+		if strings.HasPrefix(audit.Sql, "select ") && strings.HasSuffix(audit.Sql, " from user") {
+			audits[audit.Sql] = audit
+		}
+	})
+
+	names := make([]any, 0)
+	for row, err := range sqlcomm.MysqlQueryIter(context.Background(), db, "select * from user") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, row["name"])
+	}
+	if len(names) != 3 || names[2] != "lucy" {
+		t.Error(names)
+	}
+	if one := audits["select * from user"]; one == nil || one.RowsAffected != 3 || one.Err != nil || one.Database != "test" {
+		t.Errorf("streamed query should be audited: %+v", one)
+	}
+
+	ids := make([]int64, 0)
+	for id, err := range sqlcomm.QueryIter[int64](context.Background(), db, "select id from user") {
+		if err == nil {
+			t.Fatal("need one column")
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 1 {
+		t.Error(ids)
+	}
+	if one := audits["select id from user"]; one == nil || one.Err == nil {
+		t.Errorf("scan error should be audited: %+v", one)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	for _, err = range sqlcomm.QueryIter[ScanUser](ctx, db, "select * from user") {
+		if err != nil {
+			break
+		}
+		count++
+		cancel()
+	}
+	if count != 1 || !errors.Is(err, context.Canceled) {
+		t.Error(count, err)
+	}
+}
+
+func TestMysqlColumnRowsToMaps(t *testing.T) {
+	sql.Register("sqlcomm_fake_types", &fakeDriver{
+		columns: []string{"id", "big", "amount", "data", "extra", "created_at", "flag", "name", "geo"},
+		types:   []string{"INT", "UNSIGNED BIGINT", "DECIMAL", "BLOB", "JSON", "DATETIME", "BIT", "VARCHAR", "GEOMETRY"},
+		rows: [][]driver.Value{
+			{[]byte("1"), []byte("18446744073709551615"), []byte("12.30"), []byte{0, 1}, []byte(`{"a":1}`),
+				[]byte("2024-01-02 03:04:05"), []byte{1}, []byte("tom"), []byte{0xe6, 0x10, 0, 0, 1}},
+		},
+	})
+	db, err := sql.Open("sqlcomm_fake_types", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := sqlcomm.MysqlQuery(db, "select * from user")
+	if err != nil || len(list) != 1 {
+		t.Fatal(list, err)
+	}
+	row := list[0]
+	if row["id"] != int64(1) || row["big"] != uint64(18446744073709551615) || row["flag"] != uint64(1) || row["name"] != "tom" {
+		t.Error(row)
+	}
+	if d, ok := row["amount"].(decimal.Decimal); !ok || d.String() != "12.3" {
+		t.Error(row["amount"])
+	}
+	if b, ok := row["data"].([]byte); !ok || len(b) != 2 {
+		t.Error(row["data"])
+	}
+	if j, ok := row["extra"].(json.RawMessage); !ok || string(j) != `{"a":1}` {
+		t.Error(row["extra"])
+	}
+	if tm, ok := row["created_at"].(time.Time); !ok || tm.Location() != time.Local || tm.Format(time.DateTime) != "2024-01-02 03:04:05" {
+		t.Error(row["created_at"])
+	}
+	if g, ok := row["geo"].(sqlcomm.MysqlGeometry); !ok || g.SRID != 4326 || len(g.WKB) != 1 {
+		t.Error(row["geo"])
+	}
+
+	registry := sqlcomm.DefaultColumnConverters.Clone().
+		RegisterColumn("flag", sqlcomm.BitToBoolConverter).
+		RegisterType("decimal", func(val any, _ *sql.ColumnType) (any, error) {
+			return string(val.([]byte)), nil
+		}).
+		SetLocation(time.UTC)
+	rows, err := db.Query("select * from user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+	list, err = sqlcomm.MysqlColumnRowsToMaps(rows, registry)
+	if err != nil || list[0]["flag"] != true || list[0]["amount"] != "12.30" ||
+		list[0]["created_at"].(time.Time).Location() != time.UTC {
+		t.Error(list, err)
+	}
+}
@@ -0,0 +1,90 @@
+package sqlcomm
+
+import (
+	"strings"
+)
+
+// SplitSqlStatements 将多条语句拆分为单条，忽略引号和注释中的分号，
+// 支持客户端的 DELIMITER 命令，用于存储过程和触发器
+func SplitSqlStatements(sqlText string) []string {
+	var ret []string
+	delimiter := ";"
+	var b strings.Builder
+	flush := func() {
+		if one := strings.TrimSpace(b.String()); one != "" {
+			ret = append(ret, one)
+		}
+		b.Reset()
+	}
+	n := len(sqlText)
+	lineStart := true
+	for i := 0; i < n; {
+		c := sqlText[i]
+		// DELIMITER 只能在行首
+		if lineStart {
+			j := i
+			for j < n && (sqlText[j] == ' ' || sqlText[j] == '\t') {
+				j++
+			}
+			if j+10 <= n && strings.EqualFold(sqlText[j:j+9], "DELIMITER") && (sqlText[j+9] == ' ' || sqlText[j+9] == '\t') {
+				end := strings.IndexByte(sqlText[j:], '\n')
+				if end < 0 {
+					end = n - j
+				}
+				if newDelimiter := strings.TrimSpace(sqlText[j+10 : j+end]); newDelimiter != "" {
+					flush()
+					delimiter = newDelimiter
+				}
+				i = j + end
+				continue
+			}
+		}
+		lineStart = c == '\n'
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < n {
+				if sqlText[j] == '\\' && c != '`' {
+					j += 2
+					continue
+				}
+				if sqlText[j] == c {
+					if j+1 < n && sqlText[j+1] == c { //两个引号为转义
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			end := min(j+1, n)
+			b.WriteString(sqlText[i:end])
+			i = end
+		case c == '/' && i+1 < n && sqlText[i+1] == '*':
+			end := strings.Index(sqlText[i+2:], "*/")
+			if end < 0 {
+				end = n
+			} else {
+				end += i + 4
+			}
+			b.WriteString(sqlText[i:end])
+			i = end
+		case c == '#' || (c == '-' && i+2 < n && sqlText[i+1] == '-' && (sqlText[i+2] == ' ' || sqlText[i+2] == '\t' || sqlText[i+2] == '\n')):
+			// 单行注释不保留
+			end := strings.IndexByte(sqlText[i:], '\n')
+			if end < 0 {
+				i = n
+			} else {
+				i += end
+			}
+		case strings.HasPrefix(sqlText[i:], delimiter):
+			flush()
+			i += len(delimiter)
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+	return ret
+}
@@ -0,0 +1,32 @@
+package sqlcomm_test
+
+import (
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSqlStatements(t *testing.T) {
+	sqlText := `-- create user
+CREATE TABLE user (id INT, name VARCHAR(10) DEFAULT ';'); # comment;
+INSERT INTO user VALUES (1, 'a\';b'), (2, "c;d");
+/* block; comment */ UPDATE user SET name = 'it''s;' WHERE id = 1;;
+DELIMITER $$
+CREATE TRIGGER t BEFORE INSERT ON user FOR EACH ROW BEGIN SET NEW.id = 1; END$$
+DELIMITER ;
+SELECT 1`
+	want := []string{
+		"CREATE TABLE user (id INT, name VARCHAR(10) DEFAULT ';')",
+		`INSERT INTO user VALUES (1, 'a\';b'), (2, "c;d")`,
+		"/* block; comment */ UPDATE user SET name = 'it''s;' WHERE id = 1",
+		"CREATE TRIGGER t BEFORE INSERT ON user FOR EACH ROW BEGIN SET NEW.id = 1; END",
+		"SELECT 1",
+	}
+	got := sqlcomm.SplitSqlStatements(sqlText)
+	if !reflect.DeepEqual(got, want) {
+		for _, one := range got {
+			t.Logf("%q", one)
+		}
+		t.Error("split error")
+	}
+}
@@ -0,0 +1,181 @@
+package sqlcomm
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStatsMaxFingerprints = 1000
+	statsLatencySamples         = 256
+)
+
+// SqlStatSnapshot 一类语句的统计结果
+type SqlStatSnapshot struct {
+	Database    string        `json:"database,omitempty"`
+	Digest      string        `json:"digest"`
+	Fingerprint string        `json:"fingerprint"`
+	Count       int64         `json:"count"`
+	Errors      int64         `json:"errors"`
+	Rows        int64         `json:"rows"` // 返回或影响的行数之和
+	TotalTime   time.Duration `json:"total_time"`
+	AvgTime     time.Duration `json:"avg_time"`
+	P99Time     time.Duration `json:"p99_time"` // 由最近的耗时样本计算
+	MaxTime     time.Duration `json:"max_time"`
+	FirstSeen   time.Time     `json:"first_seen"`
+	LastSeen    time.Time     `json:"last_seen"`
+}
+
+type sqlStat struct {
+	snapshot SqlStatSnapshot
+	samples  []time.Duration
+	next     int
+}
+
+// SqlStatsTable 按数据库和指纹统计语句的执行情况，并发安全
+type SqlStatsTable struct {
+	lock            sync.Mutex
+	maxFingerprints int
+	stats           map[string]*sqlStat
+	dropped         int64
+}
+
+// DefaultSqlStats 全局的语句统计，AuditConfig.Stats 打开时审计的语句都会记录
+var DefaultSqlStats = NewSqlStatsTable(defaultStatsMaxFingerprints)
+
+// NewSqlStatsTable 新建统计表，maxFingerprints 为最多记录的指纹数，超过后新的指纹不再记录
+func NewSqlStatsTable(maxFingerprints int) *SqlStatsTable {
+	if maxFingerprints <= 0 {
+		maxFingerprints = defaultStatsMaxFingerprints
+	}
+	return &SqlStatsTable{
+		maxFingerprints: maxFingerprints,
+		stats:           make(map[string]*sqlStat),
+	}
+}
+
+func statsKey(database, digest string) string {
+	return database + "/" + digest
+}
+
+// Record 记录一条语句的执行，可直接作为 SqlAuditHook 使用
+func (t *SqlStatsTable) Record(audit *SqlAudit) {
+	if t == nil || audit == nil {
+		return
+	}
+	fingerprint := audit.Fingerprint
+	if fingerprint == "" {
+		fingerprint = SqlFingerprint(audit.Sql)
+	}
+	digest := FingerprintDigest(fingerprint)
+	key := statsKey(audit.Database, digest)
+	now := time.Now()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	one, ok := t.stats[key]
+	if !ok {
+		if len(t.stats) >= t.maxFingerprints {
+			t.dropped++
+			return
+		}
+		one = &sqlStat{
+			snapshot: SqlStatSnapshot{
+				Database:    audit.Database,
+				Digest:      digest,
+				Fingerprint: fingerprint,
+				FirstSeen:   now,
+			},
+		}
+		t.stats[key] = one
+	}
+	s := &one.snapshot
+	s.Count++
+	if audit.Err != nil {
+		s.Errors++
+	}
+	if audit.RowsAffected > 0 {
+		s.Rows += audit.RowsAffected
+	}
+	s.TotalTime += audit.Duration
+	if audit.Duration > s.MaxTime {
+		s.MaxTime = audit.Duration
+	}
+	s.LastSeen = now
+	if len(one.samples) < statsLatencySamples {
+		one.samples = append(one.samples, audit.Duration)
+	} else {
+		one.samples[one.next] = audit.Duration
+		one.next = (one.next + 1) % statsLatencySamples
+	}
+}
+
+func (s *sqlStat) result() SqlStatSnapshot {
+	ret := s.snapshot
+	if ret.Count > 0 {
+		ret.AvgTime = ret.TotalTime / time.Duration(ret.Count)
+	}
+	if len(s.samples) > 0 {
+		samples := make([]time.Duration, len(s.samples))
+		copy(samples, s.samples)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		index := (len(samples)*99+99)/100 - 1
+		ret.P99Time = samples[index]
+	}
+	return ret
+}
+
+// Snapshot 所有统计结果，按总耗时倒序
+func (t *SqlStatsTable) Snapshot() []SqlStatSnapshot {
+	t.lock.Lock()
+	ret := make([]SqlStatSnapshot, 0, len(t.stats))
+	for _, one := range t.stats {
+		ret = append(ret, one.result())
+	}
+	t.lock.Unlock()
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].TotalTime != ret[j].TotalTime {
+			return ret[i].TotalTime > ret[j].TotalTime
+		}
+		return ret[i].Digest < ret[j].Digest
+	})
+	return ret
+}
+
+// Get 获取某个库中某条语句的统计，sqlQuery 可以是原始语句或指纹
+func (t *SqlStatsTable) Get(database string, sqlQuery string) (SqlStatSnapshot, bool) {
+	key := statsKey(database, SqlDigest(sqlQuery))
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	one, ok := t.stats[key]
+	if !ok {
+		return SqlStatSnapshot{}, false
+	}
+	return one.result(), true
+}
+
+// Dropped 超过指纹数上限而未记录的次数
+func (t *SqlStatsTable) Dropped() int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.dropped
+}
+
+// Reset 清空统计
+func (t *SqlStatsTable) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.stats = make(map[string]*sqlStat)
+	t.dropped = 0
+}
+
+// DumpJson 以json输出所有统计结果
+func (t *SqlStatsTable) DumpJson() (string, error) {
+	content, err := json.Marshal(t.Snapshot())
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
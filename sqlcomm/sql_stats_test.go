@@ -0,0 +1,87 @@
+package sqlcomm_test
+
+import (
+	"errors"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSqlFingerprint(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM `User` WHERE id = 10 AND name='a''b'":                    "select * from `User` where id = ? and name=?",
+		"select *  from user\n where id IN (1, 2,3) /* hint */ and t1.c2 > 1.5": "select * from user where id in (?+) and t1.c2 > ?",
+		"SELECT * FROM user WHERE id IN (?,?)":                                  "select * from user where id in (?+)",
+		"INSERT INTO t (a, b) VALUES (1, 'x'), (2, \"y\") -- tail":              "insert into t (a, b) values (?+)",
+		"UPDATE t SET v = 0xFF, s = 'it\\'s' # comment":                         "update t set v = ?, s = ?",
+	}
+	for in, want := range cases {
+		if got := sqlcomm.SqlFingerprint(in); got != want {
+			t.Errorf("%q: got %q, want %q", in, got, want)
+		}
+	}
+	if sqlcomm.SqlDigest("SELECT 1 FROM t WHERE id IN (1,2)") != sqlcomm.SqlDigest("select 1 from t where id in (3, 4, 5)") {
+		t.Error("same structure should have same digest")
+	}
+}
+
+func TestSqlStatsTable(t *testing.T) {
+	table := sqlcomm.NewSqlStatsTable(2)
+	for i := 1; i <= 100; i++ {
+		table.Record(&sqlcomm.SqlAudit{
+			Database:     "db",
+			Sql:          "SELECT * FROM user WHERE id = ?",
+			Duration:     time.Duration(i) * time.Millisecond,
+			RowsAffected: 1,
+		})
+	}
+	table.Record(&sqlcomm.SqlAudit{Database: "db", Sql: "UPDATE user SET a = 1", Err: errors.New("x"), RowsAffected: -1})
+	table.Record(&sqlcomm.SqlAudit{Database: "db", Sql: "DELETE FROM user"})
+
+	one, ok := table.Get("db", "select * from user where id = 5")
+	if !ok {
+		t.Fatal("stat not found")
+	}
+	if one.Count != 100 || one.Rows != 100 || one.Errors != 0 || one.MaxTime != 100*time.Millisecond ||
+		one.AvgTime != 50500*time.Microsecond || one.P99Time != 99*time.Millisecond {
+		t.Errorf("%+v", one)
+	}
+	list := table.Snapshot()
+	if len(list) != 2 || list[0].Digest != one.Digest || list[1].Errors != 1 || list[1].Rows != 0 {
+		t.Errorf("%+v", list)
+	}
+	if table.Dropped() != 1 {
+		t.Error(table.Dropped())
+	}
+	content, err := table.DumpJson()
+	if err != nil || !strings.Contains(content, `"fingerprint":"update user set a = ?"`) {
+		t.Error(content, err)
+	}
+	table.Reset()
+	if len(table.Snapshot()) != 0 {
+		t.Error("reset failed")
+	}
+}
+
+func TestAuditSqlStats(t *testing.T) {
+	oldCfg := sqlcomm.GetAuditConfig()
+	defer sqlcomm.SetAuditConfig(oldCfg)
+	sqlcomm.DefaultSqlStats.Reset()
+	defer sqlcomm.DefaultSqlStats.Reset()
+
+	sqlStr := "SELECT * FROM stats_opt_in WHERE id = ?"
+	sqlcomm.AuditSql(&sqlcomm.SqlAudit{Database: "db", Sql: sqlStr, RowsAffected: 2}, nil)
+	if _, ok := sqlcomm.DefaultSqlStats.Get("db", sqlStr); ok {
+		t.Error("stats should be off by default")
+	}
+
+	cfg := sqlcomm.DefaultAuditConfig
+	cfg.Stats = true
+	sqlcomm.SetAuditConfig(cfg)
+	sqlcomm.AuditSql(&sqlcomm.SqlAudit{Database: "db", Sql: sqlStr, RowsAffected: 2}, nil)
+	one, ok := sqlcomm.DefaultSqlStats.Get("db", sqlStr)
+	if !ok || one.Count != 1 || one.Rows != 2 {
+		t.Errorf("%+v %v", one, ok)
+	}
+}
@@ -0,0 +1,120 @@
+package sqlcomm
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// TracerName 本库使用的tracer名称
+const TracerName = "github.com/magic-lib/go-plat-mysql"
+
+// span 的属性，遵循 db.* 语义约定
+const (
+	AttrDbSystem       = attribute.Key("db.system")
+	AttrDbName         = attribute.Key("db.name")
+	AttrDbStatement    = attribute.Key("db.statement") // 语句的指纹，不包含参数
+	AttrDbOperation    = attribute.Key("db.operation")
+	AttrDbSqlTable     = attribute.Key("db.sql.table")
+	AttrDbRowsAffected = attribute.Key("db.rows_affected")
+)
+
+var (
+	tracerLock     sync.RWMutex
+	tracerProvider trace.TracerProvider
+
+	sqlTableRegex = regexp.MustCompile("(?i)\\b(?:from|into|update|table)\\s+`?([\\w.]+)`?")
+)
+
+// SetTracerProvider 设置使用的TracerProvider，为nil时使用otel全局的
+func SetTracerProvider(tp trace.TracerProvider) {
+	tracerLock.Lock()
+	defer tracerLock.Unlock()
+	tracerProvider = tp
+}
+
+func tracer() trace.Tracer {
+	tracerLock.RLock()
+	tp := tracerProvider
+	tracerLock.RUnlock()
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(TracerName)
+}
+
+// StartSpan 开始一个span，ctx中有span时作为子span
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan 结束span，有错误时记录错误
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SqlSpanAttributes 语句对应的span属性
+func SqlSpanAttributes(sqlQuery string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		AttrDbSystem.String("mysql"),
+		AttrDbStatement.String(SqlFingerprint(sqlQuery)),
+	}
+	if operation := sqlOperation(sqlQuery); operation != "" {
+		attrs = append(attrs, AttrDbOperation.String(operation))
+	}
+	if table := SqlTableName(sqlQuery); table != "" {
+		attrs = append(attrs, AttrDbSqlTable.String(table))
+	}
+	return attrs
+}
+
+// StartSqlSpan 执行语句前开始span，dbName 可以为空
+func StartSqlSpan(ctx context.Context, dbName string, sqlQuery string) (context.Context, trace.Span) {
+	attrs := SqlSpanAttributes(sqlQuery)
+	if dbName != "" {
+		attrs = append(attrs, AttrDbName.String(dbName))
+	}
+	name := "mysql"
+	if operation := sqlOperation(sqlQuery); operation != "" {
+		name += " " + operation
+	}
+	ctx, span := StartSpan(ctx, name, attrs...)
+	return ctx, span
+}
+
+// EndSqlSpan 语句执行后结束span，rowsAffected 小于0时不记录
+func EndSqlSpan(span trace.Span, rowsAffected int64, err error) {
+	if rowsAffected >= 0 {
+		span.SetAttributes(AttrDbRowsAffected.Int64(rowsAffected))
+	}
+	EndSpan(span, err)
+}
+
+// SqlTableName 语句中的第一个表名
+func SqlTableName(sqlQuery string) string {
+	match := sqlTableRegex.FindStringSubmatch(sqlQuery)
+	if len(match) != 2 {
+		return ""
+	}
+	return match[1]
+}
+
+func sqlOperation(sqlQuery string) string {
+	sqlQuery = strings.TrimSpace(sqlQuery)
+	if i := strings.IndexAny(sqlQuery, " \t\r\n("); i > 0 {
+		sqlQuery = sqlQuery[:i]
+	}
+	return strings.ToUpper(sqlQuery)
+}
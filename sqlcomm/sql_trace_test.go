@@ -0,0 +1,56 @@
+package sqlcomm_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestSqlSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	sqlcomm.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer sqlcomm.SetTracerProvider(nil)
+
+	sql.Register("sqlcomm_fake_trace", &fakeDriver{
+		columns: []string{"id"},
+		rows:    [][]driver.Value{{int64(1)}, {int64(2)}},
+	})
+	db, err := sql.Open("sqlcomm_fake_trace", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := sqlcomm.StartSpan(context.Background(), "http request")
+	if _, err = sqlcomm.MysqlQueryContext(ctx, db, "SELECT id FROM `user` WHERE name = 'tom'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sqlcomm.MysqlExecContext(ctx, db, "UPDATE user SET name = ? WHERE id = 1", "tom"); err == nil {
+		t.Fatal("fake exec should fail")
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatal(len(spans))
+	}
+	query, exec := spans[0], spans[1]
+	if query.Name() != "mysql SELECT" || query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error(query.Name(), query.Parent())
+	}
+	attrs := make(map[string]string)
+	for _, one := range query.Attributes() {
+		attrs[string(one.Key)] = one.Value.Emit()
+	}
+	if attrs["db.system"] != "mysql" || attrs["db.sql.table"] != "user" || attrs["db.rows_affected"] != "2" ||
+		attrs["db.statement"] != "select id from `user` where name = ?" {
+		t.Error(attrs)
+	}
+	if exec.Name() != "mysql UPDATE" || exec.Status().Code != codes.Error {
+		t.Error(exec.Name(), exec.Status())
+	}
+}
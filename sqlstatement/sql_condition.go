@@ -54,6 +54,11 @@ const (
 	OperatorGreaterEqual OperatorType = ">="
 	OperatorNotEqual     OperatorType = "!="
 	OperatorEqual        OperatorType = "="
+	OperatorJsonContains OperatorType = "JSON_CONTAINS" // JSON_CONTAINS(field, ?[, path])
+	OperatorJsonOverlaps OperatorType = "JSON_OVERLAPS" // JSON_OVERLAPS(field, ?)
+	OperatorJsonExtract  OperatorType = "JSON_EXTRACT"  // JSON_UNQUOTE(JSON_EXTRACT(field, path)) 与值比较，值需要为 JsonPathValue
+	OperatorMemberOf     OperatorType = "MEMBER OF"     // ? MEMBER OF(field)
+	OperatorMatch        OperatorType = "MATCH"         // MATCH(field1, field2) AGAINST(? mode)，值为字符串或 MatchValue
 )
 
 var (
@@ -72,6 +77,11 @@ var (
 		OperatorGreater,
 		OperatorLessEqual,
 		OperatorLess,
+		OperatorJsonContains,
+		OperatorJsonOverlaps,
+		OperatorJsonExtract,
+		OperatorMemberOf,
+		OperatorMatch,
 	} // 数据库支持的类型
 	logicOperatorList = []OperatorType{
 		OperatorAnd,
@@ -145,6 +155,11 @@ func (s *Statement) GetSqlColumnForLike(oldValue string) (retValLike string, ret
 
 // GenerateWhereClauseByMap 通过Map获取where语句
 func (s *Statement) GenerateWhereClauseByMap(whereMap map[string]any) (string, []any) {
+	return s.GenerateWhereClause(s.conditionByMap(whereMap))
+}
+
+// conditionByMap 将Map转为AND关系的条件
+func (s *Statement) conditionByMap(whereMap map[string]any) LogicCondition {
 	oneLogicCondition := LogicCondition{
 		Conditions: make([]ICondition, 0),
 		Operator:   defaultLogicOperator,
@@ -163,7 +178,7 @@ func (s *Statement) GenerateWhereClauseByMap(whereMap map[string]any) (string, [
 		}
 		oneLogicCondition.Conditions = append(oneLogicCondition.Conditions, oneCondition)
 	}
-	return s.GenerateWhereClause(oneLogicCondition)
+	return oneLogicCondition
 }
 
 func (s *Statement) getFieldOperator(val any) OperatorType {
@@ -287,6 +302,11 @@ func (s *Statement) generateWhereFromCondition(con Condition) (string, []any, er
 		}
 	}
 
+	// 全文检索，Field可以是多个字段
+	if con.Operator == OperatorMatch {
+		return s.generateWhereForMatch(con)
+	}
+
 	// 如果Field不含空格表示是字段，则加上`
 	fieldStr := con.Field
 	if isValidFieldName(fieldStr) {
@@ -320,6 +340,11 @@ func (s *Statement) generateWhereFromCondition(con Condition) (string, []any, er
 		}
 	}
 
+	// json字段的查询
+	if isJsonOperator(con.Operator) {
+		return s.generateWhereForJson(fieldStr, con)
+	}
+
 	// 判断是否为null字段
 	if con.Operator == OperatorIs || con.Operator == OperatorIsNot {
 		return fmt.Sprintf("%s %s NULL", fieldStr, con.Operator), []any{}, nil
@@ -0,0 +1,171 @@
+package sqlstatement
+
+import (
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"strings"
+)
+
+// MatchMode 全文检索的模式
+type MatchMode string
+
+const (
+	MatchModeNaturalLanguage          MatchMode = "IN NATURAL LANGUAGE MODE"
+	MatchModeBoolean                  MatchMode = "IN BOOLEAN MODE"
+	MatchModeQueryExpansion           MatchMode = "WITH QUERY EXPANSION"
+	MatchModeNaturalLanguageExpansion MatchMode = "IN NATURAL LANGUAGE MODE WITH QUERY EXPANSION"
+)
+
+var (
+	matchModeList = []MatchMode{
+		MatchModeNaturalLanguage,
+		MatchModeBoolean,
+		MatchModeQueryExpansion,
+		MatchModeNaturalLanguageExpansion,
+	}
+	// matchModeAliasMap 模式的简写，方便前端传入
+	matchModeAliasMap = map[string]MatchMode{
+		"NATURAL":   MatchModeNaturalLanguage,
+		"BOOLEAN":   MatchModeBoolean,
+		"EXPANSION": MatchModeQueryExpansion,
+	}
+	// 布尔模式下的操作符
+	matchBooleanOperatorList = []string{"+", "-", ">", "<", "(", ")", "~", "*", "\"", "@"}
+)
+
+// MatchValue 全文检索的值
+type MatchValue struct {
+	Query        string    `json:"query"`
+	Mode         MatchMode `json:"mode,omitempty"`          // 默认为自然语言模式
+	KeepOperator bool      `json:"keep_operator,omitempty"` // 布尔模式下是否保留 + - * 等操作符，只能在代码中设置，map 传入时忽略
+}
+
+// EscapeMatchBoolean 去掉布尔模式下的操作符，避免用户输入影响查询逻辑
+func EscapeMatchBoolean(query string) string {
+	for _, one := range matchBooleanOperatorList {
+		query = strings.ReplaceAll(query, one, " ")
+	}
+	return strings.Join(strings.Fields(query), " ")
+}
+
+func getMatchMode(mode MatchMode) (MatchMode, error) {
+	modeStr := strings.ToUpper(strings.TrimSpace(string(mode)))
+	if modeStr == "" {
+		return MatchModeNaturalLanguage, nil
+	}
+	if alias, ok := matchModeAliasMap[modeStr]; ok {
+		return alias, nil
+	}
+	for _, one := range matchModeList {
+		if string(one) == modeStr {
+			return one, nil
+		}
+	}
+	return "", fmt.Errorf("match mode not support: %s", mode)
+}
+
+// getMatchValue 值可以是字符串或者 MatchValue
+func getMatchValue(value any) (MatchValue, error) {
+	var matchValue MatchValue
+	switch val := value.(type) {
+	case MatchValue:
+		matchValue = val
+	case *MatchValue:
+		if val == nil {
+			return matchValue, fmt.Errorf("match value is nil")
+		}
+		matchValue = *val
+	case map[string]any:
+		if err := conv.Unmarshal(val, &matchValue); err != nil {
+			return matchValue, err
+		}
+		matchValue.KeepOperator = false //map 一般来自前端的JSON，不允许保留操作符
+	default:
+		matchValue = MatchValue{Query: conv.String(value)}
+	}
+
+	mode, err := getMatchMode(matchValue.Mode)
+	if err != nil {
+		return matchValue, err
+	}
+	matchValue.Mode = mode
+	if matchValue.Mode == MatchModeBoolean && !matchValue.KeepOperator {
+		matchValue.Query = EscapeMatchBoolean(matchValue.Query)
+	}
+	matchValue.Query = strings.TrimSpace(matchValue.Query)
+	if matchValue.Query == "" {
+		return matchValue, fmt.Errorf("match query is empty")
+	}
+	return matchValue, nil
+}
+
+// getMatchFields 多个字段用逗号分隔，支持 table.column 的写法
+func getMatchFields(fields string) ([]string, error) {
+	fieldList := make([]string, 0)
+	for _, one := range strings.Split(fields, ",") {
+		one = removeCodeForOneColumn(one)
+		if one == "" {
+			continue
+		}
+		if isValidFieldName(one) {
+			fieldList = append(fieldList, addCodeForOneColumn(one))
+			continue
+		}
+		tableAndField := strings.Split(one, ".")
+		if len(tableAndField) == 2 {
+			tableName := removeCodeForOneColumn(tableAndField[0])
+			fieldName := removeCodeForOneColumn(tableAndField[1])
+			if isValidMySQLTableName(tableName) && isValidFieldName(fieldName) {
+				fieldList = append(fieldList, fmt.Sprintf("`%s`.`%s`", tableName, fieldName))
+				continue
+			}
+		}
+		return nil, fmt.Errorf("match field not valid: %s", one)
+	}
+	if len(fieldList) == 0 {
+		return nil, fmt.Errorf("match field is empty")
+	}
+	return fieldList, nil
+}
+
+// matchAgainstSql 生成 MATCH(...) AGAINST(? mode)
+func matchAgainstSql(fields string, value any) (string, []any, error) {
+	fieldList, err := getMatchFields(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	matchValue, err := getMatchValue(value)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("MATCH(%s) AGAINST(? %s)", strings.Join(fieldList, ", "), matchValue.Mode), []any{matchValue.Query}, nil
+}
+
+func (s *Statement) generateWhereForMatch(con Condition) (string, []any, error) {
+	if con.Value == nil {
+		return "", []any{}, nil
+	}
+	return matchAgainstSql(con.Field, con.Value)
+}
+
+// MatchScoreColumn 全文检索的相关度字段，用于select，如 SelectBuilder.Column(col)，然后 OrderBy(alias + " DESC")
+func MatchScoreColumn(fields string, value any, alias string) (squirrel.Sqlizer, error) {
+	if !isValidFieldName(alias) {
+		return nil, fmt.Errorf("match score alias not valid: %s", alias)
+	}
+	sqlStr, dataList, err := matchAgainstSql(fields, value)
+	if err != nil {
+		return nil, err
+	}
+	return squirrel.Alias(squirrel.Expr(sqlStr, dataList...), alias), nil
+}
+
+// MatchScoreOrderBy 按相关度倒序，用于 SelectBuilder.OrderByClause
+func MatchScoreOrderBy(fields string, value any) (squirrel.Sqlizer, error) {
+	sqlStr, dataList, err := matchAgainstSql(fields, value)
+	if err != nil {
+		return nil, err
+	}
+	return squirrel.Expr(sqlStr+" DESC", dataList...), nil
+}
@@ -0,0 +1,473 @@
+package sqlstatement
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/magic-lib/go-plat-utils/cond"
+	"github.com/magic-lib/go-plat-utils/utils"
+	"github.com/samber/lo"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 前端过滤条件的JSON格式：
+//
+//	{"and":[{"field":"age","op":">=","value":18},{"or":[{"field":"name","op":"like","value":"a%"},{"field":"id","op":"in","value":[1,2]}]}]}
+//
+// url参数格式：age[gte]=18&name=test&id[in]=1,2，也可以通过 filter=<json> 传入完整的JSON条件
+
+const (
+	conditionJsonKeyField = "field"
+	conditionJsonKeyOp    = "op"
+	conditionJsonKeyValue = "value"
+	conditionJsonKeyExpr  = "expr"
+	conditionJsonKeyArgs  = "args"
+	conditionJsonKeyPath  = "path"
+
+	conditionQueryFilterKey = "filter" // url参数里完整JSON条件的key
+	conditionMaxDepth       = 8        // 最大嵌套层数，避免恶意请求
+	conditionMaxNum         = 200      // 最多的条件数量
+)
+
+// operatorAliasMap 操作符的别名，方便url参数使用
+var operatorAliasMap = map[string]OperatorType{
+	"EQ":        OperatorEqual,
+	"==":        OperatorEqual,
+	"NE":        OperatorNotEqual,
+	"NEQ":       OperatorNotEqual,
+	"<>":        OperatorNotEqual,
+	"GT":        OperatorGreater,
+	"GTE":       OperatorGreaterEqual,
+	"LT":        OperatorLess,
+	"LTE":       OperatorLessEqual,
+	"NLIKE":     OperatorNotLike,
+	"NIN":       OperatorNotIn,
+	"ISNOT":     OperatorIsNot,
+	"NBETWEEN":  OperatorNotBetween,
+	"MEMBER_OF": OperatorMemberOf,
+}
+
+// MarshalJSON 转为前端过滤条件的JSON格式，用于日志记录
+func (c Condition) MarshalJSON() ([]byte, error) {
+	op := new(Statement).ConvOperator(c.Operator)
+	if op == "" {
+		op = OperatorEqual
+	}
+	data := map[string]any{
+		conditionJsonKeyField: c.Field,
+		conditionJsonKeyOp:    op,
+	}
+	if val, ok := c.Value.(squirrel.Sqlizer); ok {
+		sqlStr, args, err := val.ToSql()
+		if err != nil {
+			return nil, err
+		}
+		data[conditionJsonKeyExpr] = sqlStr
+		if len(args) > 0 {
+			data[conditionJsonKeyArgs] = args
+		}
+		return json.Marshal(data)
+	}
+	if op != OperatorIs && op != OperatorIsNot {
+		data[conditionJsonKeyValue] = c.Value
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON 解析单个条件
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	one, err := parseConditionJson(data, 0, new(int))
+	if err != nil {
+		return err
+	}
+	oneCondition, ok := one.(Condition)
+	if !ok {
+		return fmt.Errorf("condition json is a logic group")
+	}
+	*c = oneCondition
+	return nil
+}
+
+// MarshalJSON 转为前端过滤条件的JSON格式，用于日志记录
+func (lc LogicCondition) MarshalJSON() ([]byte, error) {
+	op := new(Statement).getLogicOperator(lc.Operator)
+	conditions := make([]ICondition, 0, len(lc.Conditions))
+	for _, one := range lc.Conditions {
+		if one != nil {
+			conditions = append(conditions, one)
+		}
+	}
+	return json.Marshal(map[string]any{
+		strings.ToLower(string(op)): conditions,
+	})
+}
+
+// UnmarshalJSON 解析前端过滤条件，单个条件会包装为AND分组
+func (lc *LogicCondition) UnmarshalJSON(data []byte) error {
+	one, err := parseConditionJson(data, 0, new(int))
+	if err != nil {
+		return err
+	}
+	*lc = toLogicCondition(one)
+	return nil
+}
+
+func toLogicCondition(one ICondition) LogicCondition {
+	switch c := one.(type) {
+	case LogicCondition:
+		return c
+	case Condition:
+		return LogicCondition{
+			Conditions: []ICondition{c},
+			Operator:   defaultLogicOperator,
+		}
+	}
+	return LogicCondition{Operator: defaultLogicOperator}
+}
+
+func parseConditionJson(data []byte, depth int, num *int) (ICondition, error) {
+	if depth > conditionMaxDepth {
+		return nil, fmt.Errorf("condition depth over %d", conditionMaxDepth)
+	}
+	rawMap := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &rawMap); err != nil {
+		return nil, fmt.Errorf("condition json error: %w", err)
+	}
+
+	// 逻辑分组：{"and":[...]} 或 {"or":[...]}
+	for _, logicOp := range logicOperatorList {
+		rawList, ok := rawMap[strings.ToLower(string(logicOp))]
+		if !ok {
+			rawList, ok = rawMap[string(logicOp)]
+		}
+		if !ok {
+			continue
+		}
+		if len(rawMap) != 1 {
+			return nil, fmt.Errorf("logic group %s can not have other keys", logicOp)
+		}
+		itemList := make([]json.RawMessage, 0)
+		if err := json.Unmarshal(rawList, &itemList); err != nil {
+			return nil, fmt.Errorf("logic group %s must be a list: %w", logicOp, err)
+		}
+		group := LogicCondition{
+			Conditions: make([]ICondition, 0, len(itemList)),
+			Operator:   logicOp,
+		}
+		for _, item := range itemList {
+			one, err := parseConditionJson(item, depth+1, num)
+			if err != nil {
+				return nil, err
+			}
+			group.Conditions = append(group.Conditions, one)
+		}
+		return group, nil
+	}
+
+	*num++
+	if *num > conditionMaxNum {
+		return nil, fmt.Errorf("condition num over %d", conditionMaxNum)
+	}
+	if _, ok := rawMap[conditionJsonKeyExpr]; ok {
+		return nil, fmt.Errorf("condition expr is not allowed")
+	}
+
+	oneCondition := Condition{}
+	fieldRaw, ok := rawMap[conditionJsonKeyField]
+	if !ok {
+		return nil, fmt.Errorf("condition field is empty")
+	}
+	if err := json.Unmarshal(fieldRaw, &oneCondition.Field); err != nil {
+		return nil, fmt.Errorf("condition field must be string: %w", err)
+	}
+	var opStr string
+	if opRaw, ok := rawMap[conditionJsonKeyOp]; ok {
+		if err := json.Unmarshal(opRaw, &opStr); err != nil {
+			return nil, fmt.Errorf("condition op must be string: %w", err)
+		}
+	}
+	op, err := parseOperator(opStr)
+	if err != nil {
+		return nil, err
+	}
+	oneCondition.Operator = op
+
+	if valueRaw, ok := rawMap[conditionJsonKeyValue]; ok {
+		decoder := json.NewDecoder(bytes.NewReader(valueRaw))
+		decoder.UseNumber()
+		var value any
+		if err = decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("condition value error: %w", err)
+		}
+		oneCondition.Value = convJsonNumber(value)
+	}
+
+	return checkConditionValue(oneCondition)
+}
+
+// parseOperator 解析并校验操作符，支持别名
+func parseOperator(op string) (OperatorType, error) {
+	opType := new(Statement).ConvOperator(op)
+	if opType == "" {
+		return OperatorEqual, nil
+	}
+	if alias, ok := operatorAliasMap[string(opType)]; ok {
+		opType = alias
+	}
+	if ok, _ := cond.Contains(operatorList, opType); !ok {
+		return "", fmt.Errorf("operator not support: %s", op)
+	}
+	return opType, nil
+}
+
+// checkConditionValue 根据操作符校验值的格式
+func checkConditionValue(c Condition) (Condition, error) {
+	switch c.Operator {
+	case OperatorIs, OperatorIsNot:
+		//生成语句时无值会被忽略，这里统一设置
+		c.Value = "NULL"
+		return c, nil
+	case OperatorIn, OperatorNotIn:
+		list, ok := c.Value.([]any)
+		if !ok || len(list) == 0 {
+			return c, fmt.Errorf("%s value must be a not empty list: %s", c.Operator, c.Field)
+		}
+		return c, nil
+	case OperatorBetween, OperatorNotBetween:
+		list, ok := c.Value.([]any)
+		if !ok || len(list) != 2 {
+			return c, fmt.Errorf("%s value must be 2 value: %s", c.Operator, c.Field)
+		}
+		return c, nil
+	}
+	if c.Value == nil {
+		return c, fmt.Errorf("condition value is empty: %s", c.Field)
+	}
+	if isJsonOperator(c.Operator) {
+		return checkJsonConditionValue(c)
+	}
+	if c.Operator == OperatorMatch {
+		_, err := getMatchValue(c.Value)
+		return c, err
+	}
+	switch c.Value.(type) {
+	case []any, map[string]any:
+		return c, fmt.Errorf("%s value must be a scalar: %s", c.Operator, c.Field)
+	}
+	return c, nil
+}
+
+// checkJsonConditionValue json字段的值，含有path时转为 JsonPathValue，否则为整个文档的值
+func checkJsonConditionValue(c Condition) (Condition, error) {
+	if valMap, ok := c.Value.(map[string]any); ok {
+		if path, ok := valMap[conditionJsonKeyPath].(string); ok {
+			pathValue := JsonPathValue{
+				Path:  path,
+				Value: valMap[conditionJsonKeyValue],
+			}
+			if opStr, ok := valMap[conditionJsonKeyOp].(string); ok && c.Operator == OperatorJsonExtract {
+				op, err := parseOperator(opStr)
+				if err != nil {
+					return c, err
+				}
+				pathValue.Operator = op
+			}
+			c.Value = pathValue
+		}
+	}
+	pathValue, err := getJsonPathValue(c.Value)
+	if err != nil {
+		return c, err
+	}
+	if c.Operator == OperatorJsonExtract && pathValue.Path == jsonPathRoot {
+		return c, fmt.Errorf("%s need json path: %s", c.Operator, c.Field)
+	}
+	return c, nil
+}
+
+// convJsonNumber 将json.Number转为int64或float64
+func convJsonNumber(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	case []any:
+		for i := range val {
+			val[i] = convJsonNumber(val[i])
+		}
+		return val
+	case map[string]any:
+		for k := range val {
+			val[k] = convJsonNumber(val[k])
+		}
+		return val
+	}
+	return v
+}
+
+// ParseConditionJson 解析前端传入的JSON过滤条件，allColumns 为允许查询的字段，为空则只校验字段名格式
+func (s *Statement) ParseConditionJson(data []byte, allColumns []string) (LogicCondition, error) {
+	var group LogicCondition
+	if err := json.Unmarshal(data, &group); err != nil {
+		return LogicCondition{}, err
+	}
+	if err := s.CheckConditionFields(group, allColumns); err != nil {
+		return LogicCondition{}, err
+	}
+	return group, nil
+}
+
+// ParseConditionQuery 解析url参数的过滤条件，格式为 field=value 或 field[op]=value，多个值用逗号分隔
+func (s *Statement) ParseConditionQuery(query url.Values, allColumns []string) (LogicCondition, error) {
+	group := LogicCondition{
+		Conditions: make([]ICondition, 0),
+		Operator:   defaultLogicOperator,
+	}
+
+	keys := lo.Keys(query)
+	sort.Strings(keys) //保证生成的语句顺序一致
+	for _, key := range keys {
+		values := query[key]
+		if key == conditionQueryFilterKey {
+			for _, one := range values {
+				oneGroup, err := s.ParseConditionJson([]byte(one), allColumns)
+				if err != nil {
+					return LogicCondition{}, err
+				}
+				group.Conditions = append(group.Conditions, oneGroup)
+			}
+			continue
+		}
+
+		field, opStr := key, ""
+		if i := strings.Index(key, "["); i > 0 && strings.HasSuffix(key, "]") {
+			field, opStr = key[:i], key[i+1:len(key)-1]
+		}
+		op, err := parseOperator(opStr)
+		if err != nil {
+			return LogicCondition{}, err
+		}
+		for _, one := range values {
+			oneCondition := Condition{
+				Field:    field,
+				Operator: op,
+				Value:    one,
+			}
+			switch op {
+			case OperatorIn, OperatorNotIn, OperatorBetween, OperatorNotBetween:
+				oneCondition.Value = lo.ToAnySlice(strings.Split(one, ","))
+			}
+			oneCondition, err = checkConditionValue(oneCondition)
+			if err != nil {
+				return LogicCondition{}, err
+			}
+			group.Conditions = append(group.Conditions, oneCondition)
+		}
+	}
+
+	if err := s.CheckConditionFields(group, allColumns); err != nil {
+		return LogicCondition{}, err
+	}
+	return group, nil
+}
+
+// CheckConditionFields 检查条件里的字段和操作符是否合法，allColumns 为空则只校验字段名格式
+func (s *Statement) CheckConditionFields(group LogicCondition, allColumns []string) error {
+	allColumns = s.buildFieldNames(allColumns)
+	for _, condTemp := range group.Conditions {
+		switch c := condTemp.(type) {
+		case Condition:
+			if err := s.checkConditionField(c, allColumns); err != nil {
+				return err
+			}
+		case LogicCondition:
+			if err := s.CheckConditionFields(c, allColumns); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown condition type: %s", reflect.TypeOf(condTemp))
+		}
+	}
+	return nil
+}
+
+func (s *Statement) checkConditionField(c Condition, allColumns []string) error {
+	if s.ConvOperator(c.Operator) == OperatorMatch {
+		//全文检索可以是多个字段
+		for _, one := range strings.Split(c.Field, ",") {
+			if err := s.checkConditionField(Condition{Field: one, Operator: OperatorEqual}, allColumns); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	columnName := removeCodeForOneColumn(c.Field)
+	if fieldList := strings.Split(columnName, "."); len(fieldList) == 2 {
+		tableName := removeCodeForOneColumn(fieldList[0])
+		if !isValidMySQLTableName(tableName) {
+			return fmt.Errorf("table name not valid: %s", c.Field)
+		}
+		columnName = removeCodeForOneColumn(fieldList[1])
+	}
+	if !isValidFieldName(columnName) {
+		return fmt.Errorf("field name not valid: %s", c.Field)
+	}
+	if len(allColumns) > 0 && lo.IndexOf(allColumns, columnName) < 0 {
+		return fmt.Errorf("field not exists: %s", c.Field)
+	}
+	if _, err := parseOperator(string(c.Operator)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseConditionJson 解析前端传入的JSON过滤条件，并校验字段是否是表的字段
+func (s *SqlStruct) ParseConditionJson(data []byte) (LogicCondition, error) {
+	allColumns, err := s.getAllColumnNames()
+	if err != nil {
+		return LogicCondition{}, err
+	}
+	return new(Statement).ParseConditionJson(data, allColumns)
+}
+
+// ParseConditionQuery 解析url参数的过滤条件，并校验字段是否是表的字段
+func (s *SqlStruct) ParseConditionQuery(query url.Values) (LogicCondition, error) {
+	allColumns, err := s.getAllColumnNames()
+	if err != nil {
+		return LogicCondition{}, err
+	}
+	return new(Statement).ParseConditionQuery(query, allColumns)
+}
+
+// getAllColumnNames 获取表的所有字段，优先使用数据库的字段信息
+func (s *SqlStruct) getAllColumnNames() ([]string, error) {
+	if len(s.columnList) > 0 {
+		return lo.Map(s.columnList, func(item *ColumnInfo, i int) string {
+			return item.ColumnName
+		}), nil
+	}
+	if s.structData == nil {
+		return nil, fmt.Errorf("please use SetStructData func")
+	}
+	tagNames := make([]string, 0)
+	if s.columnTagName != "" {
+		tagNames = append(tagNames, s.columnTagName)
+	}
+	//指针字段为nil时也需要算在内，所以不能用 StructToColumns
+	_, columnList, _, err := utils.GetFieldListByTag(s.structData, func(name string) string {
+		return utils.VarNameConverter(name, s.convertTableAndColumnType)
+	}, tagNames...)
+	if err != nil {
+		return nil, err
+	}
+	return columnList, nil
+}
@@ -0,0 +1,135 @@
+package sqlstatement
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// JsonPathValue json字段按路径查询的值
+type JsonPathValue struct {
+	Path     string       `json:"path,omitempty"` // json路径，如 $.a.b[0]，为空表示整个文档
+	Operator OperatorType `json:"op,omitempty"`   // 取出路径的值后的比较符，只用于 OperatorJsonExtract，默认为 =
+	Value    any          `json:"value"`
+}
+
+const (
+	jsonPathRoot      = "$"
+	jsonPathMaxLength = 255
+)
+
+var (
+	jsonOperatorList = []OperatorType{
+		OperatorJsonContains,
+		OperatorJsonOverlaps,
+		OperatorJsonExtract,
+		OperatorMemberOf,
+	}
+	// json路径只支持 .key ."key" [n] [*] .* ** 这几种写法
+	jsonPathPattern = regexp.MustCompile(`^\$(\.[a-zA-Z_][a-zA-Z0-9_]*|\."[^"\\]+"|\[[0-9]+]|\[\*]|\.\*|\*\*)*$`)
+)
+
+func isJsonOperator(op OperatorType) bool {
+	for _, one := range jsonOperatorList {
+		if one == op {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidJsonPath 是否是合法的json路径
+func isValidJsonPath(path string) bool {
+	if path == "" || len(path) > jsonPathMaxLength {
+		return false
+	}
+	if strings.HasSuffix(path, "**") {
+		return false // ** 后面必须跟路径
+	}
+	return jsonPathPattern.MatchString(path)
+}
+
+// getJsonPathValue 获取路径和值，值不是 JsonPathValue 时表示整个文档
+func getJsonPathValue(value any) (JsonPathValue, error) {
+	var pathValue JsonPathValue
+	switch val := value.(type) {
+	case JsonPathValue:
+		pathValue = val
+	case *JsonPathValue:
+		if val == nil {
+			return pathValue, fmt.Errorf("json path value is nil")
+		}
+		pathValue = *val
+	default:
+		pathValue = JsonPathValue{Value: value}
+	}
+	pathValue.Path = strings.TrimSpace(pathValue.Path)
+	if pathValue.Path == "" {
+		pathValue.Path = jsonPathRoot
+	}
+	if !isValidJsonPath(pathValue.Path) {
+		return pathValue, fmt.Errorf("json path not valid: %s", pathValue.Path)
+	}
+	return pathValue, nil
+}
+
+// generateWhereForJson 生成json字段的查询语句，路径都用参数传入
+func (s *Statement) generateWhereForJson(fieldStr string, con Condition) (string, []any, error) {
+	pathValue, err := getJsonPathValue(con.Value)
+	if err != nil {
+		return "", []any{}, err
+	}
+	if pathValue.Value == nil {
+		return "", []any{}, fmt.Errorf("%s value is empty: %s", con.Operator, con.Field)
+	}
+
+	// 非根路径时先取出子文档
+	docStr := fieldStr
+	docDataList := make([]any, 0)
+	if pathValue.Path != jsonPathRoot {
+		docStr = fmt.Sprintf("JSON_EXTRACT(%s, ?)", fieldStr)
+		docDataList = append(docDataList, pathValue.Path)
+	}
+
+	switch con.Operator {
+	case OperatorJsonContains:
+		candidate, err := jsonColumnValue(pathValue.Value)
+		if err != nil {
+			return "", []any{}, err
+		}
+		if pathValue.Path == jsonPathRoot {
+			return fmt.Sprintf("JSON_CONTAINS(%s, ?)", fieldStr), []any{candidate}, nil
+		}
+		return fmt.Sprintf("JSON_CONTAINS(%s, ?, ?)", fieldStr), []any{candidate, pathValue.Path}, nil
+	case OperatorJsonOverlaps:
+		candidate, err := jsonColumnValue(pathValue.Value)
+		if err != nil {
+			return "", []any{}, err
+		}
+		return fmt.Sprintf("JSON_OVERLAPS(%s, ?)", docStr), append(docDataList, candidate), nil
+	case OperatorMemberOf:
+		return fmt.Sprintf("? MEMBER OF(%s)", docStr), append([]any{pathValue.Value}, docDataList...), nil
+	case OperatorJsonExtract:
+		if pathValue.Path == jsonPathRoot {
+			return "", []any{}, fmt.Errorf("%s need json path: %s", con.Operator, con.Field)
+		}
+		op := s.ConvOperator(pathValue.Operator)
+		if op == "" {
+			op = OperatorEqual
+		}
+		if isJsonOperator(op) {
+			return "", []any{}, fmt.Errorf("%s can not use operator: %s", con.Operator, op)
+		}
+		// 取出的值再按普通字段比较
+		sqlStr, dataList, err := s.generateWhereFromCondition(Condition{
+			Field:    fmt.Sprintf("JSON_UNQUOTE(%s)", docStr),
+			Operator: op,
+			Value:    pathValue.Value,
+		})
+		if err != nil {
+			return "", []any{}, err
+		}
+		return sqlStr, append(docDataList, dataList...), nil
+	}
+	return "", []any{}, fmt.Errorf("operator not support: %s", con.Operator)
+}
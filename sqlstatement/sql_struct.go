@@ -20,6 +20,9 @@ type SqlStruct struct {
 	columnList                []*ColumnInfo //表字段信息
 	convertTableAndColumnType utils.VariableType
 	columnTagName             string
+	softDelete                *softDeleteColumn //软删除字段，为空时通过 xorm:"deleted" 获取
+	unscoped                  bool              //忽略软删除
+	versionColumn             string            //乐观锁版本字段，为空时通过 xorm:"version" 获取
 }
 
 const MysqlZeroTime = "1000-01-01 00:00:00"
@@ -136,8 +139,7 @@ func (s *SqlStruct) buildMapForInsertOrUpdate(columnsMap map[string]any) map[str
 		}
 		dataType := strings.ToLower(columnData.DataType)
 		if dataType == "json" {
-			vStr := conv.String(v)
-			if !cond.IsJson(vStr) { // 如果不是json格式，则用默认值，避免错误
+			if _, ok := isJsonColumnValue(v); !ok { // 如果不是json格式，则用默认值，避免错误
 				columnsMap[k] = s.getDefaultValutForJson(columnData)
 			}
 			continue
@@ -302,6 +304,9 @@ func (s *SqlStruct) DeleteSql(whereCondition LogicCondition) (string, []any, err
 	if err != nil {
 		return "", nil, err
 	}
+	if sd := s.getSoftDelete(); sd != nil {
+		return s.softDeleteSql(tableName, sd, whereCondition)
+	}
 	sqlStr, list := new(Statement).GenerateWhereClause(whereCondition)
 	sqlState := squirrel.Delete(tableName)
 	if sqlStr == "" {
@@ -317,6 +322,9 @@ func (s *SqlStruct) DeleteSqlByMap(whereMap map[string]any) (string, []any, erro
 		return "", nil, err
 	}
 	columns, _ := getSliceByMap(columnList, columnMap)
+	if sd := s.getSoftDelete(); sd != nil {
+		return s.softDeleteSql(tableName, sd, s.whereMapToCondition(columns, whereMap))
+	}
 	st := new(Statement)
 	sqlStr, values := st.DeleteSql(tableName, columns, whereMap)
 	return sqlStr, values, nil
@@ -334,7 +342,7 @@ func (s *SqlStruct) UpdateSql(in any, columns []string, whereCondition LogicCond
 
 	updateMap := make(map[string]any)
 	if len(columns) == 0 {
-		updateMap = allColumnMap
+		updateMap = s.withoutSoftDeleteColumn(allColumnMap)
 	} else {
 		lo.ForEach(columns, func(item string, i int) {
 			if val, ok := allColumnMap[item]; ok {
@@ -348,6 +356,7 @@ func (s *SqlStruct) UpdateSql(in any, columns []string, whereCondition LogicCond
 		newUpdateMap[addCodeForOneColumn(k)] = v
 	}
 
+	newUpdateMap, whereCondition = s.withVersion(newUpdateMap, allColumnMap, s.withNotDeleted(whereCondition))
 	sqlStr, list := new(Statement).GenerateWhereClause(whereCondition)
 	sqlState := squirrel.Update(tableName).SetMap(newUpdateMap)
 	if sqlStr == "" {
@@ -365,7 +374,7 @@ func (s *SqlStruct) UpdateSqlByMap(in any, columns []string, whereMap map[string
 
 	updateMap := make(map[string]any)
 	if len(columns) == 0 {
-		updateMap = allColumnMap
+		updateMap = s.withoutSoftDeleteColumn(allColumnMap)
 	} else {
 		lo.ForEach(columns, func(item string, i int) {
 			if val, ok := allColumnMap[item]; ok {
@@ -376,6 +385,14 @@ func (s *SqlStruct) UpdateSqlByMap(in any, columns []string, whereMap map[string
 
 	st := new(Statement)
 	allColumns, _ := getSliceByMap(columnList, allColumnMap)
+	if s.getVersionColumn() != "" {
+		return s.updateSqlWithVersion(tableName, allColumns, updateMap, allColumnMap, whereMap)
+	}
+	if s.getSoftDelete() != nil {
+		sqlStr, values := st.UpdateSqlByWhereCondition(tableName, allColumns, updateMap,
+			s.withNotDeleted(s.whereMapToCondition(allColumns, whereMap)))
+		return sqlStr, values, nil
+	}
 	sqlStr, values := st.UpdateSql(tableName, allColumns, updateMap, whereMap)
 	return sqlStr, values, nil
 }
@@ -387,7 +404,15 @@ func (s *SqlStruct) UpdateSqlWithUpdateMap(updateMap map[string]any, whereMap ma
 		return "", nil, err
 	}
 	allColumns, _ := getSliceByMap(columnList, columnMap)
+	if s.getVersionColumn() != "" {
+		return s.updateSqlWithVersion(tableName, allColumns, updateMap, updateMap, whereMap)
+	}
 	st := new(Statement)
+	if s.getSoftDelete() != nil {
+		sqlStr, values := st.UpdateSqlByWhereCondition(tableName, allColumns, updateMap,
+			s.withNotDeleted(s.whereMapToCondition(allColumns, whereMap)))
+		return sqlStr, values, nil
+	}
 	sqlStr, values := st.UpdateSql(tableName, allColumns, updateMap, whereMap)
 	return sqlStr, values, nil
 }
@@ -412,7 +437,7 @@ func (s *SqlStruct) SelectBuilderForSelect(selectStr string, whereCondition Logi
 		selectStr = "*"
 	}
 
-	sqlStr, list := new(Statement).GenerateWhereClause(whereCondition)
+	sqlStr, list := new(Statement).GenerateWhereClause(s.withNotDeleted(whereCondition))
 	sqlState := squirrel.Select(selectStr).From(tableName)
 	if sqlStr != "" {
 		sqlState = sqlState.Where(sqlStr, list...)
@@ -431,6 +456,11 @@ func (s *SqlStruct) SelectSqlByMap(selectStr string, whereMap map[string]any, of
 	}
 	columns, _ := getSliceByMap(columnList, columnMap)
 	st := new(Statement)
+	if s.getSoftDelete() != nil {
+		sqlStr, values := st.SelectSqlByWhereCondition(tableName, columns, selectStr,
+			s.withNotDeleted(s.whereMapToCondition(columns, whereMap)), offset, limit)
+		return sqlStr, values, nil
+	}
 	sqlStr, values := st.SelectSql(tableName, columns, selectStr, whereMap, offset, limit)
 	return sqlStr, values, nil
 }
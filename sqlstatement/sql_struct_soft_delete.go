@@ -0,0 +1,207 @@
+package sqlstatement
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/magic-lib/go-plat-utils/utils"
+	"github.com/samber/lo"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	softDeleteXormTag = "xorm"    // 与xorm的软删除tag保持一致
+	softDeleteXormKey = "deleted" // xorm:"deleted"
+
+	xormZeroTime = "0001-01-01 00:00:00" // xorm 写入时间零值时的值
+)
+
+// softDeleteColumn 软删除字段
+type softDeleteColumn struct {
+	column string
+	isFlag bool // true: is_deleted 标识字段(0/1)，false: deleted_at 删除时间字段
+	isUnix bool // xorm:"deleted" 的非时间字段，与xorm一致写入unix时间戳，0表示未删除
+	isXorm bool // 通过 xorm:"deleted" 获取，时间零值可能是xorm写入的零值
+}
+
+// SetSoftDeleteTimeColumn 设置软删除的时间字段，如 deleted_at，为NULL或零值表示未删除
+func SetSoftDeleteTimeColumn(column string) Option {
+	return func(s *SqlStruct) {
+		s.softDelete = &softDeleteColumn{column: removeCodeForOneColumn(column)}
+	}
+}
+
+// SetSoftDeleteFlagColumn 设置软删除的标识字段，如 is_deleted，0表示未删除，1表示已删除
+func SetSoftDeleteFlagColumn(column string) Option {
+	return func(s *SqlStruct) {
+		s.softDelete = &softDeleteColumn{column: removeCodeForOneColumn(column), isFlag: true}
+	}
+}
+
+// Unscoped 忽略软删除，删除为物理删除，查询和更新不加未删除的条件
+func Unscoped() Option {
+	return func(s *SqlStruct) {
+		s.unscoped = true
+	}
+}
+
+// Unscoped 返回一个忽略软删除的副本，不影响原对象
+func (s *SqlStruct) Unscoped() *SqlStruct {
+	newStruct := *s
+	newStruct.unscoped = true
+	return &newStruct
+}
+
+// getSoftDelete 获取软删除字段，没有设置时通过 xorm:"deleted" 的tag获取
+func (s *SqlStruct) getSoftDelete() *softDeleteColumn {
+	if s.unscoped {
+		return nil
+	}
+	if s.softDelete != nil {
+		if s.softDelete.column == "" {
+			return nil
+		}
+		return s.softDelete
+	}
+	if s.structData == nil {
+		return nil
+	}
+
+	typ := reflect.TypeOf(s.structData)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		fi := typ.Field(i)
+		if !fi.IsExported() {
+			continue
+		}
+		xormTag := strings.Fields(strings.ToLower(fi.Tag.Get(softDeleteXormTag)))
+		if lo.IndexOf(xormTag, softDeleteXormKey) < 0 {
+			continue
+		}
+		column := s.getFieldColumnName(fi)
+		if column == "" {
+			continue
+		}
+		isTime := isTimeType(fi.Type)
+		return &softDeleteColumn{
+			column: column,
+			isFlag: !isTime,
+			isUnix: !isTime,
+			isXorm: true,
+		}
+	}
+	return nil
+}
+
+// getFieldColumnName 获取字段对应的列名，与 StructToColumnsAndValues 的规则一致
+func (s *SqlStruct) getFieldColumnName(fi reflect.StructField) string {
+	if s.columnTagName != "" {
+		tagV := fi.Tag.Get(s.columnTagName)
+		tagV = strings.TrimSpace(strings.Split(tagV, ",")[0])
+		if tagV == "-" {
+			return ""
+		}
+		if tagV != "" {
+			return tagV
+		}
+	}
+	return utils.VarNameConverter(fi.Name, s.convertTableAndColumnType)
+}
+
+func isTimeType(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ == reflect.TypeOf(time.Time{}) || typ == reflect.TypeOf(sql.NullTime{})
+}
+
+// notDeletedCondition 未删除的条件
+func (sd *softDeleteColumn) notDeletedCondition() Condition {
+	if sd.isFlag {
+		return Condition{
+			Field:    sd.column,
+			Operator: OperatorEqual,
+			Value:    0,
+		}
+	}
+	column := addCodeForOneColumn(sd.column)
+	if sd.isXorm {
+		return Condition{
+			Value: squirrel.Expr(fmt.Sprintf("%s IS NULL OR %s IN (?, ?)", column, column), MysqlZeroTime, xormZeroTime),
+		}
+	}
+	return Condition{
+		Value: squirrel.Expr(fmt.Sprintf("%s IS NULL OR %s = ?", column, column), MysqlZeroTime),
+	}
+}
+
+// deletedValue 删除时设置的值
+func (sd *softDeleteColumn) deletedValue() any {
+	if sd.isUnix {
+		return time.Now().Unix()
+	}
+	if sd.isFlag {
+		return 1
+	}
+	return time.Now().Format(time.DateTime)
+}
+
+// withNotDeleted 加上未删除的条件
+func (s *SqlStruct) withNotDeleted(whereCondition LogicCondition) LogicCondition {
+	sd := s.getSoftDelete()
+	if sd == nil {
+		return whereCondition
+	}
+	return LogicCondition{
+		Conditions: []ICondition{whereCondition, sd.notDeletedCondition()},
+		Operator:   OperatorAnd,
+	}
+}
+
+// softDeleteSql 软删除转为更新语句
+func (s *SqlStruct) softDeleteSql(tableName string, sd *softDeleteColumn, whereCondition LogicCondition) (string, []any, error) {
+	sqlStr, list := new(Statement).GenerateWhereClause(s.withNotDeleted(whereCondition))
+	sqlState := squirrel.Update(tableName).Set(addCodeForOneColumn(sd.column), sd.deletedValue())
+	if sqlStr == "" {
+		return sqlState.ToSql()
+	}
+	return sqlState.Where(sqlStr, list...).ToSql()
+}
+
+// withoutSoftDeleteColumn 更新全部字段时不更新软删除字段，与xorm保持一致
+func (s *SqlStruct) withoutSoftDeleteColumn(columnMap map[string]any) map[string]any {
+	sd := s.getSoftDelete()
+	if sd == nil {
+		return columnMap
+	}
+	if _, ok := columnMap[sd.column]; !ok {
+		return columnMap
+	}
+	newColumnMap := make(map[string]any, len(columnMap))
+	for k, v := range columnMap {
+		if k != sd.column {
+			newColumnMap[k] = v
+		}
+	}
+	return newColumnMap
+}
+
+// whereMapToCondition 将map条件转为LogicCondition，只保留表的字段
+func (s *SqlStruct) whereMapToCondition(allColumns []string, whereMap map[string]any) LogicCondition {
+	st := new(Statement)
+	allColumns = st.buildFieldNames(allColumns)
+	whereNewMap := make(map[string]any)
+	for k, v := range whereMap {
+		if lo.IndexOf(allColumns, k) >= 0 {
+			whereNewMap[k] = v
+		}
+	}
+	return st.conditionByMap(whereNewMap)
+}
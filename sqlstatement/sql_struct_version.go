@@ -0,0 +1,122 @@
+package sqlstatement
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/samber/lo"
+	"reflect"
+	"strings"
+)
+
+const versionXormKey = "version" // xorm:"version"
+
+// ErrStaleVersion 乐观锁版本号已经变化，数据已被其他人修改
+var ErrStaleVersion = errors.New("stale version: record has been modified by others")
+
+// SetVersionColumn 设置乐观锁的版本字段，更新时版本号加1，并且只更新版本号与传入值相同的记录
+func SetVersionColumn(column string) Option {
+	return func(s *SqlStruct) {
+		s.versionColumn = removeCodeForOneColumn(column)
+	}
+}
+
+// CheckVersionResult 检查乐观锁更新的结果，没有更新到记录时返回 ErrStaleVersion
+func CheckVersionResult(result sql.Result) error {
+	if result == nil {
+		return ErrStaleVersion
+	}
+	num, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if num == 0 {
+		return ErrStaleVersion
+	}
+	return nil
+}
+
+// getVersionColumn 获取乐观锁字段，没有设置时通过 xorm:"version" 的tag获取
+func (s *SqlStruct) getVersionColumn() string {
+	if s.versionColumn != "" {
+		return s.versionColumn
+	}
+	if s.structData == nil {
+		return ""
+	}
+	typ := reflect.TypeOf(s.structData)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		fi := typ.Field(i)
+		if !fi.IsExported() {
+			continue
+		}
+		xormTag := strings.Fields(strings.ToLower(fi.Tag.Get(softDeleteXormTag)))
+		if lo.IndexOf(xormTag, versionXormKey) < 0 {
+			continue
+		}
+		if column := s.getFieldColumnName(fi); column != "" {
+			return column
+		}
+	}
+	return ""
+}
+
+// withVersion 版本号加1，valueMap 里有版本号时加上版本号相同的条件
+func (s *SqlStruct) withVersion(updateMap map[string]any, valueMap map[string]any, whereCondition LogicCondition) (map[string]any, LogicCondition) {
+	column := s.getVersionColumn()
+	if column == "" {
+		return updateMap, whereCondition
+	}
+	newUpdateMap := make(map[string]any, len(updateMap)+1)
+	for k, v := range updateMap {
+		if removeCodeForOneColumn(k) != column {
+			newUpdateMap[k] = v
+		}
+	}
+	quoteColumn := addCodeForOneColumn(column)
+	newUpdateMap[quoteColumn] = squirrel.Expr(fmt.Sprintf("%s + 1", quoteColumn))
+
+	version, ok := valueMap[column]
+	if !ok || version == nil {
+		return newUpdateMap, whereCondition
+	}
+	return newUpdateMap, LogicCondition{
+		Conditions: []ICondition{
+			whereCondition,
+			Condition{
+				Field:    column,
+				Operator: OperatorEqual,
+				Value:    version,
+			},
+		},
+		Operator: OperatorAnd,
+	}
+}
+
+// updateSqlWithVersion 带乐观锁的更新语句，只更新表里有的字段
+func (s *SqlStruct) updateSqlWithVersion(tableName string, allColumns []string, updateMap map[string]any,
+	valueMap map[string]any, whereMap map[string]any) (string, []any, error) {
+	allColumns = new(Statement).buildFieldNames(allColumns)
+	newUpdateMap := make(map[string]any)
+	for k, v := range updateMap {
+		if lo.IndexOf(allColumns, removeCodeForOneColumn(k)) >= 0 {
+			newUpdateMap[addCodeForOneColumn(k)] = v
+		}
+	}
+	whereCondition := s.withNotDeleted(s.whereMapToCondition(allColumns, whereMap))
+	newUpdateMap, whereCondition = s.withVersion(newUpdateMap, valueMap, whereCondition)
+
+	sqlStr, list := new(Statement).GenerateWhereClause(whereCondition)
+	sqlState := squirrel.Update(tableName).SetMap(newUpdateMap)
+	if sqlStr == "" {
+		return sqlState.ToSql()
+	}
+	return sqlState.Where(sqlStr, list...).ToSql()
+}
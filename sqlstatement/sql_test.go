@@ -2,11 +2,13 @@ package sqlstatement_test
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/Masterminds/squirrel"
 	"github.com/magic-lib/go-plat-mysql/sqlstatement"
 	"github.com/magic-lib/go-plat-utils/conv"
 	"github.com/magic-lib/go-plat-utils/utils"
+	"net/url"
 	"regexp"
 	"testing"
 	"time"
@@ -378,3 +380,289 @@ func TestCondition(t *testing.T) {
 	//fmt.Println(s4, d4)
 	fmt.Println(s5, d5)
 }
+
+func TestParseConditionJson(t *testing.T) {
+	st := new(sqlstatement.Statement)
+	allColumns := []string{"name", "age", "id"}
+
+	group, err := st.ParseConditionJson([]byte(`{"and":[{"field":"age","op":">=","value":18},{"or":[{"field":"name","op":"like","value":"a%"},{"field":"id","op":"in","value":[1,2]}]}]}`), allColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlStr, list := st.GenerateWhereClause(group)
+	if sqlStr != "(`age` >= ?) AND ((`name` LIKE ?) OR (`id` IN (?,?)))" || len(list) != 4 {
+		t.Error(sqlStr, list)
+	}
+
+	jsonStr := conv.String(group)
+	fmt.Println(jsonStr)
+	group2, err := st.ParseConditionJson([]byte(jsonStr), allColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.String(group2) != jsonStr {
+		t.Error(conv.String(group2))
+	}
+
+	_, err = st.ParseConditionJson([]byte(`{"field":"password","op":"=","value":"1"}`), allColumns)
+	if err == nil {
+		t.Error("field not exists should error")
+	}
+	_, err = st.ParseConditionJson([]byte(`{"field":"age","op":"regexp","value":"1"}`), allColumns)
+	if err == nil {
+		t.Error("operator not support should error")
+	}
+}
+
+type filterKey struct {
+	Name *string `json:"name"`
+	Age  int     `json:"age"`
+}
+
+func TestParseConditionQuery(t *testing.T) {
+	query, _ := url.ParseQuery(`age[gte]=18&name=test&id[in]=1,2&filter={"field":"age","op":"lt","value":60}`)
+
+	sqlObj := sqlstatement.NewSqlStruct(
+		sqlstatement.SetStructData(filterKey{}),
+	)
+	group, err := sqlObj.ParseConditionQuery(query)
+	if err == nil {
+		t.Error("id is not a column of filterKey")
+	}
+	query.Del("id[in]")
+	group, err = sqlObj.ParseConditionQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlStr, list := new(sqlstatement.Statement).GenerateWhereClause(group)
+	if sqlStr != "(`age` >= ?) AND ((`age` < ?)) AND (`name` = ?)" {
+		t.Error(sqlStr)
+	}
+	if conv.String(list) != `["18",60,"test"]` {
+		t.Error(conv.String(list))
+	}
+}
+
+func TestJsonCondition(t *testing.T) {
+	st := new(sqlstatement.Statement)
+	sqlStr, list := st.GenerateWhereClause(sqlstatement.LogicCondition{
+		Conditions: []sqlstatement.ICondition{
+			sqlstatement.Condition{
+				Field:    "tags",
+				Operator: sqlstatement.OperatorJsonContains,
+				Value:    []string{"a"},
+			},
+			sqlstatement.Condition{
+				Field:    "attrs",
+				Operator: sqlstatement.OperatorJsonExtract,
+				Value: sqlstatement.JsonPathValue{
+					Path:     "$.user.age",
+					Operator: sqlstatement.OperatorGreaterEqual,
+					Value:    18,
+				},
+			},
+			sqlstatement.Condition{
+				Field:    "attrs",
+				Operator: sqlstatement.OperatorMemberOf,
+				Value:    sqlstatement.JsonPathValue{Path: "$.ids", Value: 3},
+			},
+			sqlstatement.Condition{
+				Field:    "tags",
+				Operator: sqlstatement.OperatorJsonOverlaps,
+				Value:    []int{1, 2},
+			},
+			sqlstatement.Condition{
+				Field:    "attrs",
+				Operator: sqlstatement.OperatorJsonExtract,
+				Value:    sqlstatement.JsonPathValue{Path: "$.a') OR 1=1 -- ", Value: 1},
+			},
+		},
+	})
+	want := "(JSON_CONTAINS(`tags`, ?)) AND (JSON_UNQUOTE(JSON_EXTRACT(`attrs`, ?)) >= ?) AND (? MEMBER OF(JSON_EXTRACT(`attrs`, ?))) AND (JSON_OVERLAPS(`tags`, ?))"
+	if sqlStr != want {
+		t.Error(sqlStr)
+	}
+	if conv.String(list) != `["[\"a\"]","$.user.age",18,3,"$.ids","[1,2]"]` {
+		t.Error(conv.String(list))
+	}
+
+	group, err := st.ParseConditionJson([]byte(`{"field":"attrs","op":"json_extract","value":{"path":"$.user.name","op":"like","value":"a%"}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlStr, list = st.GenerateWhereClause(group)
+	if sqlStr != "(JSON_UNQUOTE(JSON_EXTRACT(`attrs`, ?)) LIKE ?)" {
+		t.Error(sqlStr, list)
+	}
+	fmt.Println(conv.String(group))
+}
+
+func TestMatchCondition(t *testing.T) {
+	st := new(sqlstatement.Statement)
+	sqlStr, list := st.GenerateWhereClause(sqlstatement.LogicCondition{
+		Conditions: []sqlstatement.ICondition{
+			sqlstatement.Condition{
+				Field:    "title, content",
+				Operator: sqlstatement.OperatorMatch,
+				Value: sqlstatement.MatchValue{
+					Query: `+mysql -"oracle" (db)*`,
+					Mode:  sqlstatement.MatchModeBoolean,
+				},
+			},
+			sqlstatement.Condition{
+				Field:    "a.title",
+				Operator: sqlstatement.OperatorMatch,
+				Value:    "database",
+			},
+		},
+	})
+	if sqlStr != "(MATCH(`title`, `content`) AGAINST(? IN BOOLEAN MODE)) AND (MATCH(`a`.`title`) AGAINST(? IN NATURAL LANGUAGE MODE))" {
+		t.Error(sqlStr)
+	}
+	if conv.String(list) != `["mysql oracle db","database"]` {
+		t.Error(conv.String(list))
+	}
+
+	scoreCol, err := sqlstatement.MatchScoreColumn("title,content", "database", "score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoreSql, scoreArgs, err := scoreCol.ToSql()
+	if err != nil || scoreSql != "(MATCH(`title`, `content`) AGAINST(? IN NATURAL LANGUAGE MODE)) AS score" ||
+		conv.String(scoreArgs) != `["database"]` {
+		t.Error(scoreSql, scoreArgs, err)
+	}
+	query, args, err := squirrel.Select("id").Column(scoreCol).From("article").
+		Where(sqlStr, list...).OrderBy("score DESC").ToSql()
+	if err != nil || query != "SELECT id, "+scoreSql+" FROM article WHERE "+sqlStr+" ORDER BY score DESC" ||
+		conv.String(args) != `["database","mysql oracle db","database"]` {
+		t.Error(query, args, err)
+	}
+	if _, err = sqlstatement.MatchScoreColumn("title", "database", "score desc"); err == nil {
+		t.Error("alias not valid should error")
+	}
+
+	_, err = st.ParseConditionJson([]byte(`{"field":"title,content","op":"match","value":{"query":"db","mode":"boolean"}}`), []string{"title", "content"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// JSON 传入的 keep_operator 不生效
+	group, err := st.ParseConditionJson([]byte(`{"field":"title","op":"match","value":{"query":"+db -mysql","mode":"boolean","keep_operator":true}}`), []string{"title"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlStr, list = st.GenerateWhereClause(group)
+	if sqlStr != "(MATCH(`title`) AGAINST(? IN BOOLEAN MODE))" || conv.String(list) != `["db mysql"]` {
+		t.Error(sqlStr, list)
+	}
+}
+
+type SoftDeleteUser struct {
+	Id        int64     `db:"id"`
+	Name      string    `db:"name"`
+	DeletedAt time.Time `db:"deleted_at" xorm:"deleted"`
+}
+
+func TestSoftDelete(t *testing.T) {
+	sqlObj := sqlstatement.NewSqlStruct(
+		sqlstatement.SetColumnTagName("db"),
+		sqlstatement.SetStructData(SoftDeleteUser{}),
+		sqlstatement.SetTableName("user"),
+	)
+	where := sqlstatement.LogicCondition{
+		Conditions: []sqlstatement.ICondition{
+			sqlstatement.Condition{Field: "id", Operator: sqlstatement.OperatorEqual, Value: 1},
+		},
+	}
+	query, args, err := sqlObj.DeleteSql(where)
+	if err != nil || query != "UPDATE user SET `deleted_at` = ? WHERE ((`id` = ?)) AND (`deleted_at` IS NULL OR `deleted_at` IN (?, ?))" {
+		t.Error(query, args, err)
+	}
+	query, args, err = sqlObj.SelectSqlByMap("", map[string]any{"name": "a"}, 0, 10)
+	if err != nil || query != "SELECT * FROM `user` WHERE ((`name` = ?)) AND (`deleted_at` IS NULL OR `deleted_at` IN (?, ?)) LIMIT 0, 10" {
+		t.Error(query, args, err)
+	}
+	if conv.String(args) != `["a","1000-01-01 00:00:00","0001-01-01 00:00:00"]` {
+		t.Error(args)
+	}
+	query, args, err = sqlObj.UpdateSql(&SoftDeleteUser{Id: 1, Name: "b"}, nil, where)
+	if err != nil || query != "UPDATE user SET `id` = ?, `name` = ? WHERE ((`id` = ?)) AND (`deleted_at` IS NULL OR `deleted_at` IN (?, ?))" {
+		t.Error(query, args, err)
+	}
+	query, args, err = sqlObj.Unscoped().DeleteSql(where)
+	if err != nil || query != "DELETE FROM user WHERE (`id` = ?)" {
+		t.Error(query, args, err)
+	}
+
+	flagObj := sqlstatement.NewSqlStruct(
+		sqlstatement.SetStructData(Table1{}),
+		sqlstatement.SetTableName("table1"),
+		sqlstatement.SetSoftDeleteFlagColumn("is_deleted"),
+	)
+	query, args, err = flagObj.DeleteSqlByMap(map[string]any{"name": "a"})
+	if err != nil || query != "UPDATE table1 SET `is_deleted` = ? WHERE ((`name` = ?)) AND (`is_deleted` = ?)" {
+		t.Error(query, args, err)
+	}
+	if len(args) != 3 || args[0] != 1 {
+		t.Error(args)
+	}
+
+	// xorm:"deleted" 的整数字段与xorm一致写入unix时间戳
+	unixObj := sqlstatement.NewSqlStruct(
+		sqlstatement.SetColumnTagName("db"),
+		sqlstatement.SetStructData(SoftDeleteUnixUser{}),
+		sqlstatement.SetTableName("user"),
+	)
+	query, args, err = unixObj.DeleteSql(where)
+	if err != nil || query != "UPDATE user SET `deleted` = ? WHERE ((`id` = ?)) AND (`deleted` = ?)" {
+		t.Error(query, args, err)
+	}
+	if deleted, ok := args[0].(int64); !ok || deleted < time.Now().Add(-time.Minute).Unix() {
+		t.Error(args)
+	}
+}
+
+type SoftDeleteUnixUser struct {
+	Id      int64 `db:"id"`
+	Deleted int64 `db:"deleted" xorm:"deleted"`
+}
+
+type VersionUser struct {
+	Id      int64  `db:"id"`
+	Name    string `db:"name"`
+	Version int64  `db:"version" xorm:"version"`
+}
+
+func TestVersionUpdate(t *testing.T) {
+	sqlObj := sqlstatement.NewSqlStruct(
+		sqlstatement.SetColumnTagName("db"),
+		sqlstatement.SetStructData(VersionUser{}),
+		sqlstatement.SetTableName("user"),
+	)
+	where := sqlstatement.LogicCondition{
+		Conditions: []sqlstatement.ICondition{
+			sqlstatement.Condition{Field: "id", Operator: sqlstatement.OperatorEqual, Value: 1},
+		},
+	}
+	query, args, err := sqlObj.UpdateSql(&VersionUser{Id: 1, Name: "b", Version: 3}, []string{"name"}, where)
+	if err != nil || query != "UPDATE user SET `name` = ?, `version` = `version` + 1 WHERE ((`id` = ?)) AND (`version` = ?)" ||
+		len(args) != 3 || args[2] != int64(3) {
+		t.Error(query, args, err)
+	}
+	query, args, err = sqlObj.UpdateSqlWithUpdateMap(map[string]any{"name": "c", "version": 5}, map[string]any{"id": 1})
+	if err != nil || query != "UPDATE user SET `name` = ?, `version` = `version` + 1 WHERE ((`id` = ?)) AND (`version` = ?)" {
+		t.Error(query, args, err)
+	}
+	if err = sqlstatement.CheckVersionResult(driverResult(0)); !errors.Is(err, sqlstatement.ErrStaleVersion) {
+		t.Error(err)
+	}
+	if err = sqlstatement.CheckVersionResult(driverResult(1)); err != nil {
+		t.Error(err)
+	}
+}
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
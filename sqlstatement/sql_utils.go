@@ -2,6 +2,8 @@ package sqlstatement
 
 import (
 	"database/sql"
+	"encoding/json"
+	"github.com/magic-lib/go-plat-utils/cond"
 	"github.com/magic-lib/go-plat-utils/conv"
 	"github.com/magic-lib/go-plat-utils/utils"
 	"reflect"
@@ -131,3 +133,21 @@ func removeCodeForOneColumn(column string) string {
 	newTableSchema := strings.ReplaceAll(column, "`", "")
 	return strings.TrimSpace(newTableSchema)
 }
+
+// isJsonColumnValue 是否是json字段可直接写入的值(对象或数组)
+func isJsonColumnValue(v any) (string, bool) {
+	vStr := conv.String(v)
+	return vStr, cond.IsJson(vStr)
+}
+
+// jsonColumnValue 转为json字段查询使用的值，对象和数组与写入时保持一致，其它值转为json标量
+func jsonColumnValue(v any) (string, error) {
+	if vStr, ok := isJsonColumnValue(v); ok {
+		return vStr, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -1,31 +1,35 @@
 package converter
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
 	"os"
-	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"text/template"
 	// 默认使用mysql驱动
 	_ "github.com/go-sql-driver/mysql"
 )
 
-// map for converting mysql type to golang types
+// map for converting mysql type to golang types, 无符号整型在 goType 中处理
 var typeForMysqlToGo = map[string]string{
-	"int":                "int",
-	"integer":            "int",
-	"tinyint":            "int",
-	"smallint":           "int",
-	"mediumint":          "int",
-	"bigint":             "int",
-	"int unsigned":       "int",
-	"integer unsigned":   "int",
-	"tinyint unsigned":   "int",
-	"smallint unsigned":  "int",
-	"mediumint unsigned": "int",
-	"bigint unsigned":    "int",
-	"bit":                "int",
+	"tinyint":            "int8",
+	"smallint":           "int16",
+	"mediumint":          "int32",
+	"int":                "int32",
+	"integer":            "int32",
+	"bigint":             "int64",
+	"year":               "int16",
+	"bit":                "[]byte", // 驱动返回原始字节, bit(1) 在 goType 中生成bool
 	"bool":               "bool",
+	"boolean":            "bool",
 	"enum":               "string",
 	"set":                "string",
 	"varchar":            "string",
@@ -34,21 +38,75 @@ var typeForMysqlToGo = map[string]string{
 	"mediumtext":         "string",
 	"text":               "string",
 	"longtext":           "string",
-	"blob":               "string",
-	"tinyblob":           "string",
-	"mediumblob":         "string",
-	"longblob":           "string",
-	"date":               "string", // time.Time
-	"datetime":           "string", // time.Time
-	"timestamp":          "string", // time.Time
-	"time":               "string", // time.Time
-	"float":              "float64",
+	"time":               "string", // 可以超过24小时, 不能用time.Time
+	"blob":               "[]byte",
+	"tinyblob":           "[]byte",
+	"mediumblob":         "[]byte",
+	"longblob":           "[]byte",
+	"binary":             "[]byte",
+	"varbinary":          "[]byte",
+	"geometry":           "[]byte",
+	"point":              "[]byte",
+	"linestring":         "[]byte",
+	"polygon":            "[]byte",
+	"multipoint":         "[]byte",
+	"multilinestring":    "[]byte",
+	"multipolygon":       "[]byte",
+	"geometrycollection": "[]byte",
+	"date":               "time.Time",
+	"datetime":           "time.Time",
+	"timestamp":          "time.Time",
+	"float":              "float32",
 	"double":             "float64",
-	"decimal":            "float64",
-	"binary":             "string",
-	"varbinary":          "string",
+	"real":               "float64",
+	"decimal":            "decimal.Decimal",
+	"numeric":            "decimal.Decimal",
+	"json":               "json.RawMessage",
 }
 
+// 可为NULL的字段使用 NullTypeSql 时对应的类型, 没有的使用 sql.Null[T]
+var nullTypeForGo = map[string]string{
+	"int16":           "sql.NullInt16",
+	"int32":           "sql.NullInt32",
+	"int64":           "sql.NullInt64",
+	"uint8":           "sql.NullByte",
+	"float64":         "sql.NullFloat64",
+	"string":          "sql.NullString",
+	"bool":            "sql.NullBool",
+	"time.Time":       "sql.NullTime",
+	"decimal.Decimal": "decimal.NullDecimal",
+}
+
+// 生成的代码中用到时需要引入的包, key为代码中使用的包名
+var importForCode = map[string]string{
+	"time":       "time",
+	"sql":        "database/sql",
+	"json":       "encoding/json",
+	"decimal":    "github.com/shopspring/decimal",
+	"context":    "context",
+	"xorms":      "github.com/magic-lib/go-plat-mysql/xorms",
+	"startupcfg": "github.com/magic-lib/go-plat-startupcfg/startupcfg",
+}
+
+// 可为NULL的字段生成的类型
+const (
+	NullTypePointer = "pointer" // 使用指针, 默认
+	NullTypeSql     = "sql"     // 使用 sql.NullXxx
+	NullTypeNone    = "none"    // 与不可为NULL的字段相同
+)
+
+// GeneratedHeader 生成的文件的第一行
+const GeneratedHeader = "// Code generated by Table2Struct. DO NOT EDIT."
+
+const (
+	defaultTagKey         = "xorm"
+	defaultRealNameMethod = "TableName"
+	defaultPackageName    = "model"
+	defaultFileName       = "model.go"
+	modelTemplateName     = "model"
+	daoTemplateName       = "dao"
+)
+
 // Table2Struct 将数据表转化为对象
 type Table2Struct struct {
 	dsn            string
@@ -58,20 +116,66 @@ type Table2Struct struct {
 	prefix         string
 	config         *T2tConfig
 	err            error
-	realNameMethod string
+	realNameMethod string // 获取真实表名的方法名, 默认 TableName
 	enableJsonTag  bool   // 是否添加json的tag, 默认不添加
 	packageName    string // 生成struct的包名(默认为空的话, 则取名为: package model)
-	tagKey         string // tag字段的key值,默认是orm
+	tagKey         string // tag字段的key值,默认是xorm, 为xorm时生成完整的xorm tag
+	modelTemplate  string // model的模板, 默认 DefaultModelTemplate
+	daoTemplate    string // 数据访问的模板, 默认 DefaultDaoTemplate
+	enableDao      bool   // 是否生成数据访问对象, 默认不生成
+	imports        []string
+	includes       []string // 需要生成的表名通配符, 为空时全部生成
+	excludes       []string // 不需要生成的表名通配符
+}
+
+// TemplateTable 模板中一个表的数据
+type TemplateTable struct {
+	PackageName    string
+	TableName      string // 真实表名
+	StructName     string
+	Comment        string
+	RealNameMethod string
+	Columns        []TemplateColumn
+	PrimaryKey     *TemplateColumn // 只有一个主键时不为nil
+}
+
+// TemplateColumn 模板中一个字段的数据
+type TemplateColumn struct {
+	Name         string // struct的字段名
+	VarName      string // 作为变量时的名字
+	Type         string
+	BaseType     string // 去掉指针的类型
+	Tag          string // 包含反引号的完整tag
+	Comment      string
+	ColumnName   string // 数据表的字段名
+	IsPrimaryKey bool
+}
+
+// GeneratedFile 生成的文件
+type GeneratedFile struct {
+	Name    string
+	Content string
 }
 
 // T2tConfig 配置文件
 type T2tConfig struct {
-	RmTagIfUcFirst bool // 如果字段首字母本来就是大写, 就不添加tag, 默认false添加, true不添加
-	TagToLower     bool // tag的字段名字是否转换为小写, 如果本身有大写字母的话, 默认false不转
-	UcFirstOnly    bool // 字段首字母大写的同时, 是否要把其他字母转换为小写,默认false不转换
-	SeparateFile   bool // 每个struct放入单独的文件,默认false,放入同一个文件
+	RmTagIfUcFirst bool     // 如果字段首字母本来就是大写, 就不添加tag, 默认false添加, true不添加
+	TagToLower     bool     // tag的字段名字是否转换为小写, 如果本身有大写字母的话, 默认false不转
+	UcFirstOnly    bool     // 字段首字母大写的同时, 是否要把其他字母转换为小写,默认false不转换
+	SeparateFile   bool     // 每个struct放入单独的文件,默认false,放入同一个文件
+	NullType       string   // 可为NULL的字段生成的类型, 默认 NullTypePointer
+	TinyIntAsBool  bool     // tinyint(1) 是否生成bool, 默认false生成int8
+	CreatedColumns []string // 添加xorm created tag的字段名, 为空时使用默认
+	UpdatedColumns []string // 添加xorm updated tag的字段名, 为空时使用默认
+	DeletedColumns []string // 添加xorm deleted tag的字段名, 为空时使用默认
 }
 
+var (
+	defaultCreatedColumns = []string{"created_at", "create_time", "created_time", "ctime"}
+	defaultUpdatedColumns = []string{"updated_at", "update_time", "updated_time", "mtime"}
+	defaultDeletedColumns = []string{"deleted_at", "delete_time", "deleted_time"}
+)
+
 // NewTable2Struct 新建立一个对象
 func NewTable2Struct() *Table2Struct {
 	return &Table2Struct{}
@@ -119,6 +223,18 @@ func (t *Table2Struct) Table(tab string) *Table2Struct {
 	return t
 }
 
+// Include 只生成表名匹配的表, 支持 path.Match 的通配符, 如 user_*
+func (t *Table2Struct) Include(patterns ...string) *Table2Struct {
+	t.includes = append(t.includes, patterns...)
+	return t
+}
+
+// Exclude 不生成表名匹配的表, 支持 path.Match 的通配符
+func (t *Table2Struct) Exclude(patterns ...string) *Table2Struct {
+	t.excludes = append(t.excludes, patterns...)
+	return t
+}
+
 // Prefix xx
 func (t *Table2Struct) Prefix(p string) *Table2Struct {
 	t.prefix = p
@@ -137,84 +253,314 @@ func (t *Table2Struct) Config(c *T2tConfig) *Table2Struct {
 	return t
 }
 
-// Run 运行
+// ModelTemplate 设置model的模板, 默认为 DefaultModelTemplate, 数据为 TemplateTable
+func (t *Table2Struct) ModelTemplate(tpl string) *Table2Struct {
+	t.modelTemplate = tpl
+	return t
+}
+
+// DaoTemplate 设置数据访问的模板, 默认为 DefaultDaoTemplate, 需要 EnableDao 开启
+func (t *Table2Struct) DaoTemplate(tpl string) *Table2Struct {
+	t.daoTemplate = tpl
+	return t
+}
+
+// EnableDao 是否为每个表生成嵌入 xorms.Dao 的数据访问对象, 默认不生成
+func (t *Table2Struct) EnableDao(p bool) *Table2Struct {
+	t.enableDao = p
+	return t
+}
+
+// Imports 模板中额外用到的包, 内置类型用到的包会自动引入
+func (t *Table2Struct) Imports(pkgList ...string) *Table2Struct {
+	t.imports = append(t.imports, pkgList...)
+	return t
+}
+
+// Run 运行, 返回生成的代码, 设置了保存路径时写入文件, SeparateFile 时保存路径为目录
 func (t *Table2Struct) Run() (string, error) {
+	files, err := t.Generate()
+	if err != nil {
+		return "", err
+	}
+	if t.savePath != "" {
+		if err = t.saveFiles(files); err != nil {
+			return "", err
+		}
+	}
+	contentList := make([]string, 0, len(files))
+	for _, one := range files {
+		contentList = append(contentList, one.Content)
+	}
+	return strings.Join(contentList, "\n"), nil
+}
+
+// Generate 生成代码但不写文件, 没有设置 SeparateFile 时只有一个文件
+func (t *Table2Struct) Generate() ([]GeneratedFile, error) {
 	if t.config == nil {
 		t.config = new(T2tConfig)
 	}
+	if t.tagKey == "" {
+		t.tagKey = defaultTagKey
+	}
+	if t.realNameMethod == "" {
+		t.realNameMethod = defaultRealNameMethod
+	}
+	if t.packageName == "" {
+		t.packageName = defaultPackageName
+	}
 	// 链接mysql, 获取db对象
 	t.dialMysql()
 	if t.err != nil {
-		return "", t.err
+		return nil, t.err
+	}
+	tpl, err := t.parseTemplates()
+	if err != nil {
+		return nil, err
 	}
 	tableColumns, err := t.getColumns()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	var packageName string
-	if t.packageName == "" {
-		packageName = "package model\n\n"
-	} else {
-		packageName = fmt.Sprintf("package %s\n\n", t.packageName)
-	}
-	var structContent string
-	for tableRealName, item := range tableColumns {
-		// 去除前缀
-		if t.prefix != "" {
-			tableRealName = tableRealName[len(t.prefix):]
+	tableComments, err := t.getTableComments()
+	if err != nil {
+		return nil, err
+	}
+	tableNames := make([]string, 0, len(tableColumns))
+	for tableName := range tableColumns {
+		if t.matchTable(tableName) {
+			tableNames = append(tableNames, tableName)
 		}
-		tableName := tableRealName
-		switch len(tableName) {
-		case 0:
-		case 1:
-			tableName = strings.ToUpper(tableName[0:1])
-		default:
-			// 字符长度大于1时
-			tableName = strings.ToUpper(tableName[0:1]) + tableName[1:]
+	}
+	sort.Strings(tableNames)
+
+	files := make([]GeneratedFile, 0)
+	var body bytes.Buffer
+	for _, tableName := range tableNames {
+		data := t.templateTable(tableName, tableComments[tableName], tableColumns[tableName])
+		if err = tpl.ExecuteTemplate(&body, modelTemplateName, data); err != nil {
+			return nil, fmt.Errorf("执行模板失败: %s, %w", tableName, err)
 		}
-		depth := 1
-		structContent += "type " + tableName + " struct {\n"
-		for _, v := range item {
-			// 字段注释
-			var columnComment string
-			if v.ColumnComment != "" {
-				columnComment = fmt.Sprintf(" // %s", v.ColumnComment)
+		if t.enableDao {
+			if err = tpl.ExecuteTemplate(&body, daoTemplateName, data); err != nil {
+				return nil, fmt.Errorf("执行模板失败: %s, %w", tableName, err)
 			}
-			structContent += fmt.Sprintf("%s%s %s %s%s\n",
-				tab(depth), v.ColumnName, v.Type, v.Tag, columnComment)
 		}
-		structContent += tab(depth-1) + "}\n\n"
-		// 添加 method 获取真实表名
-		if t.realNameMethod != "" {
-			structContent += fmt.Sprintf("func (*%s) %s() string {\n",
-				tableName, t.realNameMethod)
-			structContent += fmt.Sprintf("%sreturn \"%s\"\n",
-				tab(depth), tableRealName)
-			structContent += "}\n\n"
+		if t.config.SeparateFile {
+			file, err := t.newFile(strings.TrimPrefix(tableName, t.prefix)+".go", body.String())
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+			body.Reset()
 		}
-		fmt.Println(structContent)
-	}
-	// 如果有引入 time.Time, 则需要引入 time 包
-	var importContent string
-	if strings.Contains(structContent, "time.Time") {
-		importContent = "import \"time\"\n\n"
 	}
-	allContent := packageName + importContent + structContent
-	// 是否指定保存路径
-	if t.savePath != "" {
-		filePath := fmt.Sprintf("%s", t.savePath)
-		f, err := os.Create(filePath)
+	if !t.config.SeparateFile {
+		fileName := defaultFileName
+		if t.savePath != "" {
+			fileName = filepath.Base(t.savePath)
+		}
+		file, err := t.newFile(fileName, body.String())
 		if err != nil {
-			fmt.Println("Can not write file")
-			return "", err
+			return nil, err
 		}
-		//defer f.Close()
-		_, _ = f.WriteString(allContent)
-		cmd := exec.Command("gofmt", "-w", filePath)
-		_ = cmd.Run()
-		return "", nil
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// matchTable 表名是否需要生成, 通配符同时匹配去除前缀前后的表名
+func (t *Table2Struct) matchTable(tableName string) bool {
+	names := []string{tableName, strings.TrimPrefix(tableName, t.prefix)}
+	if len(t.includes) > 0 && !matchPatterns(names, t.includes) {
+		return false
 	}
-	return "", nil
+	return !matchPatterns(names, t.excludes)
+}
+
+func matchPatterns(names []string, patterns []string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *Table2Struct) parseTemplates() (*template.Template, error) {
+	modelTpl := t.modelTemplate
+	if modelTpl == "" {
+		modelTpl = DefaultModelTemplate
+	}
+	daoTpl := t.daoTemplate
+	if daoTpl == "" {
+		daoTpl = DefaultDaoTemplate
+	}
+	tpl, err := template.New(modelTemplateName).Parse(modelTpl)
+	if err != nil {
+		return nil, fmt.Errorf("解析model模板失败: %w", err)
+	}
+	if _, err = tpl.New(daoTemplateName).Parse(daoTpl); err != nil {
+		return nil, fmt.Errorf("解析dao模板失败: %w", err)
+	}
+	return tpl, nil
+}
+
+func (t *Table2Struct) templateTable(tableName string, comment string, columns []column) *TemplateTable {
+	data := &TemplateTable{
+		PackageName:    t.packageName,
+		TableName:      tableName,
+		StructName:     t.camelCase(tableName),
+		Comment:        comment,
+		RealNameMethod: t.realNameMethod,
+	}
+	pkCount := 0
+	for _, one := range columns {
+		col := TemplateColumn{
+			Name:         one.ColumnName,
+			Type:         one.Type,
+			BaseType:     strings.TrimPrefix(one.Type, "*"),
+			Tag:          one.Tag,
+			Comment:      one.ColumnComment,
+			ColumnName:   one.RawName,
+			IsPrimaryKey: one.ColumnKey == "PRI",
+		}
+		col.VarName = varName(col.Name)
+		data.Columns = append(data.Columns, col)
+		if col.IsPrimaryKey {
+			pkCount++
+		}
+	}
+	// 联合主键时不生成按主键操作的方法
+	if pkCount == 1 {
+		for i := range data.Columns {
+			if data.Columns[i].IsPrimaryKey {
+				data.PrimaryKey = &data.Columns[i]
+			}
+		}
+	}
+	return data
+}
+
+// newFile 加上包名和用到的包并格式化, 只引入代码中实际使用的包, 注释中的不算
+func (t *Table2Struct) newFile(fileName string, body string) (GeneratedFile, error) {
+	imports := make(map[string]struct{})
+	for _, pkg := range t.imports {
+		imports[pkg] = struct{}{}
+	}
+	usedPkgs, err := usedPackages(body)
+	if err != nil {
+		return GeneratedFile{}, fmt.Errorf("解析生成的代码失败: %s, %w\n%s", fileName, err, body)
+	}
+	for _, name := range usedPkgs {
+		if pkg, ok := importForCode[name]; ok {
+			imports[pkg] = struct{}{}
+		}
+	}
+	var content strings.Builder
+	content.WriteString(GeneratedHeader + "\n\n")
+	content.WriteString(fmt.Sprintf("package %s\n\n", t.packageName))
+	// 引入用到的包
+	if len(imports) > 0 {
+		pkgList := make([]string, 0, len(imports))
+		for pkg := range imports {
+			pkgList = append(pkgList, fmt.Sprintf("%s\"%s\"\n", tab(1), pkg))
+		}
+		sort.Strings(pkgList)
+		content.WriteString("import (\n" + strings.Join(pkgList, "") + ")\n")
+	}
+	content.WriteString(body)
+	formatted, err := format.Source([]byte(content.String()))
+	if err != nil {
+		return GeneratedFile{}, fmt.Errorf("格式化生成的代码失败: %s, %w\n%s", fileName, err, content.String())
+	}
+	return GeneratedFile{Name: fileName, Content: string(formatted)}, nil
+}
+
+// usedPackages 代码中作为包名使用的标识符, 即没有在文件中声明的 xx.Yy 的 xx
+func usedPackages(body string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+body, 0)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := make(map[*ast.Ident]struct{}, len(file.Unresolved))
+	for _, one := range file.Unresolved {
+		unresolved[one] = struct{}{}
+	}
+	names := make([]string, 0)
+	ast.Inspect(file, func(node ast.Node) bool {
+		sel, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			if _, ok = unresolved[ident]; ok {
+				names = append(names, ident.Name)
+			}
+		}
+		return true
+	})
+	return names, nil
+}
+
+func (t *Table2Struct) saveFiles(files []GeneratedFile) error {
+	if !t.config.SeparateFile {
+		if dir := filepath.Dir(t.savePath); dir != "" {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("创建目录失败: %w", err)
+			}
+		}
+		return os.WriteFile(t.savePath, []byte(files[0].Content), 0o644)
+	}
+	if err := os.MkdirAll(t.savePath, 0o755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	for _, one := range files {
+		if err := os.WriteFile(filepath.Join(t.savePath, one.Name), []byte(one.Content), 0o644); err != nil {
+			return fmt.Errorf("写入文件失败: %s, %w", one.Name, err)
+		}
+	}
+	return nil
+}
+
+// getTableComments 表的注释
+func (t *Table2Struct) getTableComments() (map[string]string, error) {
+	var sqlStr = `SELECT TABLE_NAME,TABLE_COMMENT FROM information_schema.TABLES WHERE table_schema = DATABASE()`
+	var args []any
+	if t.table != "" {
+		sqlStr += " AND TABLE_NAME = ?"
+		args = append(args, t.prefix+t.table)
+	}
+	rows, err := t.db.Query(sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("读取表信息失败: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	comments := make(map[string]string)
+	for rows.Next() {
+		var tableName, comment string
+		if err = rows.Scan(&tableName, &comment); err != nil {
+			return nil, fmt.Errorf("读取表信息失败: %w", err)
+		}
+		comments[tableName] = comment
+	}
+	return comments, rows.Err()
+}
+
+func varName(name string) string {
+	if name == "" {
+		return "v"
+	}
+	ret := strings.ToLower(name[0:1]) + name[1:]
+	if token.IsKeyword(ret) {
+		ret += "Value"
+	}
+	return ret
 }
 
 func (t *Table2Struct) dialMysql() {
@@ -230,10 +576,17 @@ func (t *Table2Struct) dialMysql() {
 
 type column struct {
 	ColumnName    string
+	RawName       string
+	DataType      string
+	ColumnType    string
 	Type          string
 	Nullable      string
 	TableName     string
 	ColumnComment string
+	ColumnKey     string
+	Extra         string
+	Default       sql.NullString
+	Indexes       []string // xorm 的 index(xx) 或 unique(xx)
 	Tag           string
 }
 
@@ -241,16 +594,23 @@ type column struct {
 func (t *Table2Struct) getColumns(table ...string) (tableColumns map[string][]column, err error) {
 	tableColumns = make(map[string][]column)
 	// sql
-	var sqlStr = `SELECT COLUMN_NAME,DATA_TYPE,IS_NULLABLE,TABLE_NAME,COLUMN_COMMENT 
+	var sqlStr = `SELECT COLUMN_NAME,DATA_TYPE,COLUMN_TYPE,IS_NULLABLE,TABLE_NAME,COLUMN_COMMENT,COLUMN_KEY,EXTRA,COLUMN_DEFAULT 
 FROM information_schema.COLUMNS WHERE table_schema = DATABASE()`
+	var args []any
 	// 是否指定了具体的table
 	if t.table != "" {
-		sqlStr += fmt.Sprintf(" AND TABLE_NAME = '%s'", t.prefix+t.table)
+		sqlStr += " AND TABLE_NAME = ?"
+		args = append(args, t.prefix+t.table)
 	}
 	// sql排序
 	sqlStr += " order by TABLE_NAME asc, ORDINAL_POSITION asc"
 
-	rows, err := t.db.Query(sqlStr)
+	indexes, err := t.getIndexes()
+	if err != nil {
+		return
+	}
+
+	rows, err := t.db.Query(sqlStr, args...)
 	if err != nil {
 		fmt.Println("Error reading table information: ", err.Error())
 		return
@@ -262,7 +622,8 @@ FROM information_schema.COLUMNS WHERE table_schema = DATABASE()`
 
 	for rows.Next() {
 		col := column{}
-		err = rows.Scan(&col.ColumnName, &col.Type, &col.Nullable, &col.TableName, &col.ColumnComment)
+		err = rows.Scan(&col.ColumnName, &col.DataType, &col.ColumnType, &col.Nullable, &col.TableName,
+			&col.ColumnComment, &col.ColumnKey, &col.Extra, &col.Default)
 
 		if err != nil {
 			fmt.Println(err.Error())
@@ -271,8 +632,11 @@ FROM information_schema.COLUMNS WHERE table_schema = DATABASE()`
 
 		//col.Json = strings.ToLower(col.ColumnName)
 		col.Tag = col.ColumnName
+		col.RawName = col.ColumnName
+		col.Indexes = indexes[col.TableName+"."+col.ColumnName]
+		col.Type = t.goType(&col)
+		tagName := col.Tag
 		col.ColumnName = t.camelCase(col.ColumnName)
-		col.Type = typeForMysqlToGo[col.Type]
 		// 字段首字母本身大写, 是否需要删除tag
 		if t.config.RmTagIfUcFirst &&
 			col.ColumnName[0:1] == strings.ToUpper(col.ColumnName[0:1]) {
@@ -282,14 +646,12 @@ FROM information_schema.COLUMNS WHERE table_schema = DATABASE()`
 			if t.config.TagToLower {
 				col.Tag = strings.ToLower(col.Tag)
 			}
-			//if col.Nullable == "YES" {
-			//	col.Json = fmt.Sprintf("`json:\"%s,omitempty\"`", col.Json)
-			//} else {
-			//}
+			if t.tagKey == defaultTagKey {
+				col.Tag = t.xormTag(&col, tagName)
+			}
 		}
 		if t.enableJsonTag {
-			//col.Json = fmt.Sprintf("`json:\"%s\" %s:\"%s\"`", col.Json, t.config.TagKey, col.Json)
-			col.Tag = fmt.Sprintf("`%s:\"%s\" json:\"%s\"`", t.tagKey, col.Tag, col.Tag)
+			col.Tag = fmt.Sprintf("`%s:\"%s\" json:\"%s\"`", t.tagKey, col.Tag, tagName)
 		} else {
 			col.Tag = fmt.Sprintf("`%s:\"%s\"`", t.tagKey, col.Tag)
 		}
@@ -299,9 +661,139 @@ FROM information_schema.COLUMNS WHERE table_schema = DATABASE()`
 		}
 		tableColumns[col.TableName] = append(tableColumns[col.TableName], col)
 	}
+	err = rows.Err()
 	return
 }
 
+// getIndexes 获取索引, key为 表名.字段名, 主键由 COLUMN_KEY 处理
+func (t *Table2Struct) getIndexes() (map[string][]string, error) {
+	var sqlStr = `SELECT TABLE_NAME,INDEX_NAME,NON_UNIQUE,COLUMN_NAME 
+FROM information_schema.STATISTICS WHERE table_schema = DATABASE() AND INDEX_NAME != 'PRIMARY'`
+	var args []any
+	if t.table != "" {
+		sqlStr += " AND TABLE_NAME = ?"
+		args = append(args, t.prefix+t.table)
+	}
+	sqlStr += " order by TABLE_NAME asc, INDEX_NAME asc, SEQ_IN_INDEX asc"
+
+	rows, err := t.db.Query(sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("读取索引信息失败: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	indexes := make(map[string][]string)
+	for rows.Next() {
+		var tableName, indexName, columnName string
+		var nonUnique int
+		if err = rows.Scan(&tableName, &indexName, &nonUnique, &columnName); err != nil {
+			return nil, fmt.Errorf("读取索引信息失败: %w", err)
+		}
+		key := tableName + "." + columnName
+		if nonUnique == 0 {
+			indexes[key] = append(indexes[key], fmt.Sprintf("unique(%s)", indexName))
+		} else {
+			indexes[key] = append(indexes[key], fmt.Sprintf("index(%s)", indexName))
+		}
+	}
+	return indexes, rows.Err()
+}
+
+// goType 字段对应的go类型, 无符号和可为NULL时做相应处理
+func (t *Table2Struct) goType(col *column) string {
+	columnType := strings.ToLower(col.ColumnType)
+	goType, ok := typeForMysqlToGo[strings.ToLower(col.DataType)]
+	if !ok {
+		goType = "string"
+	}
+	if t.config.TinyIntAsBool && strings.HasPrefix(columnType, "tinyint(1)") {
+		goType = "bool"
+	}
+	if columnType == "bit(1)" {
+		goType = "bool"
+	}
+	if strings.HasPrefix(goType, "int") && strings.Contains(columnType, "unsigned") {
+		goType = "u" + goType
+	}
+	if col.Nullable != "YES" {
+		return goType
+	}
+	// nil 本身可以表示NULL
+	if goType == "[]byte" || goType == "json.RawMessage" {
+		return goType
+	}
+	switch t.config.NullType {
+	case NullTypeNone:
+		return goType
+	case NullTypeSql:
+		if nullType, ok := nullTypeForGo[goType]; ok {
+			return nullType
+		}
+		return fmt.Sprintf("sql.Null[%s]", goType)
+	default:
+		return "*" + goType
+	}
+}
+
+// xormTag 生成xorm的tag: 字段名 pk autoincr notnull default index/unique created/updated/deleted
+func (t *Table2Struct) xormTag(col *column, columnName string) string {
+	tags := []string{fmt.Sprintf("'%s'", col.Tag)}
+	if col.ColumnKey == "PRI" {
+		tags = append(tags, "pk")
+	}
+	extra := strings.ToLower(col.Extra)
+	if strings.Contains(extra, "auto_increment") {
+		tags = append(tags, "autoincr")
+	}
+	if col.Nullable != "YES" {
+		tags = append(tags, "notnull")
+	}
+	lowerName := strings.ToLower(columnName)
+	switch {
+	case inColumns(lowerName, t.config.CreatedColumns, defaultCreatedColumns):
+		tags = append(tags, "created")
+	case inColumns(lowerName, t.config.UpdatedColumns, defaultUpdatedColumns) ||
+		strings.Contains(extra, "on update current_timestamp"):
+		tags = append(tags, "updated")
+	case inColumns(lowerName, t.config.DeletedColumns, defaultDeletedColumns):
+		tags = append(tags, "deleted")
+	default:
+		// created/updated 由xorm赋值, 不需要default
+		if col.Default.Valid {
+			tags = append(tags, fmt.Sprintf("default(%s)", columnDefault(col)))
+		}
+	}
+	tags = append(tags, col.Indexes...)
+	return strings.Join(tags, " ")
+}
+
+// columnDefault 默认值, 字符串需要加单引号
+func columnDefault(col *column) string {
+	value := col.Default.String
+	if strings.HasPrefix(strings.ToUpper(value), "CURRENT_TIMESTAMP") || strings.Contains(strings.ToLower(col.Extra), "default_generated") {
+		return value
+	}
+	switch typeForMysqlToGo[strings.ToLower(col.DataType)] {
+	case "string", "time.Time", "[]byte", "json.RawMessage":
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return value
+}
+
+func inColumns(name string, columns []string, defaultColumns []string) bool {
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	for _, one := range columns {
+		if strings.EqualFold(name, one) {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Table2Struct) camelCase(str string) string {
 	// 是否有表前缀, 设置了就先去除表前缀
 	if t.prefix != "" {
@@ -0,0 +1,226 @@
+package converter
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestGoType(t *testing.T) {
+	cases := []struct {
+		config   T2tConfig
+		col      column
+		expected string
+	}{
+		{col: column{DataType: "int", ColumnType: "int(10) unsigned", Nullable: "NO"}, expected: "uint32"},
+		{col: column{DataType: "bigint", ColumnType: "bigint(20)", Nullable: "YES"}, expected: "*int64"},
+		{config: T2tConfig{NullType: NullTypeSql}, col: column{DataType: "bigint", ColumnType: "bigint(20)", Nullable: "YES"}, expected: "sql.NullInt64"},
+		{config: T2tConfig{NullType: NullTypeSql}, col: column{DataType: "float", ColumnType: "float", Nullable: "YES"}, expected: "sql.Null[float32]"},
+		{config: T2tConfig{NullType: NullTypeNone}, col: column{DataType: "datetime", ColumnType: "datetime", Nullable: "YES"}, expected: "time.Time"},
+		{col: column{DataType: "bit", ColumnType: "bit(1)", Nullable: "NO"}, expected: "bool"},
+		{col: column{DataType: "bit", ColumnType: "bit(8)", Nullable: "YES"}, expected: "[]byte"},
+		{col: column{DataType: "tinyint", ColumnType: "tinyint(1)", Nullable: "NO"}, expected: "int8"},
+		{config: T2tConfig{TinyIntAsBool: true}, col: column{DataType: "tinyint", ColumnType: "tinyint(1)", Nullable: "NO"}, expected: "bool"},
+		{col: column{DataType: "json", ColumnType: "json", Nullable: "YES"}, expected: "json.RawMessage"},
+		{col: column{DataType: "decimal", ColumnType: "decimal(10,2)", Nullable: "NO"}, expected: "decimal.Decimal"},
+		{col: column{DataType: "geometry_unknown", ColumnType: "x", Nullable: "NO"}, expected: "string"},
+	}
+	for _, one := range cases {
+		config := one.config
+		t2s := &Table2Struct{config: &config}
+		if got := t2s.goType(&one.col); got != one.expected {
+			t.Errorf("%s %s: got %s, want %s", one.col.ColumnType, one.col.Nullable, got, one.expected)
+		}
+	}
+}
+
+func TestXormTag(t *testing.T) {
+	t2s := &Table2Struct{config: new(T2tConfig)}
+	cases := []struct {
+		col      column
+		expected string
+	}{
+		{
+			col:      column{Tag: "id", DataType: "bigint", ColumnKey: "PRI", Extra: "auto_increment", Nullable: "NO"},
+			expected: "'id' pk autoincr notnull",
+		},
+		{
+			col: column{Tag: "name", DataType: "varchar", Nullable: "NO", Default: sql.NullString{String: "it's", Valid: true},
+				Indexes: []string{"unique(uk_name)"}},
+			expected: "'name' notnull default('it''s') unique(uk_name)",
+		},
+		{
+			col:      column{Tag: "created_at", DataType: "datetime", Nullable: "NO", Default: sql.NullString{String: "CURRENT_TIMESTAMP", Valid: true}},
+			expected: "'created_at' notnull created",
+		},
+		{
+			col:      column{Tag: "modify_at", DataType: "timestamp", Nullable: "YES", Extra: "on update CURRENT_TIMESTAMP"},
+			expected: "'modify_at' updated",
+		},
+		{
+			col:      column{Tag: "deleted_at", DataType: "datetime", Nullable: "YES", Indexes: []string{"index(idx_deleted)"}},
+			expected: "'deleted_at' deleted index(idx_deleted)",
+		},
+	}
+	for _, one := range cases {
+		if got := t2s.xormTag(&one.col, one.col.Tag); got != one.expected {
+			t.Errorf("%s: got %s, want %s", one.col.Tag, got, one.expected)
+		}
+	}
+
+	t2s.config.CreatedColumns = []string{"add_time"}
+	col := column{Tag: "created_at", DataType: "int", Nullable: "NO", Default: sql.NullString{String: "0", Valid: true}}
+	if got := t2s.xormTag(&col, "created_at"); got != "'created_at' notnull default(0)" {
+		t.Errorf("custom created columns: %s", got)
+	}
+}
+
+func TestColumnDefault(t *testing.T) {
+	cases := []struct {
+		col      column
+		expected string
+	}{
+		{col: column{DataType: "int", Default: sql.NullString{String: "10", Valid: true}}, expected: "10"},
+		{col: column{DataType: "varchar", Default: sql.NullString{String: "a'b", Valid: true}}, expected: "'a''b'"},
+		{col: column{DataType: "datetime", Default: sql.NullString{String: "CURRENT_TIMESTAMP(3)", Valid: true}}, expected: "CURRENT_TIMESTAMP(3)"},
+		{col: column{DataType: "date", Default: sql.NullString{String: "2020-01-01", Valid: true}}, expected: "'2020-01-01'"},
+		{col: column{DataType: "varchar", Extra: "DEFAULT_GENERATED", Default: sql.NullString{String: "uuid()", Valid: true}}, expected: "uuid()"},
+	}
+	for _, one := range cases {
+		if got := columnDefault(&one.col); got != one.expected {
+			t.Errorf("%s: got %s, want %s", one.col.Default.String, got, one.expected)
+		}
+	}
+}
+
+func TestTemplateTable(t *testing.T) {
+	t2s := &Table2Struct{config: new(T2tConfig), prefix: "t_", packageName: "model", realNameMethod: "TableName"}
+	data := t2s.templateTable("t_user_info", "用户", []column{
+		{ColumnName: "Id", RawName: "id", Type: "int64", ColumnKey: "PRI"},
+		{ColumnName: "Type", RawName: "type", Type: "*string"},
+	})
+	if data.StructName != "UserInfo" || data.TableName != "t_user_info" || data.Comment != "用户" || len(data.Columns) != 2 {
+		t.Fatalf("%+v", data)
+	}
+	if data.PrimaryKey == nil || data.PrimaryKey.Name != "Id" || data.PrimaryKey.VarName != "id" {
+		t.Errorf("primary key: %+v", data.PrimaryKey)
+	}
+	if col := data.Columns[1]; col.VarName != "typeValue" || col.BaseType != "string" || col.ColumnName != "type" {
+		t.Errorf("%+v", col)
+	}
+
+	data = t2s.templateTable("t_relation", "", []column{
+		{ColumnName: "UserId", RawName: "user_id", Type: "int64", ColumnKey: "PRI"},
+		{ColumnName: "GroupId", RawName: "group_id", Type: "int64", ColumnKey: "PRI"},
+	})
+	if data.PrimaryKey != nil {
+		t.Error("composite primary key should not set PrimaryKey")
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	t2s := &Table2Struct{packageName: "model"}
+	file, err := t2s.newFile("user.go", `
+// User 用户, 记录 last login time. 和 sql.Null 的说明
+type User struct {
+	Id   int64  `+"`xorm:\"'id'\"`"+`
+	Name string `+"`xorm:\"'name'\"`"+`
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(file.Content, "import") {
+		t.Errorf("comments should not add imports:\n%s", file.Content)
+	}
+	if !strings.HasPrefix(file.Content, GeneratedHeader+"\n\npackage model\n") || file.Name != "user.go" {
+		t.Errorf("%s\n%s", file.Name, file.Content)
+	}
+
+	t2s.Imports("fmt")
+	file, err = t2s.newFile("order.go", `
+type Order struct {
+	Amount    decimal.Decimal
+	Remark    sql.NullString
+	CreatedAt *time.Time
+}
+
+func (o *Order) String() string {
+	return fmt.Sprint(o.Amount)
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range []string{`"database/sql"`, `"fmt"`, `"github.com/shopspring/decimal"`, `"time"`} {
+		if !strings.Contains(file.Content, pkg) {
+			t.Errorf("missing import %s:\n%s", pkg, file.Content)
+		}
+	}
+	if strings.Contains(file.Content, `"encoding/json"`) {
+		t.Errorf("unused import:\n%s", file.Content)
+	}
+
+	if _, err = t2s.newFile("bad.go", "type Bad struct {"); err == nil {
+		t.Error("invalid code should fail")
+	}
+}
+
+func TestMatchTable(t *testing.T) {
+	t2s := &Table2Struct{prefix: "t_"}
+	if !t2s.matchTable("t_user") {
+		t.Error("no pattern should match all")
+	}
+	t2s.Include("user*", "t_order")
+	t2s.Exclude("*_log")
+	cases := map[string]bool{
+		"t_user":     true,
+		"t_user_log": false,
+		"t_order":    true,
+		"t_goods":    false,
+	}
+	for name, expected := range cases {
+		if got := t2s.matchTable(name); got != expected {
+			t.Errorf("%s: got %v, want %v", name, got, expected)
+		}
+	}
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	t2s := &Table2Struct{config: new(T2tConfig), packageName: "model", realNameMethod: "TableName"}
+	tpl, err := t2s.parseTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := t2s.templateTable("user", "记录 last login time.", []column{
+		{ColumnName: "Id", RawName: "id", Type: "int64", ColumnKey: "PRI", Tag: "`xorm:\"'id' pk\"`"},
+		{ColumnName: "Name", RawName: "name", Type: "string", Tag: "`xorm:\"'name'\"`"},
+	})
+	var body strings.Builder
+	if err = tpl.ExecuteTemplate(&body, modelTemplateName, data); err != nil {
+		t.Fatal(err)
+	}
+	file, err := t2s.newFile("user.go", body.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(file.Content, "import") {
+		t.Errorf("model without time columns should not import:\n%s", file.Content)
+	}
+
+	if err = tpl.ExecuteTemplate(&body, daoTemplateName, data); err != nil {
+		t.Fatal(err)
+	}
+	file, err = t2s.newFile("user.go", body.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range []string{`"context"`, `"github.com/magic-lib/go-plat-mysql/xorms"`, `"github.com/magic-lib/go-plat-startupcfg/startupcfg"`} {
+		if !strings.Contains(file.Content, pkg) {
+			t.Errorf("missing import %s:\n%s", pkg, file.Content)
+		}
+	}
+	if !strings.Contains(file.Content, "func (d *UserDao) GetById(ctx context.Context, id int64) (*User, error)") {
+		t.Errorf("primary key methods:\n%s", file.Content)
+	}
+}
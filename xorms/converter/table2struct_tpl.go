@@ -0,0 +1,82 @@
+package converter
+
+// DefaultModelTemplate 默认的model模板, 生成struct和获取真实表名的方法, 数据为 TemplateTable
+const DefaultModelTemplate = `
+{{- if .Comment}}// {{.StructName}} {{.Comment}}
+{{else}}// {{.StructName}} 表 {{.TableName}}
+{{end -}}
+type {{.StructName}} struct {
+{{- range .Columns}}
+	{{.Name}} {{.Type}} {{.Tag}}{{if .Comment}} // {{.Comment}}{{end}}
+{{- end}}
+}
+{{if .RealNameMethod}}
+// {{.RealNameMethod}} 真实表名
+func (*{{.StructName}}) {{.RealNameMethod}}() string {
+	return "{{.TableName}}"
+}
+{{end}}`
+
+// DefaultDaoTemplate 默认的数据访问模板, 生成嵌入 xorms.Dao 的仓库和增删改查方法, 数据为 TemplateTable
+const DefaultDaoTemplate = `
+// {{.StructName}}Dao 表 {{.TableName}} 的数据访问
+type {{.StructName}}Dao struct {
+	xorms.Dao
+}
+
+// New{{.StructName}}Dao 新建表 {{.TableName}} 的数据访问对象
+func New{{.StructName}}Dao(ctx context.Context, con *startupcfg.MysqlConfig) (*{{.StructName}}Dao, error) {
+	dao := new({{.StructName}}Dao)
+	if _, err := xorms.InitXormEngine(ctx, dao, con); err != nil {
+		return nil, err
+	}
+	return dao, nil
+}
+
+// Create 新增记录
+func (d *{{.StructName}}Dao) Create(ctx context.Context, info *{{.StructName}}) (int64, error) {
+	return d.InsertContext(ctx, info)
+}
+
+// FindOne 按条件获取一条记录, 不存在时返回nil
+func (d *{{.StructName}}Dao) FindOne(ctx context.Context, whereStr string, args ...any) (*{{.StructName}}, error) {
+	info := new({{.StructName}})
+	has, err := d.GetWhereContext(ctx, whereStr, args, info)
+	if err != nil || !has {
+		return nil, err
+	}
+	return info, nil
+}
+
+// UpdateBy 按条件更新, columns 为空时更新非零值字段
+func (d *{{.StructName}}Dao) UpdateBy(ctx context.Context, whereStr string, args []any, info *{{.StructName}}, columns ...string) (int64, error) {
+	return d.UpdateWhereContext(ctx, whereStr, args, info, columns...)
+}
+
+// DeleteBy 按条件删除
+func (d *{{.StructName}}Dao) DeleteBy(ctx context.Context, whereStr string, args ...any) (int64, error) {
+	return d.DeleteWhereContext(ctx, whereStr, args, new({{.StructName}}))
+}
+{{- with .PrimaryKey}}
+
+// GetBy{{.Name}} 按主键获取, 不存在时返回nil
+func (d *{{$.StructName}}Dao) GetBy{{.Name}}(ctx context.Context, {{.VarName}} {{.BaseType}}) (*{{$.StructName}}, error) {
+	info := new({{$.StructName}})
+	has, err := d.GetContext(ctx, {{.VarName}}, info)
+	if err != nil || !has {
+		return nil, err
+	}
+	return info, nil
+}
+
+// UpdateBy{{.Name}} 按主键更新, columns 为空时更新非零值字段
+func (d *{{$.StructName}}Dao) UpdateBy{{.Name}}(ctx context.Context, {{.VarName}} {{.BaseType}}, info *{{$.StructName}}, columns ...string) (int64, error) {
+	return d.UpdateContext(ctx, {{.VarName}}, info, columns...)
+}
+
+// DeleteBy{{.Name}} 按主键删除
+func (d *{{$.StructName}}Dao) DeleteBy{{.Name}}(ctx context.Context, {{.VarName}} {{.BaseType}}) (int64, error) {
+	return d.DeleteContext(ctx, {{.VarName}}, new({{$.StructName}}))
+}
+{{- end}}
+`
@@ -4,13 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
 	"github.com/magic-lib/go-plat-mysql/sqlstatement"
 	"github.com/magic-lib/go-plat-startupcfg/startupcfg"
-	"github.com/magic-lib/go-plat-utils/cond"
 	"github.com/magic-lib/go-plat-utils/conv"
 	"github.com/magic-lib/go-plat-utils/logs"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"xorm.io/core"
 	"xorm.io/xorm"
 )
@@ -20,10 +20,17 @@ type Dao struct {
 	once    sync.Once
 	connect *startupcfg.MysqlConfig
 	ctx     context.Context
-	engine  *xorm.Engine
-	//如果有事务，则将使用
-	daoSessionLock sync.Mutex
-	daoSession     *xorm.Session
+	handle  *EngineHandle
+	//一主多从时的engine组，handle为主库
+	groupHandle *EngineGroupHandle
+	forceMaster bool
+	//TransAction 的事务ctx，回调中不传ctx的方法通过 getCtx 加入该事务
+	transLock sync.Mutex
+	transCtx  atomic.Pointer[context.Context]
+	//不在事务中时，SqlQuery、SqlExec 遇到死锁、连接断开等错误时按策略重试
+	retryPolicy *sqlcomm.RetryPolicy
+	//SqlQuery 的执行计划分析，为nil时使用全局的 SetExplainSql 开关
+	explainAnalyzer *sqlcomm.ExplainAnalyzer
 }
 
 // TransCallback 事务回调函数
@@ -31,28 +38,66 @@ type TransCallback func(*xorm.Session) error
 
 var (
 	defaultAllEngines = NewEnginePool() //全局使用
+	// ErrStaleVersion 乐观锁版本号已变化，更新时没有影响任何记录
+	ErrStaleVersion = sqlstatement.ErrStaleVersion
 )
 
 // SetTableSuffix 设置表的后缀，table_1, table_2等
 func (m *Dao) SetTableSuffix(suffix string) {
 	tbMapper := core.NewSuffixMapper(core.GonicMapper{}, suffix)
-	m.engine.SetTableMapper(tbMapper)
+	m.configure("tableMapper", func(engine *xorm.Engine) {
+		engine.SetTableMapper(tbMapper)
+	})
 }
 
 // SetTableTagIdentifier 设置表的tag名称，默认为"xorm"
 func (m *Dao) SetTableTagIdentifier(tagName string) {
-	m.engine.SetTagIdentifier(tagName)
+	m.configure("tagIdentifier", func(engine *xorm.Engine) {
+		engine.SetTagIdentifier(tagName)
+	})
+}
+
+// SetRetryPolicy 设置重试策略，为nil时不重试，事务中的语句不会单独重试
+func (m *Dao) SetRetryPolicy(policy *sqlcomm.RetryPolicy) {
+	m.retryPolicy = policy
+}
+
+// SetExplainAnalyzer 设置执行计划分析器，多个Dao可以共用一个分析器，按语句指纹去重
+func (m *Dao) SetExplainAnalyzer(analyzer *sqlcomm.ExplainAnalyzer) {
+	m.explainAnalyzer = analyzer
+}
+
+// withRetry 按重试策略执行，没有设置或在事务中时只执行一次
+func (m *Dao) withRetry(ctx context.Context, fn func() error) error {
+	if m.retryPolicy == nil || m.transSession(ctx) != nil {
+		return fn()
+	}
+	return sqlcomm.Retry(ctx, m.retryPolicy, func(context.Context) error {
+		return fn()
+	})
 }
 
 // SetLogger 设置日志
 func (m *Dao) SetLogger(loggerOld any) {
 	logger := setXormLogger(loggerOld)
 	//一个链接只需要执行一次
-	if logger != nil {
-		m.engine.SetLogger(logger)
-		m.engine.ShowSQL(true)
-	} else {
-		m.engine.ShowSQL(false)
+	m.configure("logger", func(engine *xorm.Engine) {
+		if logger != nil {
+			engine.SetLogger(logger)
+		}
+		//语句由 sqlcomm 的审计打印慢查询、错误和采样，不再逐条打印
+		engine.ShowSQL(false)
+	})
+}
+
+// configure 设置主库和所有从库的engine，重连后会重新执行
+func (m *Dao) configure(name string, fn func(*xorm.Engine)) {
+	m.handle.Configure(name, fn)
+	if m.groupHandle == nil {
+		return
+	}
+	for _, one := range m.groupHandle.Slaves() {
+		one.Configure(name, fn)
 	}
 }
 
@@ -63,14 +108,14 @@ func (m *Dao) setLogger() {
 
 // initDB 初始化连接，内部
 func (m *Dao) initDB(ctx context.Context, co *startupcfg.MysqlConfig) (*Dao, error) {
-	engine, err := defaultAllEngines.GetEngine(co)
+	handle, err := defaultAllEngines.GetEngineHandle(co)
 	if err != nil {
 		return nil, err
 	}
-	if engine == nil {
+	if handle == nil {
 		return nil, fmt.Errorf("engine get nil: %s", conv.String(co))
 	}
-	m.engine = engine
+	m.handle = handle
 	m.connect = co
 	m.ctx = ctx
 
@@ -81,124 +126,224 @@ func (m *Dao) initDB(ctx context.Context, co *startupcfg.MysqlConfig) (*Dao, err
 	return m, nil
 }
 
+// initDBGroup 一主多从的初始化，内部
+func (m *Dao) initDBGroup(ctx context.Context, co *MysqlGroupConfig) (*Dao, error) {
+	group, err := defaultAllEngines.GetEngineGroupHandle(co)
+	if err != nil {
+		return nil, err
+	}
+	m.groupHandle = group
+	m.handle = group.Master()
+	m.connect = co.Master
+	m.ctx = ctx
+
+	m.once.Do(func() {
+		//默认打印
+		m.SetLogger(logs.DefaultLogger())
+	})
+	return m, nil
+}
+
+// UseMaster 返回查询也走主库的Dao，用于写后立即读的场景，不影响原对象
+func (m *Dao) UseMaster() *Dao {
+	return &Dao{
+		connect:         m.connect,
+		ctx:             m.ctx,
+		handle:          m.handle,
+		groupHandle:     m.groupHandle,
+		forceMaster:     true,
+		retryPolicy:     m.retryPolicy,
+		explainAnalyzer: m.explainAnalyzer,
+	}
+}
+
+// readEngine 查询使用的engine，一主多从时走从库，强制主库时走主库
+func (m *Dao) readEngine(ctx context.Context) *xorm.Engine {
+	if m.groupHandle == nil || m.forceMaster || IsForceMaster(ctx) || IsForceMaster(m.ctx) {
+		return m.masterEngine()
+	}
+	return m.groupHandle.Group().Slave()
+}
+
+// getCtx 没有传入ctx时，在 TransAction 中使用事务的ctx，否则使用初始化时的ctx
+func (m *Dao) getCtx(ctx context.Context) context.Context {
+	if ctx != nil {
+		return ctx
+	}
+	if transCtx := m.transCtx.Load(); transCtx != nil {
+		return *transCtx
+	}
+	if m.ctx != nil {
+		return m.ctx
+	}
+	return context.Background()
+}
+
+// writeSession 写入使用的session，在事务中时使用事务的session
+func (m *Dao) writeSession(ctx context.Context) *xorm.Session {
+	if session := m.transSession(ctx); session != nil {
+		return session
+	}
+	return m.masterEngine().Context(ctx)
+}
+
+// readSession 查询使用的session，在事务中时使用事务的session
+func (m *Dao) readSession(ctx context.Context) *xorm.Session {
+	if session := m.transSession(ctx); session != nil {
+		return session
+	}
+	return m.readEngine(ctx).Context(ctx)
+}
+
+// masterEngine 主库当前的engine，重连后会变化，每次使用时获取
+func (m *Dao) masterEngine() *xorm.Engine {
+	return m.handle.Engine()
+}
+
 // GetEngine 动态获取Engine
 func (m *Dao) GetEngine() (*xorm.Engine, error) {
+	if m.groupHandle != nil {
+		return m.masterEngine(), nil
+	}
 	engine, err := defaultAllEngines.GetEngine(m.connect)
 	if err != nil {
 		return nil, err
 	}
 	if engine == nil {
-		return m.engine, nil
+		return m.masterEngine(), nil
 	}
 	return engine, nil
 }
 
 // Insert 新增，返回影响的条数和错误
 func (m *Dao) Insert(info ...any) (int64, error) {
-	if m.daoSession != nil {
-		return m.daoSession.Insert(info...)
-	}
-	return m.engine.Insert(info...)
+	return m.InsertContext(m.getCtx(nil), info...)
+}
+
+// InsertContext 新增，返回影响的条数和错误
+func (m *Dao) InsertContext(ctx context.Context, info ...any) (int64, error) {
+	return m.writeSession(m.getCtx(ctx)).Insert(info...)
 }
 
 // FlagDelete 逻辑删除
 func (m *Dao) FlagDelete(id int64, info any) (int64, error) {
-	if m.daoSession != nil {
-		return m.daoSession.ID(id).Delete(info)
-	}
-	return m.engine.ID(id).Delete(info)
+	return m.FlagDeleteContext(m.getCtx(nil), id, info)
+}
+
+// FlagDeleteContext 逻辑删除
+func (m *Dao) FlagDeleteContext(ctx context.Context, id int64, info any) (int64, error) {
+	return m.writeSession(m.getCtx(ctx)).ID(id).Delete(info)
 }
 
 // Delete 删除
 func (m *Dao) Delete(id any, info any) (int64, error) {
-	if m.daoSession != nil {
-		return m.daoSession.ID(id).Unscoped().Delete(info)
-	}
-	return m.engine.ID(id).Unscoped().Delete(info)
+	return m.DeleteContext(m.getCtx(nil), id, info)
 }
 
-// Update 更新
+// DeleteContext 删除
+func (m *Dao) DeleteContext(ctx context.Context, id any, info any) (int64, error) {
+	return m.writeSession(m.getCtx(ctx)).ID(id).Unscoped().Delete(info)
+}
+
+// Update 更新，有 xorm:"version" 字段时没有更新到记录会返回 ErrStaleVersion
 func (m *Dao) Update(id any, info any, columns ...string) (int64, error) {
-	if m.daoSession != nil {
-		sessionIns := m.daoSession.ID(id)
-		if len(columns) > 0 {
-			sessionIns = sessionIns.Cols(columns...)
-		}
-		return sessionIns.Update(info)
-	}
-	sessionIns := m.engine.ID(id)
+	return m.UpdateContext(m.getCtx(nil), id, info, columns...)
+}
+
+// UpdateContext 更新，有 xorm:"version" 字段时没有更新到记录会返回 ErrStaleVersion
+func (m *Dao) UpdateContext(ctx context.Context, id any, info any, columns ...string) (int64, error) {
+	sessionIns := m.writeSession(m.getCtx(ctx)).ID(id)
 	if len(columns) > 0 {
 		sessionIns = sessionIns.Cols(columns...)
 	}
-	return sessionIns.Update(info)
+	return m.checkVersion(info)(sessionIns.Update(info))
 }
 
 // Get 通过主键查询单个
 func (m *Dao) Get(id any, info any) (bool, error) {
-	if m.daoSession != nil {
-		return m.daoSession.ID(id).Get(info)
-	}
-	return m.engine.ID(id).Get(info)
+	return m.GetContext(m.getCtx(nil), id, info)
+}
+
+// GetContext 通过主键查询单个
+func (m *Dao) GetContext(ctx context.Context, id any, info any) (bool, error) {
+	return m.readSession(m.getCtx(ctx)).ID(id).Get(info)
 }
 
-// UpdateWhere 条件更新
+// UpdateWhere 条件更新，有 xorm:"version" 字段时没有更新到记录会返回 ErrStaleVersion
 func (m *Dao) UpdateWhere(whereStr string, argList []any, info any, columns ...string) (int64, error) {
-	if m.daoSession != nil {
-		sessionIns := m.daoSession.Where(whereStr, argList...)
-		if len(columns) > 0 {
-			sessionIns = sessionIns.Cols(columns...)
-		}
-		return sessionIns.Update(info)
-	}
-	sessionIns := m.engine.Where(whereStr, argList...)
+	return m.UpdateWhereContext(m.getCtx(nil), whereStr, argList, info, columns...)
+}
+
+// UpdateWhereContext 条件更新，有 xorm:"version" 字段时没有更新到记录会返回 ErrStaleVersion
+func (m *Dao) UpdateWhereContext(ctx context.Context, whereStr string, argList []any, info any, columns ...string) (int64, error) {
+	sessionIns := m.writeSession(m.getCtx(ctx)).Where(whereStr, argList...)
 	if len(columns) > 0 {
 		sessionIns = sessionIns.Cols(columns...)
 	}
-	return sessionIns.Update(info)
+	return m.checkVersion(info)(sessionIns.Update(info))
+}
+
+// checkVersion 表有乐观锁字段时，没有更新到记录返回 ErrStaleVersion
+func (m *Dao) checkVersion(info any) func(int64, error) (int64, error) {
+	return func(num int64, err error) (int64, error) {
+		if err != nil || num > 0 {
+			return num, err
+		}
+		if _, ok := info.(map[string]any); ok {
+			return num, err
+		}
+		tableInfo, tErr := m.masterEngine().TableInfo(info)
+		if tErr != nil || tableInfo == nil || tableInfo.Version == "" {
+			return num, err
+		}
+		return num, ErrStaleVersion
+	}
 }
 
 // DeleteWhere 条件删除
 func (m *Dao) DeleteWhere(whereStr string, argList []any, info any) (int64, error) {
-	if m.daoSession != nil {
-		return m.daoSession.Where(whereStr, argList...).Unscoped().Delete(info)
-	}
-	return m.engine.Where(whereStr, argList...).Unscoped().Delete(info)
+	return m.DeleteWhereContext(m.getCtx(nil), whereStr, argList, info)
+}
+
+// DeleteWhereContext 条件删除
+func (m *Dao) DeleteWhereContext(ctx context.Context, whereStr string, argList []any, info any) (int64, error) {
+	return m.writeSession(m.getCtx(ctx)).Where(whereStr, argList...).Unscoped().Delete(info)
 }
 
 // GetWhere 通过where查询单个
 func (m *Dao) GetWhere(whereStr string, argList []any, info any) (bool, error) {
-	if m.daoSession != nil {
-		return m.daoSession.Where(whereStr, argList...).Get(info)
-	}
-	return m.engine.Where(whereStr, argList...).Get(info)
+	return m.GetWhereContext(m.getCtx(nil), whereStr, argList, info)
 }
 
-// TransAction 事务
-func (m *Dao) TransAction(callback TransCallback) error {
-	session := m.engine.NewSession()
-	defer func(session *xorm.Session) {
-		_ = session.Close()
-	}(session)
+// GetWhereContext 通过where查询单个
+func (m *Dao) GetWhereContext(ctx context.Context, whereStr string, argList []any, info any) (bool, error) {
+	return m.readSession(m.getCtx(ctx)).Where(whereStr, argList...).Get(info)
+}
 
-	if err := session.Begin(); err != nil {
-		return fmt.Errorf("fail to session begin：" + err.Error())
+// TransAction 事务，回调中不传ctx的Dao方法（Insert、Update、Get等）和嵌套的 TransAction 都在该事务中执行，
+// 嵌套时使用 SAVEPOINT；同一个Dao上的 TransAction 共用一个事务，并发的事务请使用 TransActionContext
+func (m *Dao) TransAction(callback TransCallback, opts ...TransOption) error {
+	run := func(ctx context.Context, session *xorm.Session) error {
+		prev := m.transCtx.Swap(&ctx)
+		defer m.transCtx.Store(prev)
+		return callback(session)
 	}
-
-	m.daoSessionLock.Lock()
-	m.daoSession = session
-	err := callback(session)
-	m.daoSession = nil
-	m.daoSessionLock.Unlock()
-	if err != nil {
-		_ = session.Rollback()
-		return err
+	if transCtx := m.transCtx.Load(); transCtx != nil {
+		return m.TransActionContext(*transCtx, run, opts...)
 	}
-	return session.Commit()
+	m.transLock.Lock()
+	defer m.transLock.Unlock()
+	return m.TransActionContext(m.getCtx(nil), run, opts...)
 }
 
 // GetListByMap 通过对象查询列表
 func (m *Dao) GetListByMap(info map[string]any, bean any) ([]map[string]string, error) {
-	tableInfo, err := m.engine.TableInfo(bean)
+	return m.GetListByMapContext(m.getCtx(nil), info, bean)
+}
+
+// GetListByMapContext 通过对象查询列表
+func (m *Dao) GetListByMapContext(ctx context.Context, info map[string]any, bean any) ([]map[string]string, error) {
+	tableInfo, err := m.masterEngine().TableInfo(bean)
 	if err != nil {
 		return nil, err
 	}
@@ -215,7 +360,7 @@ func (m *Dao) GetListByMap(info map[string]any, bean any) ([]map[string]string,
 			newInfo[name] = val
 		}
 	}
-	tempStatement := m.engine.Table(bean)
+	tempStatement := m.readEngine(m.getCtx(ctx)).Context(m.getCtx(ctx)).Table(bean)
 
 	stat := new(sqlstatement.Statement)
 	whereString, dataList := stat.GenerateWhereClauseByMap(newInfo)
@@ -231,100 +376,42 @@ func (m *Dao) GetListByMap(info map[string]any, bean any) ([]map[string]string,
 	return retMap, nil
 }
 
-func (m *Dao) explainSqlHandle(sqlOrArgs ...any) {
-	if len(sqlOrArgs) == 0 {
-		return
-	}
-	sType := m.getStatementType(conv.String(sqlOrArgs[0]))
-	if sType != "SELECT" {
-		//不是查询语句不进行分析
-		return
-	}
-
-	oldSql := sqlOrArgs[0]
-
-	sqlOrArgs[0] = fmt.Sprintf("%s %s", "EXPLAIN", sqlOrArgs[0])
-	retList, err := m.engine.Query(sqlOrArgs...)
-	if err != nil {
-		logs.DefaultLogger().Error(sqlOrArgs[0], err.Error())
-		return
-	}
-	if len(retList) == 0 {
-		return
-	}
-	for _, one := range retList {
-		possibleKeys, ok1 := one["possible_keys"]
-		keys, ok2 := one["key"]
-		table, ok3 := one["table"]
-		if ok1 && ok2 {
-			useKey := false //是否使用了索引
-
-			keyStr := string(keys)
-			if keyStr != "" {
-				possibleKeyList := strings.Split(string(possibleKeys), ",")
-				keyList := strings.Split(keyStr, ",")
-				if len(keyList) > 0 {
-					for _, oneKey := range keyList {
-						if oneKey == "" {
-							continue
-						}
-						if ok, _ := cond.Contains(possibleKeyList, oneKey); ok {
-							useKey = true
-							break
-						}
-					}
-				}
-			}
-
-			if !useKey {
-				tableName := ""
-				if ok3 {
-					tableName = string(table)
-				}
-				logs.DefaultLogger().Error("has no select index:", oldSql, "|",
-					tableName, "|", string(possibleKeys), "|", keyStr)
-			}
+// explainSqlHandle 异步分析查询语句的执行计划，没有设置分析器时使用全局的 SetExplainSql 开关
+func (m *Dao) explainSqlHandle(ctx context.Context, sqlStr string, args []any) {
+	analyzer := m.explainAnalyzer
+	if analyzer == nil {
+		if !explainSql {
+			return
 		}
+		analyzer = getDefaultExplainAnalyzer()
 	}
-
-}
-
-func (m *Dao) getStatementType(sql string) string {
-	if len(sql) == 0 {
-		return ""
-	}
-
-	// 去除首尾空格并转换为大写
-	sql = strings.TrimSpace(strings.ToUpper(sql))
-
-	if strings.HasPrefix(sql, "SELECT") {
-		return "SELECT"
-	} else if strings.HasPrefix(sql, "INSERT") {
-		return "INSERT"
-	} else if strings.HasPrefix(sql, "UPDATE") {
-		return "UPDATE"
-	} else if strings.HasPrefix(sql, "DELETE") {
-		return "DELETE"
-	}
-
-	return ""
+	analyzer.Submit(ctx, sqlStr, args, sqlcomm.DbExplainJsonFunc(m.readEngine(ctx).DB().DB))
 }
 
 // SqlQuery sql查询
 func (m *Dao) SqlQuery(sqlStr string, args ...any) ([]map[string]string, error) {
+	return m.SqlQueryContext(m.getCtx(nil), sqlStr, args...)
+}
+
+// SqlQueryContext sql查询
+func (m *Dao) SqlQueryContext(ctx context.Context, sqlStr string, args ...any) ([]map[string]string, error) {
+	ctx = m.getCtx(ctx)
 	queryParam := make([]any, 0)
 	queryParam = append(queryParam, sqlStr)
 	if args != nil && len(args) > 0 {
 		queryParam = append(queryParam, args...)
 	}
-	retList, err := m.engine.Query(queryParam...)
+	var retList []map[string][]byte
+	err := m.withRetry(ctx, func() error {
+		var queryErr error
+		retList, queryErr = m.readSession(ctx).Query(queryParam...)
+		return queryErr
+	})
 	if err != nil {
-		logs.DefaultLogger().Error("SqlQuery Error:", err.Error(), sqlStr, m.engine)
+		logs.CtxLogger(ctx).Error("SqlQuery Error:", err.Error(), sqlStr, m.masterEngine())
 		return nil, err
 	}
-	if explainSql {
-		m.explainSqlHandle(queryParam...)
-	}
+	m.explainSqlHandle(ctx, sqlStr, args)
 
 	if retList == nil {
 		return []map[string]string{}, nil
@@ -342,18 +429,23 @@ func (m *Dao) SqlQuery(sqlStr string, args ...any) ([]map[string]string, error)
 
 // SqlExec sql更新
 func (m *Dao) SqlExec(sqlStr string, args ...any) (int64, error) {
+	return m.SqlExecContext(m.getCtx(nil), sqlStr, args...)
+}
+
+// SqlExecContext sql更新
+func (m *Dao) SqlExecContext(ctx context.Context, sqlStr string, args ...any) (int64, error) {
+	ctx = m.getCtx(ctx)
 	queryParam := make([]any, 0)
 	queryParam = append(queryParam, sqlStr)
 	if args != nil && len(args) > 0 {
 		queryParam = append(queryParam, args...)
 	}
 	var execResult sql.Result
-	var err error
-	if m.daoSession != nil {
-		execResult, err = m.daoSession.Exec(queryParam...)
-	} else {
-		execResult, err = m.engine.Exec(queryParam...)
-	}
+	err := m.withRetry(ctx, func() error {
+		var execErr error
+		execResult, execErr = m.writeSession(ctx).Exec(queryParam...)
+		return execErr
+	})
 
 	if err != nil {
 		return 0, err
@@ -371,3 +463,19 @@ func (m *Dao) SqlExec(sqlStr string, args ...any) (int64, error) {
 	}
 	return num, nil
 }
+
+// SqlStats 当前库中语句的执行统计，按总耗时倒序，需要打开 AuditConfig.Stats
+func (m *Dao) SqlStats() []sqlcomm.SqlStatSnapshot {
+	ret := make([]sqlcomm.SqlStatSnapshot, 0)
+	for _, one := range sqlcomm.DefaultSqlStats.Snapshot() {
+		if one.Database == m.connect.Database {
+			ret = append(ret, one)
+		}
+	}
+	return ret
+}
+
+// SqlStat 某条语句在当前库中的执行统计，sqlStr 可以是原始语句或指纹
+func (m *Dao) SqlStat(sqlStr string) (sqlcomm.SqlStatSnapshot, bool) {
+	return sqlcomm.DefaultSqlStats.Get(m.connect.Database, sqlStr)
+}
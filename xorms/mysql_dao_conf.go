@@ -1,5 +1,10 @@
 package xorms
 
+import (
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"sync"
+)
+
 var (
 	explainSql         = false                                       //执行分析索引命中的情况
 	operatorList       = []string{"LIKE", "=", ">=", ">", "<=", "<"} // 数据库支持的类型
@@ -7,7 +12,19 @@ var (
 	likeUseEscapeList  = []string{"/", "&", "#", "@", "^", "$", "!"} //定义可以使用的escape列表
 )
 
-// SetExplainSql 设置是否需要调试
+var (
+	defaultExplainAnalyzer     *sqlcomm.ExplainAnalyzer
+	defaultExplainAnalyzerOnce sync.Once
+)
+
+// SetExplainSql 设置是否需要调试，Dao没有单独设置 SetExplainAnalyzer 时使用默认配置分析
 func SetExplainSql(explain bool) {
 	explainSql = explain
 }
+
+func getDefaultExplainAnalyzer() *sqlcomm.ExplainAnalyzer {
+	defaultExplainAnalyzerOnce.Do(func() {
+		defaultExplainAnalyzer = sqlcomm.NewExplainAnalyzer(sqlcomm.DefaultExplainConfig)
+	})
+	return defaultExplainAnalyzer
+}
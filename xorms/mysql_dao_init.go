@@ -41,3 +41,23 @@ func InitXormEngine(ctx context.Context, child any, con *startupcfg.MysqlConfig,
 	}
 	return ret.GetEngine()
 }
+
+// InitXormEngineGroup 一主多从的初始化，查询走从库，写入和事务走主库
+func InitXormEngineGroup(ctx context.Context, child any, con *MysqlGroupConfig, isPanic ...bool) (*xorm.EngineGroup, error) {
+	obj, ok := child.(interface {
+		initDBGroup(ctx context.Context, co *MysqlGroupConfig) (*Dao, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("InitDatabase child error")
+	}
+	ret, err := obj.initDBGroup(ctx, con)
+	if ret == nil || err != nil {
+		logs.CtxLogger(ctx).Error("InitDatabase group error:", err)
+		if len(isPanic) >= 1 && isPanic[0] {
+			panic(any(con))
+		}
+		return nil, fmt.Errorf("InitDatabase group error: %w", err)
+	}
+	ret.setLogger()
+	return ret.groupHandle.Group(), nil
+}
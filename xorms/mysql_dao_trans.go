@@ -0,0 +1,221 @@
+package xorms
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xorm.io/xorm"
+)
+
+// TransCtxCallback 事务回调函数，ctx中带有事务，传给Dao的Context方法时会在该事务中执行
+type TransCtxCallback func(ctx context.Context, session *xorm.Session) error
+
+// TransOption 事务的配置，嵌套事务时不生效
+type TransOption func(*transOptions)
+
+type transOptions struct {
+	isolation sql.IsolationLevel
+	readOnly  bool
+	retry     *sqlcomm.RetryPolicy
+}
+
+// DefaultDeadlockRetryPolicy 事务死锁重试的默认策略
+var DefaultDeadlockRetryPolicy = &sqlcomm.RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   20 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// WithIsolationLevel 设置事务的隔离级别
+func WithIsolationLevel(level sql.IsolationLevel) TransOption {
+	return func(o *transOptions) {
+		o.isolation = level
+	}
+}
+
+// WithReadOnly 只读事务
+func WithReadOnly() TransOption {
+	return func(o *transOptions) {
+		o.readOnly = true
+	}
+}
+
+// WithDeadlockRetry 事务遇到死锁或锁等待超时时，回滚后按策略重新执行整个回调，policy 为nil时使用 DefaultDeadlockRetryPolicy
+// 只判断死锁错误，policy 的 Retryable 不生效；回调会被执行多次，不能有事务外的副作用，需要时使用 AfterCommit
+func WithDeadlockRetry(policy *sqlcomm.RetryPolicy) TransOption {
+	return func(o *transOptions) {
+		if policy == nil {
+			policy = DefaultDeadlockRetryPolicy
+		}
+		o.retry = policy
+	}
+}
+
+type transKey struct{}
+
+// transState ctx中保存的事务
+type transState struct {
+	handle       *EngineHandle
+	session      *xorm.Session
+	savepointSeq atomic.Int32
+	hookLock     sync.Mutex
+	afterCommit  []func(ctx context.Context)
+}
+
+func (s *transState) addHook(fn func(ctx context.Context)) {
+	s.hookLock.Lock()
+	defer s.hookLock.Unlock()
+	s.afterCommit = append(s.afterCommit, fn)
+}
+
+func (s *transState) hookLen() int {
+	s.hookLock.Lock()
+	defer s.hookLock.Unlock()
+	return len(s.afterCommit)
+}
+
+// truncateHooks 回滚到保存点时，丢弃保存点之后注册的回调
+func (s *transState) truncateHooks(n int) {
+	s.hookLock.Lock()
+	defer s.hookLock.Unlock()
+	if n < len(s.afterCommit) {
+		s.afterCommit = s.afterCommit[:n]
+	}
+}
+
+func transFromContext(ctx context.Context) *transState {
+	if ctx == nil {
+		return nil
+	}
+	state, _ := ctx.Value(transKey{}).(*transState)
+	return state
+}
+
+// InTransaction ctx中是否有事务
+func InTransaction(ctx context.Context) bool {
+	return transFromContext(ctx) != nil
+}
+
+// AfterCommit 注册事务提交成功后执行的函数，如发送消息；不在事务中时立即执行，事务回滚时不执行
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	if fn == nil {
+		return
+	}
+	state := transFromContext(ctx)
+	if state == nil {
+		fn(ctx)
+		return
+	}
+	state.addHook(fn)
+}
+
+// transSession ctx中属于当前数据库的事务session
+func (m *Dao) transSession(ctx context.Context) *xorm.Session {
+	if state := transFromContext(ctx); state != nil && state.handle == m.handle {
+		return state.session
+	}
+	return nil
+}
+
+// TransActionContext 事务，ctx中已经有同一个数据库的事务时，使用 SAVEPOINT 嵌套执行，出错时只回滚到保存点
+func (m *Dao) TransActionContext(ctx context.Context, callback TransCtxCallback, opts ...TransOption) error {
+	ctx = m.getCtx(ctx)
+	if state := transFromContext(ctx); state != nil && state.handle == m.handle {
+		return m.savepointTrans(ctx, state, callback)
+	}
+
+	options := new(transOptions)
+	for _, opt := range opts {
+		opt(options)
+	}
+	ctx, span := sqlcomm.StartSpan(ctx, "mysql transaction", sqlcomm.AttrDbSystem.String("mysql"))
+	err := m.retryTrans(ctx, callback, options)
+	sqlcomm.EndSpan(span, err)
+	return err
+}
+
+// retryTrans 按死锁重试的配置执行事务
+func (m *Dao) retryTrans(ctx context.Context, callback TransCtxCallback, options *transOptions) error {
+	if options.retry == nil {
+		return m.runTrans(ctx, callback, options)
+	}
+
+	policy := *options.retry
+	policy.Retryable = sqlcomm.IsDeadlockError
+	onRetry := options.retry.OnRetry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		m.masterEngine().Logger().Warnf("[SQL] transaction deadlock, attempt %d, retry after %s: %s", attempt, delay, err.Error())
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+	}
+	// 事务使用原来的ctx，Budget 只限制重试的等待
+	return sqlcomm.Retry(ctx, &policy, func(context.Context) error {
+		return m.runTrans(ctx, callback, options)
+	})
+}
+
+// runTrans 执行一次事务
+func (m *Dao) runTrans(ctx context.Context, callback TransCtxCallback, options *transOptions) error {
+	session := m.masterEngine().NewSession()
+	defer func(session *xorm.Session) {
+		_ = session.Close()
+	}(session)
+
+	if err := beginTrans(ctx, session, options); err != nil {
+		return fmt.Errorf("fail to session begin：%w", err)
+	}
+
+	state := &transState{
+		handle:  m.handle,
+		session: session,
+	}
+	err := callback(context.WithValue(ctx, transKey{}, state), session)
+	if err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	if err = session.Commit(); err != nil {
+		return err
+	}
+	for _, fn := range state.afterCommit {
+		fn(ctx)
+	}
+	return nil
+}
+
+// savepointTrans 嵌套事务
+func (m *Dao) savepointTrans(ctx context.Context, state *transState, callback TransCtxCallback) error {
+	name := fmt.Sprintf("sp_%d", state.savepointSeq.Add(1))
+	if _, err := state.session.Exec("SAVEPOINT " + name); err != nil {
+		return fmt.Errorf("fail to savepoint %s：%w", name, err)
+	}
+	hookLen := state.hookLen()
+	err := callback(ctx, state.session)
+	if err != nil {
+		if _, rbErr := state.session.Exec("ROLLBACK TO SAVEPOINT " + name); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("fail to rollback to savepoint %s：%w", name, rbErr))
+		}
+		state.truncateHooks(hookLen)
+		return err
+	}
+	if _, err = state.session.Exec("RELEASE SAVEPOINT " + name); err != nil {
+		return fmt.Errorf("fail to release savepoint %s：%w", name, err)
+	}
+	return nil
+}
+
+// beginTrans 开启事务，隔离级别和只读通过ctx传给连接，由驱动在开启事务时设置
+func beginTrans(ctx context.Context, session *xorm.Session, options *transOptions) error {
+	session.Context(withTxOptions(ctx, options))
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	session.Context(ctx)
+	return nil
+}
@@ -0,0 +1,160 @@
+package xorms
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/magic-lib/go-plat-mysql/internal/fakedb"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"strings"
+	"testing"
+	"xorm.io/xorm"
+	"xorm.io/xorm/core"
+)
+
+// fakeDB 记录语句和事务的驱动，不连接数据库，查询返回 queryRows 行 id
+type fakeDB struct {
+	*fakedb.DB
+	queryRows int
+}
+
+func (db *fakeDB) handle(string, []driver.NamedValue) (*fakedb.Rows, error) {
+	ret := &fakedb.Rows{Columns: []string{"id"}, Types: []string{"BIGINT"}}
+	for i := 1; i <= db.queryRows; i++ {
+		ret.Values = append(ret.Values, []driver.Value{int64(i)})
+	}
+	return ret, nil
+}
+
+func newFakeDao(t *testing.T) (*Dao, *fakeDB) {
+	t.Helper()
+	db := new(fakeDB)
+	db.DB = fakedb.New(db.handle)
+	sqlDB := sql.OpenDB(&rowsCountingConnector{Connector: &txOptionsConnector{Connector: db.DB}})
+	engine, err := xorm.NewEngineWithDB("mysql", "root@tcp(127.0.0.1:3306)/test", core.FromDB(sqlDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.AddHook(newSqlAuditHook(sqlDB, "fake"))
+	t.Cleanup(func() { _ = engine.Close() })
+	return &Dao{handle: newEngineHandle("test", "test", engine)}, db
+}
+
+func TestTransActionOptions(t *testing.T) {
+	dao, db := newFakeDao(t)
+	err := dao.TransActionContext(context.Background(), func(ctx context.Context, session *xorm.Session) error {
+		return nil
+	}, WithIsolationLevel(sql.LevelSerializable), WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txOpts := db.TxOptions(); len(txOpts) != 1 || txOpts[0].Isolation != driver.IsolationLevel(sql.LevelSerializable) || !txOpts[0].ReadOnly {
+		t.Fatalf("tx options: %+v", txOpts)
+	}
+	if got := strings.Join(db.Queries(), ";"); got != "BEGIN;COMMIT" {
+		t.Errorf("statements: %s", got)
+	}
+}
+
+func TestTransActionSavepoint(t *testing.T) {
+	dao, db := newFakeDao(t)
+	innerErr := errors.New("inner")
+	err := dao.TransActionContext(context.Background(), func(ctx context.Context, session *xorm.Session) error {
+		if dao.transSession(ctx) != session {
+			t.Error("ctx should carry the transaction session")
+		}
+		if dao.transSession(context.Background()) != nil {
+			t.Error("ctx without transaction should not join it")
+		}
+		if err := dao.TransActionContext(ctx, func(context.Context, *xorm.Session) error {
+			return innerErr
+		}); !errors.Is(err, innerErr) {
+			t.Errorf("inner error: %v", err)
+		}
+		return dao.TransActionContext(ctx, func(context.Context, *xorm.Session) error {
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "BEGIN;SAVEPOINT sp_1;ROLLBACK TO SAVEPOINT sp_1;SAVEPOINT sp_2;RELEASE SAVEPOINT sp_2;COMMIT"
+	if got := strings.Join(db.Queries(), ";"); got != want {
+		t.Errorf("statements: %s", got)
+	}
+}
+
+func TestTransActionDeadlockRetry(t *testing.T) {
+	policy := &sqlcomm.RetryPolicy{MaxAttempts: 3}
+	for _, number := range []uint16{1213, 1205} {
+		dao, db := newFakeDao(t)
+		calls := 0
+		err := dao.TransActionContext(context.Background(), func(context.Context, *xorm.Session) error {
+			calls++
+			if calls < 3 {
+				return &mysql.MySQLError{Number: number, Message: "lock"}
+			}
+			return nil
+		}, WithDeadlockRetry(policy))
+		if err != nil || calls != 3 {
+			t.Errorf("%d: calls %d, err %v", number, calls, err)
+		}
+		want := "BEGIN;ROLLBACK;BEGIN;ROLLBACK;BEGIN;COMMIT"
+		if got := strings.Join(db.Queries(), ";"); got != want {
+			t.Errorf("%d statements: %s", number, got)
+		}
+	}
+
+	dao, _ := newFakeDao(t)
+	calls := 0
+	dupErr := &mysql.MySQLError{Number: 1062, Message: "duplicate"}
+	err := dao.TransActionContext(context.Background(), func(context.Context, *xorm.Session) error {
+		calls++
+		return dupErr
+	}, WithDeadlockRetry(policy))
+	if !errors.Is(err, dupErr) || calls != 1 {
+		t.Errorf("calls %d, err %v", calls, err)
+	}
+
+	calls = 0
+	err = dao.TransActionContext(context.Background(), func(context.Context, *xorm.Session) error {
+		calls++
+		return &mysql.MySQLError{Number: 1213, Message: "deadlock"}
+	}, WithDeadlockRetry(policy))
+	if !sqlcomm.IsDeadlockError(err) || calls != 3 {
+		t.Errorf("calls %d, err %v", calls, err)
+	}
+}
+
+func TestTransActionLegacyJoin(t *testing.T) {
+	dao, db := newFakeDao(t)
+	err := dao.TransAction(func(session *xorm.Session) error {
+		if dao.transSession(dao.getCtx(nil)) != session {
+			t.Error("methods without ctx should join TransAction")
+		}
+		if dao.transSession(context.Background()) != nil {
+			t.Error("explicit ctx without transaction should not join it")
+		}
+		if _, err := dao.SqlExec("UPDATE t SET a = 1"); err != nil {
+			return err
+		}
+		return dao.TransAction(func(inner *xorm.Session) error {
+			if inner != session {
+				t.Error("nested TransAction should share the session")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dao.transCtx.Load() != nil || dao.transSession(dao.getCtx(nil)) != nil {
+		t.Error("transaction ctx should be cleared")
+	}
+	want := "BEGIN;UPDATE t SET a = 1;SAVEPOINT sp_1;RELEASE SAVEPOINT sp_1;COMMIT"
+	if got := strings.Join(db.Queries(), ";"); got != want {
+		t.Errorf("statements: %s", got)
+	}
+}
@@ -1,6 +1,7 @@
 package xorms
 
 import (
+	"context"
 	"fmt"
 	"github.com/magic-lib/go-plat-utils/logs"
 	xormlog "xorm.io/xorm/log"
@@ -41,6 +42,27 @@ func (x *xormLogger) getLogger() logs.ILogger {
 	return logger
 }
 
+// ctxLogger 语句带有ctx时使用ctx中的日志，可以打印出trace id
+func (x *xormLogger) ctxLogger(ctx context.Context) logs.ILogger {
+	if ctx == nil || ctx == context.Background() || ctx == context.TODO() {
+		return x.getLogger()
+	}
+	return logs.CtxLogger(ctx)
+}
+
+// BeforeSQL 执行sql前
+func (x *xormLogger) BeforeSQL(_ xormlog.LogContext) {}
+
+// AfterSQL 执行sql后，使用语句的ctx打印
+func (x *xormLogger) AfterSQL(lc xormlog.LogContext) {
+	logger := x.ctxLogger(lc.Ctx)
+	if lc.Err != nil {
+		logger.Error("[SQL]", lc.SQL, lc.Args, "-", lc.ExecuteTime, lc.Err.Error())
+		return
+	}
+	logger.Info("[SQL]", lc.SQL, lc.Args, "-", lc.ExecuteTime)
+}
+
 // Debug 调试
 func (x *xormLogger) Debug(v ...any) {
 	x.getLogger().Debug(v...)
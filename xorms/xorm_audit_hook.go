@@ -0,0 +1,113 @@
+package xorms
+
+import (
+	"context"
+	"database/sql"
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"time"
+	"xorm.io/xorm/contexts"
+)
+
+// sqlAuditHook 将xorm执行的语句交给 sqlcomm 统一审计，并生成span
+type sqlAuditHook struct {
+	dbName  string
+	explain sqlcomm.ExplainFunc
+}
+
+type sqlSpanKey struct{}
+
+type rowsCounterKey struct{}
+
+// rowsCounter 查询返回的行数，结果集关闭后才知道，审计延后到关闭时
+type rowsCounter struct {
+	lock     sync.Mutex
+	attached bool
+	closed   bool
+	rows     int64
+	onClose  func(rows int64)
+}
+
+// attach 结果集由 countingRows 统计
+func (c *rowsCounter) attach() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.attached = true
+}
+
+func (c *rowsCounter) close(rows int64) {
+	c.lock.Lock()
+	c.closed = true
+	c.rows = rows
+	fn := c.onClose
+	c.lock.Unlock()
+	if fn != nil {
+		fn(rows)
+	}
+}
+
+// afterClose 结果集关闭后执行，没有统计行数时返回false
+func (c *rowsCounter) afterClose(fn func(rows int64)) bool {
+	c.lock.Lock()
+	if !c.attached {
+		c.lock.Unlock()
+		return false
+	}
+	if !c.closed {
+		c.onClose = fn
+		c.lock.Unlock()
+		return true
+	}
+	rows := c.rows
+	c.lock.Unlock()
+	fn(rows)
+	return true
+}
+
+func newSqlAuditHook(db *sql.DB, dbName string) *sqlAuditHook {
+	return &sqlAuditHook{
+		dbName:  dbName,
+		explain: sqlcomm.DbExplainFunc(db),
+	}
+}
+
+// BeforeProcess 执行前开始span，父span来自Dao传入的ctx
+func (h *sqlAuditHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	ctx, span := sqlcomm.StartSqlSpan(c.Ctx, h.dbName, c.SQL)
+	ctx = context.WithValue(ctx, rowsCounterKey{}, new(rowsCounter))
+	return context.WithValue(ctx, sqlSpanKey{}, span), nil
+}
+
+// AfterProcess 执行后结束span并审计，查询语句在结果集关闭后审计，记录返回的行数
+func (h *sqlAuditHook) AfterProcess(c *contexts.ContextHook) error {
+	rowsAffected := int64(-1)
+	if c.Result != nil {
+		if num, err := c.Result.RowsAffected(); err == nil {
+			rowsAffected = num
+		}
+	}
+	if span, ok := c.Ctx.Value(sqlSpanKey{}).(trace.Span); ok {
+		sqlcomm.EndSqlSpan(span, rowsAffected, c.Err)
+	}
+	audit := &sqlcomm.SqlAudit{
+		Ctx:          c.Ctx,
+		Database:     h.dbName,
+		Sql:          c.SQL,
+		Args:         c.Args,
+		StartTime:    time.Now().Add(-c.ExecuteTime),
+		Duration:     c.ExecuteTime,
+		RowsAffected: rowsAffected,
+		Err:          c.Err,
+	}
+	if counter, ok := c.Ctx.Value(rowsCounterKey{}).(*rowsCounter); ok && c.Result == nil && c.Err == nil {
+		if counter.afterClose(func(rows int64) {
+			audit.RowsAffected = rows
+			sqlcomm.AuditSql(audit, h.explain)
+		}) {
+			return nil
+		}
+	}
+	sqlcomm.AuditSql(audit, h.explain)
+	return nil
+}
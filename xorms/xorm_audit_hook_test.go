@@ -0,0 +1,39 @@
+package xorms
+
+import (
+	"github.com/magic-lib/go-plat-mysql/sqlcomm"
+	"sync"
+	"testing"
+)
+
+func TestSqlAuditHookQueryRows(t *testing.T) {
+	var lock sync.Mutex
+	audits := make(map[string]int64)
+	sqlcomm.AddAuditHook(func(audit *sqlcomm.SqlAudit) {
+		if audit.Database != "fake" {
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		audits[audit.Sql] = audit.RowsAffected
+	})
+
+	dao, db := newFakeDao(t)
+	db.queryRows = 3
+	list, err := dao.masterEngine().QueryString("SELECT id FROM audit_rows")
+	if err != nil || len(list) != 3 {
+		t.Fatal(list, err)
+	}
+	if _, err = dao.masterEngine().Exec("UPDATE audit_rows SET a = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if rows, ok := audits["SELECT id FROM audit_rows"]; !ok || rows != 3 {
+		t.Errorf("select rows: %d, %v", rows, ok)
+	}
+	if rows, ok := audits["UPDATE audit_rows SET a = 1"]; !ok || rows != 1 {
+		t.Errorf("update rows: %d, %v", rows, ok)
+	}
+}
@@ -1,32 +1,70 @@
 package xorms
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/magic-lib/go-plat-startupcfg/startupcfg"
 	"github.com/magic-lib/go-plat-utils/crypto"
 	"github.com/magic-lib/go-plat-utils/logs"
-	"log"
-	"runtime"
 	"sync"
 	"time"
 	"xorm.io/xorm"
+	"xorm.io/xorm/core"
 	//需要引入默认的mysql数据驱动
 	_ "github.com/go-sql-driver/mysql"
 	cmap "github.com/orcaman/concurrent-map/v2"
 )
 
+// PoolConfig 连接池配置，时间为毫秒数
+type PoolConfig struct {
+	MaxOpenConns          int   `json:"max_open_conns" yaml:"max_open_conns"`                     // 最大打开连接数，0为不限制
+	MaxIdleConns          int   `json:"max_idle_conns" yaml:"max_idle_conns"`                     // 最大空闲连接数
+	ConnMaxLifetimeMs     int64 `json:"conn_max_lifetime_ms" yaml:"conn_max_lifetime_ms"`         // 连接最大存活时间，0为不过期
+	ConnMaxIdleTimeMs     int64 `json:"conn_max_idle_time_ms" yaml:"conn_max_idle_time_ms"`       // 连接最大空闲时间，0为不过期
+	HealthCheckIntervalMs int64 `json:"health_check_interval_ms" yaml:"health_check_interval_ms"` // 检测连接的间隔，小于0时不检测
+}
+
+// msDuration 毫秒数转为时间
+func msDuration(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+// EngineStats 连接池状态
+type EngineStats struct {
+	Address  string
+	Database string
+	sql.DBStats
+}
+
+var (
+	// DefaultPoolConfig 没有单独设置时的连接池配置
+	DefaultPoolConfig = PoolConfig{
+		MaxIdleConns:          10,
+		ConnMaxLifetimeMs:     0, //设置 packets.go:123: closing bad idle connection: EOF
+		HealthCheckIntervalMs: (7 * time.Minute).Milliseconds(),
+	}
+)
+
 type allEngine struct {
-	engineList   cmap.ConcurrentMap[string, *xorm.Engine]            //保存了所有engine列表
-	connectList  cmap.ConcurrentMap[string, *startupcfg.MysqlConfig] //保存了所有连接
-	runCheckOnce sync.Once
-	lockMutex    sync.Mutex
-	initOnce     sync.Once
+	engineList  cmap.ConcurrentMap[string, *EngineHandle]           //保存了所有engine列表
+	connectList cmap.ConcurrentMap[string, *startupcfg.MysqlConfig] //保存了所有连接
+	groupList   cmap.ConcurrentMap[string, *EngineGroupHandle]      //一主多从的engine组
+	poolList    cmap.ConcurrentMap[string, *PoolConfig]             //每个连接单独的连接池配置
+	monitorList cmap.ConcurrentMap[string, chan struct{}]           //每个engine的检测协程，关闭后退出
+	lockMutex   sync.Mutex
+	initOnce    sync.Once
+
+	eventLock      sync.RWMutex
+	eventListeners []EngineEventListener
 }
 
 func (m *allEngine) init() {
 	m.initOnce.Do(func() {
-		m.engineList = cmap.New[*xorm.Engine]()
+		m.engineList = cmap.New[*EngineHandle]()
 		m.connectList = cmap.New[*startupcfg.MysqlConfig]()
+		m.groupList = cmap.New[*EngineGroupHandle]()
+		m.poolList = cmap.New[*PoolConfig]()
+		m.monitorList = cmap.New[chan struct{}]()
 	})
 }
 
@@ -37,8 +75,40 @@ func NewEnginePool() *allEngine {
 	return pool
 }
 
-// GetEngine 获取一个
+// SetPoolConfig 设置某个连接的连接池配置，engine已经创建时立即生效
+func (m *allEngine) SetPoolConfig(con *startupcfg.MysqlConfig, pool *PoolConfig) {
+	if con == nil || pool == nil {
+		return
+	}
+	m.init()
+	cacheKey := m.getCacheKey(con)
+	m.poolList.Set(cacheKey, pool)
+
+	m.lockMutex.Lock()
+	defer m.lockMutex.Unlock()
+	//单独的engine和engine组内的engine都生效
+	for _, handle := range m.engineList.Items() {
+		if handle.poolKey != cacheKey {
+			continue
+		}
+		handle.Configure("pool", func(engine *xorm.Engine) {
+			applyPoolConfig(engine, pool)
+		})
+		m.startMonitor(handle.key, msDuration(pool.HealthCheckIntervalMs))
+	}
+}
+
+// GetEngine 获取当前的engine，重连后会被替换，需要长期持有时使用 GetEngineHandle
 func (m *allEngine) GetEngine(con *startupcfg.MysqlConfig) (*xorm.Engine, error) {
+	handle, err := m.GetEngineHandle(con)
+	if err != nil {
+		return nil, err
+	}
+	return handle.Engine(), nil
+}
+
+// GetEngineHandle 获取engine的句柄，重连时底层engine会原子替换
+func (m *allEngine) GetEngineHandle(con *startupcfg.MysqlConfig) (*EngineHandle, error) {
 	if con == nil {
 		return nil, fmt.Errorf("con is nil")
 	}
@@ -54,98 +124,246 @@ func (m *allEngine) GetEngine(con *startupcfg.MysqlConfig) (*xorm.Engine, error)
 
 	m.lockMutex.Lock()
 	defer m.lockMutex.Unlock()
-	engine, err := m.getNewEngine(con)
+	if engineTemp, has = m.engineList.Get(cacheKey); has {
+		return engineTemp, nil
+	}
+	return m.newEngineHandle(cacheKey, con)
+}
+
+// newEngineHandle 新建engine并加入缓存，需要在lockMutex内调用
+func (m *allEngine) newEngineHandle(key string, con *startupcfg.MysqlConfig) (*EngineHandle, error) {
+	poolKey := m.getCacheKey(con)
+	pool := m.getPoolConfig(poolKey)
+	engine, err := m.getNewEngine(con, pool)
 	if err != nil {
 		return nil, err
 	}
 
-	m.engineList.Set(cacheKey, engine)
-	m.connectList.Set(cacheKey, con)
+	handle := newEngineHandle(key, poolKey, engine)
+	m.engineList.Set(key, handle)
+	m.connectList.Set(key, con)
 
-	//运行连接池里的检测，只需要执行一次
-	m.runCheckOnce.Do(func() {
-		m.monitorEngine()
-	})
+	//每个engine单独检测
+	m.startMonitor(key, msDuration(pool.HealthCheckIntervalMs))
 
-	return engine, nil
+	return handle, nil
+}
+
+// Stats 所有engine的连接池状态，key与缓存的key一致
+func (m *allEngine) Stats() map[string]EngineStats {
+	m.init()
+	statsMap := make(map[string]EngineStats)
+	for key, handle := range m.engineList.Items() {
+		oneStats := EngineStats{
+			DBStats: handle.Engine().DB().Stats(),
+		}
+		if con, has := m.connectList.Get(key); has {
+			oneStats.Address = con.Address
+			oneStats.Database = con.Database
+		}
+		statsMap[key] = oneStats
+	}
+	return statsMap
+}
+
+// CloseEngine 关闭并移除某个连接的engine，包含它的engine组也会移除
+func (m *allEngine) CloseEngine(con *startupcfg.MysqlConfig) error {
+	if con == nil {
+		return fmt.Errorf("con is nil")
+	}
+	m.init()
+	m.lockMutex.Lock()
+	defer m.lockMutex.Unlock()
+	cacheKey := m.getCacheKey(con)
+	var lastErr error
+	for key, handle := range m.engineList.Items() {
+		if handle.poolKey != cacheKey {
+			continue
+		}
+		if err := m.removeByKey(key); err != nil {
+			lastErr = err
+		}
+	}
+	m.connectList.Remove(cacheKey)
+	return lastErr
 }
 
-func (m *allEngine) getNewEngine(con *startupcfg.MysqlConfig) (*xorm.Engine, error) {
+// Close 关闭所有的engine，并停止检测
+func (m *allEngine) Close() error {
+	m.init()
+	m.lockMutex.Lock()
+	defer m.lockMutex.Unlock()
+	var lastErr error
+	for _, key := range m.engineList.Keys() {
+		if err := m.removeByKey(key); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (m *allEngine) getPoolConfig(cacheKey string) *PoolConfig {
+	if pool, has := m.poolList.Get(cacheKey); has && pool != nil {
+		return pool
+	}
+	pool := DefaultPoolConfig
+	return &pool
+}
+
+func applyPoolConfig(engine *xorm.Engine, pool *PoolConfig) {
+	// 设置连接池的最大空闲连接数
+	engine.SetMaxIdleConns(pool.MaxIdleConns)
+	// 设置连接池的最大打开连接数
+	engine.SetMaxOpenConns(pool.MaxOpenConns)
+	engine.SetConnMaxLifetime(msDuration(pool.ConnMaxLifetimeMs))
+	engine.SetConnMaxIdleTime(msDuration(pool.ConnMaxIdleTimeMs))
+}
+
+func (m *allEngine) getNewEngine(con *startupcfg.MysqlConfig, pool *PoolConfig) (*xorm.Engine, error) {
 	dsn := con.DatasourceName()
-	engine, err := xorm.NewEngine("mysql", dsn)
+	db, err := openMysqlDB(dsn)
 	if err != nil {
+		return nil, fmt.Errorf("open mysql error:%s", err.Error())
+	}
+	engine, err := xorm.NewEngineWithDB("mysql", dsn, core.FromDB(db))
+	if err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("xorm.NewEngine error:%s", err.Error())
 	}
 	err = engine.Ping()
 	if err != nil {
+		_ = engine.Close()
 		return nil, fmt.Errorf("engine ping error:%s", err.Error())
 	}
-
-	// 设置连接池的最大空闲连接数
-	engine.SetMaxIdleConns(10) //默认为2
-	// 设置连接池的最大打开连接数
-	//engine.SetMaxOpenConns(100) //默认无限
-	//engine.SetConnMaxLifetime(time.Minute * 3)
-	engine.SetConnMaxLifetime(0) //设置 packets.go:123: closing bad idle connection: EOF
+	applyPoolConfig(engine, pool)
+	engine.AddHook(newSqlAuditHook(engine.DB().DB, con.Database))
 	return engine, nil
 }
 
+// removeByKey 需要在lockMutex内调用，engine组内的engine会连同整个组一起移除
 func (m *allEngine) removeByKey(key string) error {
-	if engine, has := m.engineList.Get(key); has {
-		err := engine.Close()
+	if handle, has := m.engineList.Get(key); has && handle.group != nil {
+		return m.removeGroup(handle.group)
+	}
+	return m.removeHandle(key)
+}
+
+// removeGroup 移除engine组和组内所有的engine，需要在lockMutex内调用
+func (m *allEngine) removeGroup(group *EngineGroupHandle) error {
+	m.groupList.Remove(group.key)
+	var lastErr error
+	for _, one := range group.handles() {
+		if err := m.removeHandle(one.key); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// removeHandle 需要在lockMutex内调用
+func (m *allEngine) removeHandle(key string) error {
+	m.stopMonitor(key)
+	if handle, has := m.engineList.Get(key); has {
+		err := handle.Engine().Close()
 		if err != nil {
 			return err //关闭出错，不能删除
 		}
 		m.engineList.Remove(key)
+		m.emitEvent(EngineEventClosed, key, nil)
 	}
 	m.connectList.Remove(key)
 	return nil
 }
 
-func (m *allEngine) monitorEngine() {
-	//当dbInstanceMap销毁时，则需要断开连接
-	runtime.SetFinalizer(m.engineList, func(engList cmap.ConcurrentMap[string, *xorm.Engine]) {
-		if engList.IsEmpty() {
-			return
-		}
-		for key, value := range engList.Items() {
-			err := value.Close()
-			if err != nil {
-				logs.DefaultLogger().Error("runCheckEngine SetFinalizer close error:", err.Error())
-			}
-			engList.Remove(key)
-		}
-	})
+// startMonitor 启动检测协程，已经有的会先停止
+func (m *allEngine) startMonitor(key string, interval time.Duration) {
+	m.stopMonitor(key)
+	if interval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	m.monitorList.Set(key, stop)
+	go m.monitorEngine(key, interval, stop)
+}
 
-	//每7分钟检测一次
-	ticker := time.NewTicker(7 * time.Minute)
+func (m *allEngine) stopMonitor(key string) {
+	if stop, has := m.monitorList.Pop(key); has {
+		close(stop)
+	}
+}
+
+func (m *allEngine) monitorEngine(key string, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-stop:
+			return
 		case <-ticker.C:
-			for key, engine := range m.engineList.Items() {
-				if err := engine.Ping(); err != nil { //连接不通的情况
-					connTemp, has := m.connectList.Get(key)
-					if !has {
-						//该配置已经删除了,所以这里也需要删除
-						_ = m.removeByKey(key)
-						continue
-					}
-					newEngine, err := m.getNewEngine(connTemp)
-					if err != nil {
-						log.Printf("Failed to reconnect: %v", err)
-						continue
-					}
-					_ = engine.Close()   //关闭旧的
-					*engine = *newEngine //重新赋值
+			handle, has := m.engineList.Get(key)
+			if !has {
+				return
+			}
+			if err := handle.Engine().Ping(); err != nil { //连接不通的情况
+				m.emitEvent(EngineEventPingFailed, key, err)
+				connTemp, has := m.connectList.Get(key)
+				if !has {
+					//该配置已经删除了,所以这里也需要删除
+					m.lockMutex.Lock()
+					_ = m.removeByKey(key)
+					m.lockMutex.Unlock()
+					return
 				}
+				m.reconnect(handle, connTemp)
 			}
-
 		}
 	}
 }
 
+// reconnect 新建engine并原子替换，旧engine上正在执行的语句完成后再关闭
+func (m *allEngine) reconnect(handle *EngineHandle, con *startupcfg.MysqlConfig) {
+	newEngine, err := m.getNewEngine(con, m.getPoolConfig(handle.poolKey))
+	if err != nil {
+		m.emitEvent(EngineEventReconnectFailed, handle.key, err)
+		return
+	}
+	// 连接时没有加锁，期间handle可能已被 CloseEngine 等移除，移除后不能再替换
+	m.lockMutex.Lock()
+	defer m.lockMutex.Unlock()
+	if current, has := m.engineList.Get(handle.key); !has || current != handle {
+		_ = newEngine.Close()
+		return
+	}
+	oldEngine, err := handle.swap(newEngine)
+	if err != nil {
+		_ = newEngine.Close()
+		m.emitEvent(EngineEventReconnectFailed, handle.key, err)
+		return
+	}
+	m.emitEvent(EngineEventReconnected, handle.key, nil)
+	go func() {
+		if err := drainAndClose(oldEngine, EngineCloseGracePeriod, EngineDrainTimeout); err != nil {
+			logs.DefaultLogger().Error("close old engine error:", err.Error())
+		}
+	}()
+}
+
 func (m *allEngine) getCacheKey(con *startupcfg.MysqlConfig) string {
 	return crypto.Md5(con.DatasourceName())
 }
+
+// SetPoolConfig 设置全局连接池中某个连接的连接池配置
+func SetPoolConfig(con *startupcfg.MysqlConfig, pool *PoolConfig) {
+	defaultAllEngines.SetPoolConfig(con, pool)
+}
+
+// PoolStats 全局连接池中所有engine的状态
+func PoolStats() map[string]EngineStats {
+	return defaultAllEngines.Stats()
+}
+
+// CloseEngine 关闭并移除全局连接池中某个连接的engine
+func CloseEngine(con *startupcfg.MysqlConfig) error {
+	return defaultAllEngines.CloseEngine(con)
+}
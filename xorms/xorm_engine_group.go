@@ -0,0 +1,143 @@
+package xorms
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-startupcfg/startupcfg"
+	"github.com/magic-lib/go-plat-utils/crypto"
+	"strings"
+	"xorm.io/xorm"
+)
+
+// 从库的负载均衡策略
+const (
+	GroupPolicyRoundRobin       = "round_robin"
+	GroupPolicyRandom           = "random"
+	GroupPolicyWeightRoundRobin = "weight_round_robin"
+	GroupPolicyWeightRandom     = "weight_random"
+	GroupPolicyLeastConn        = "least_conn"
+)
+
+// MysqlGroupConfig 一主多从的配置，查询走从库，写入和事务走主库
+type MysqlGroupConfig struct {
+	Master  *startupcfg.MysqlConfig   `json:"master" yaml:"master"`
+	Slaves  []*startupcfg.MysqlConfig `json:"slaves" yaml:"slaves"`
+	Policy  string                    `json:"policy" yaml:"policy"`   // 从库负载均衡策略，默认为 round_robin
+	Weights []int                     `json:"weights" yaml:"weights"` // 权重策略时每个从库的权重，与 Slaves 一一对应
+}
+
+type forceMasterKey struct{}
+
+// ForceMaster 返回强制走主库的context，用于写后立即读的场景
+func ForceMaster(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, forceMasterKey{}, true)
+}
+
+// IsForceMaster 是否强制走主库
+func IsForceMaster(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	force, _ := ctx.Value(forceMasterKey{}).(bool)
+	return force
+}
+
+// getGroupPolicy 获取从库的负载均衡策略
+func getGroupPolicy(policy string, weights []int, slaveNum int) (xorm.GroupPolicy, error) {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	isWeight := policy == GroupPolicyWeightRoundRobin || policy == GroupPolicyWeightRandom
+	if isWeight && len(weights) != slaveNum {
+		return nil, fmt.Errorf("weights length %d not match slaves %d", len(weights), slaveNum)
+	}
+	switch policy {
+	case "", GroupPolicyRoundRobin:
+		return xorm.RoundRobinPolicy(), nil
+	case GroupPolicyRandom:
+		return xorm.RandomPolicy(), nil
+	case GroupPolicyWeightRoundRobin:
+		return xorm.WeightRoundRobinPolicy(weights), nil
+	case GroupPolicyWeightRandom:
+		return xorm.WeightRandomPolicy(weights), nil
+	case GroupPolicyLeastConn:
+		return xorm.LeastConnPolicy(), nil
+	}
+	return nil, fmt.Errorf("unsupported group policy: %s", policy)
+}
+
+// GetEngineGroup 获取当前一主多从的engine组，重连后会被替换，需要长期持有时使用 GetEngineGroupHandle
+func (m *allEngine) GetEngineGroup(con *MysqlGroupConfig) (*xorm.EngineGroup, error) {
+	handle, err := m.GetEngineGroupHandle(con)
+	if err != nil {
+		return nil, err
+	}
+	return handle.Group(), nil
+}
+
+// GetEngineGroupHandle 获取一主多从的engine组句柄，组内的engine为该组独有，不与 GetEngine 共用
+func (m *allEngine) GetEngineGroupHandle(con *MysqlGroupConfig) (*EngineGroupHandle, error) {
+	if con == nil || con.Master == nil {
+		return nil, fmt.Errorf("group master is nil")
+	}
+	m.init()
+
+	cacheKey := m.getGroupCacheKey(con)
+	if group, has := m.groupList.Get(cacheKey); has {
+		return group, nil
+	}
+
+	policy, err := getGroupPolicy(con.Policy, con.Weights, len(con.Slaves))
+	if err != nil {
+		return nil, err
+	}
+
+	m.lockMutex.Lock()
+	defer m.lockMutex.Unlock()
+	if group, has := m.groupList.Get(cacheKey); has {
+		return group, nil
+	}
+	group := &EngineGroupHandle{
+		key:    cacheKey,
+		policy: policy,
+	}
+	if err = m.newGroupEngines(group, con); err != nil {
+		_ = m.removeGroup(group)
+		return nil, err
+	}
+	m.groupList.Set(cacheKey, group)
+	return group, nil
+}
+
+// newGroupEngines 新建组内的engine并生成engine组，需要在lockMutex内调用
+func (m *allEngine) newGroupEngines(group *EngineGroupHandle, con *MysqlGroupConfig) error {
+	master, err := m.newEngineHandle(group.key+":master", con.Master)
+	if err != nil {
+		return fmt.Errorf("master engine error: %w", err)
+	}
+	master.group = group
+	group.master = master
+	for i, oneSlave := range con.Slaves {
+		slave, err := m.newEngineHandle(fmt.Sprintf("%s:slave:%d", group.key, i), oneSlave)
+		if err != nil {
+			return fmt.Errorf("slave engine error: %s, %w", oneSlave.Address, err)
+		}
+		slave.group = group
+		group.slaves = append(group.slaves, slave)
+	}
+	group.lock.Lock()
+	defer group.lock.Unlock()
+	return group.build(nil, nil)
+}
+
+func (m *allEngine) getGroupCacheKey(con *MysqlGroupConfig) string {
+	keyList := []string{m.getCacheKey(con.Master), con.Policy}
+	for _, one := range con.Slaves {
+		keyList = append(keyList, m.getCacheKey(one))
+	}
+	for _, one := range con.Weights {
+		keyList = append(keyList, fmt.Sprint(one))
+	}
+	return crypto.Md5(strings.Join(keyList, "|"))
+}
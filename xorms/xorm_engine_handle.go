@@ -0,0 +1,197 @@
+package xorms
+
+import (
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/logs"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xorm.io/xorm"
+)
+
+// 连接事件类型
+const (
+	EngineEventPingFailed      = "ping_failed"
+	EngineEventReconnected     = "reconnected"
+	EngineEventReconnectFailed = "reconnect_failed"
+	EngineEventClosed          = "closed"
+)
+
+var (
+	// EngineCloseGracePeriod 切换engine后，旧engine至少保留的时间，切换前刚取到旧engine的调用方可以继续使用
+	EngineCloseGracePeriod = 5 * time.Second
+	// EngineDrainTimeout 宽限期之后，等待旧engine上正在执行的语句完成的最长时间
+	EngineDrainTimeout = 30 * time.Second
+	drainCheckInterval = 100 * time.Millisecond
+)
+
+// EngineEvent 连接事件，如重连成功、失败
+type EngineEvent struct {
+	Type     string
+	Key      string
+	Address  string
+	Database string
+	Err      error
+	Time     time.Time
+}
+
+// EngineEventListener 连接事件的回调，不能阻塞
+type EngineEventListener func(event EngineEvent)
+
+// EngineHandle 稳定的engine句柄，重连时底层的engine会原子替换，使用方每次通过 Engine() 获取
+type EngineHandle struct {
+	key        string
+	poolKey    string //连接的key，连接池配置按连接设置，组内的engine与单独的engine共用
+	group      *EngineGroupHandle
+	engine     atomic.Pointer[xorm.Engine]
+	configLock sync.Mutex
+	configList map[string]func(*xorm.Engine) //替换engine后需要重新执行的设置，如日志、表名映射
+}
+
+func newEngineHandle(key string, poolKey string, engine *xorm.Engine) *EngineHandle {
+	h := &EngineHandle{
+		key:        key,
+		poolKey:    poolKey,
+		configList: make(map[string]func(*xorm.Engine)),
+	}
+	h.engine.Store(engine)
+	return h
+}
+
+// Engine 当前使用的engine，不要长期持有，重连后会被关闭
+func (h *EngineHandle) Engine() *xorm.Engine {
+	return h.engine.Load()
+}
+
+// Configure 设置engine，重连替换engine后会重新执行，相同name的设置只保留最后一次
+func (h *EngineHandle) Configure(name string, fn func(*xorm.Engine)) {
+	h.configLock.Lock()
+	defer h.configLock.Unlock()
+	h.configList[name] = fn
+	fn(h.Engine())
+}
+
+// swap 替换为新的engine，返回旧的engine，属于engine组时同时重新生成engine组
+func (h *EngineHandle) swap(newEngine *xorm.Engine) (*xorm.Engine, error) {
+	h.configLock.Lock()
+	defer h.configLock.Unlock()
+	for _, fn := range h.configList {
+		fn(newEngine)
+	}
+	if h.group == nil {
+		return h.engine.Swap(newEngine), nil
+	}
+	g := h.group
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if err := g.build(h, newEngine); err != nil {
+		return nil, err
+	}
+	return h.engine.Swap(newEngine), nil
+}
+
+// drainAndClose 宽限期过后，等旧engine上正在使用的连接都释放后再关闭，超时后强制关闭
+func drainAndClose(engine *xorm.Engine, gracePeriod time.Duration, timeout time.Duration) error {
+	time.Sleep(gracePeriod)
+	deadline := time.Now().Add(timeout)
+	for engine.DB().Stats().InUse > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainCheckInterval)
+	}
+	return engine.Close()
+}
+
+// EngineGroupHandle 稳定的engine组句柄，组内的engine被替换时会重新生成engine组
+// 组内的engine为该组独有，xorm会把engine组记录在engine上，不能与其他组或 GetEngine 共用
+type EngineGroupHandle struct {
+	key    string
+	master *EngineHandle
+	slaves []*EngineHandle
+	policy xorm.GroupPolicy
+	lock   sync.Mutex
+	group  atomic.Pointer[xorm.EngineGroup]
+}
+
+// Master 主库的句柄
+func (g *EngineGroupHandle) Master() *EngineHandle {
+	return g.master
+}
+
+// Slaves 从库的句柄
+func (g *EngineGroupHandle) Slaves() []*EngineHandle {
+	return g.slaves
+}
+
+// Group 当前的engine组，不要长期持有
+func (g *EngineGroupHandle) Group() *xorm.EngineGroup {
+	return g.group.Load()
+}
+
+// build 生成engine组，replace不为nil时使用newEngine替换它当前的engine，需要在lock内调用
+func (g *EngineGroupHandle) build(replace *EngineHandle, newEngine *xorm.Engine) error {
+	current := func(h *EngineHandle) *xorm.Engine {
+		if h == replace {
+			return newEngine
+		}
+		return h.Engine()
+	}
+	slaves := make([]*xorm.Engine, 0, len(g.slaves))
+	for _, one := range g.slaves {
+		slaves = append(slaves, current(one))
+	}
+	group, err := xorm.NewEngineGroup(current(g.master), slaves, g.policy)
+	if err != nil {
+		return fmt.Errorf("new engine group error: %w", err)
+	}
+	g.group.Store(group)
+	return nil
+}
+
+// handles 组内所有的engine句柄，创建失败时可能只有一部分
+func (g *EngineGroupHandle) handles() []*EngineHandle {
+	list := make([]*EngineHandle, 0, len(g.slaves)+1)
+	if g.master != nil {
+		list = append(list, g.master)
+	}
+	return append(list, g.slaves...)
+}
+
+// OnEvent 注册连接事件的回调
+func (m *allEngine) OnEvent(listener EngineEventListener) {
+	if listener == nil {
+		return
+	}
+	m.eventLock.Lock()
+	defer m.eventLock.Unlock()
+	m.eventListeners = append(m.eventListeners, listener)
+}
+
+// emitEvent 打印日志并通知回调
+func (m *allEngine) emitEvent(eventType string, key string, err error) {
+	event := EngineEvent{
+		Type: eventType,
+		Key:  key,
+		Err:  err,
+		Time: time.Now(),
+	}
+	if con, has := m.connectList.Get(key); has {
+		event.Address = con.Address
+		event.Database = con.Database
+	}
+	if err != nil {
+		logs.DefaultLogger().Error("mysql engine event:", eventType, event.Address, event.Database, err.Error())
+	} else {
+		logs.DefaultLogger().Info("mysql engine event:", eventType, event.Address, event.Database)
+	}
+
+	m.eventLock.RLock()
+	listeners := append([]EngineEventListener{}, m.eventListeners...)
+	m.eventLock.RUnlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// OnEngineEvent 注册全局连接池的连接事件回调
+func OnEngineEvent(listener EngineEventListener) {
+	defaultAllEngines.OnEvent(listener)
+}
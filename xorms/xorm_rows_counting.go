@@ -0,0 +1,71 @@
+package xorms
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// rowsCountingConnector 查询时统计返回的行数，交给审计，ctx中没有 rowsCounter 时不统计
+type rowsCountingConnector struct {
+	driver.Connector
+}
+
+type rowsCountingConn struct {
+	fullConn
+}
+
+func (c *rowsCountingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if one, ok := conn.(fullConn); ok {
+		return &rowsCountingConn{fullConn: one}, nil
+	}
+	return conn, nil
+}
+
+func (c *rowsCountingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.fullConn.QueryContext(ctx, query, args)
+	if err != nil {
+		return rows, err
+	}
+	counter, _ := ctx.Value(rowsCounterKey{}).(*rowsCounter)
+	one, ok := rows.(fullRows)
+	if counter == nil || !ok {
+		return rows, nil
+	}
+	counter.attach()
+	return &countingRows{fullRows: one, counter: counter}, nil
+}
+
+// fullRows mysql驱动的结果集实现的接口，xorm需要字段类型
+type fullRows interface {
+	driver.Rows
+	driver.RowsNextResultSet
+	driver.RowsColumnTypeDatabaseTypeName
+	driver.RowsColumnTypeNullable
+	driver.RowsColumnTypePrecisionScale
+	driver.RowsColumnTypeScanType
+}
+
+// countingRows 统计读取的行数，关闭时通知
+type countingRows struct {
+	fullRows
+	counter *rowsCounter
+	rows    int64
+}
+
+func (r *countingRows) Next(dest []driver.Value) error {
+	err := r.fullRows.Next(dest)
+	if err == nil {
+		r.rows++
+	}
+	return err
+}
+
+func (r *countingRows) Close() error {
+	err := r.fullRows.Close()
+	r.counter.close(r.rows)
+	return err
+}
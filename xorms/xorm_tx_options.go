@@ -0,0 +1,74 @@
+package xorms
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/go-sql-driver/mysql"
+)
+
+type txOptionsKey struct{}
+
+// withTxOptions 在ctx中带上事务的配置，xorm的Begin不支持TxOptions，开启事务时由连接读取
+func withTxOptions(ctx context.Context, options *transOptions) context.Context {
+	if options.isolation == sql.LevelDefault && !options.readOnly {
+		return ctx
+	}
+	return context.WithValue(ctx, txOptionsKey{}, driver.TxOptions{
+		Isolation: driver.IsolationLevel(options.isolation),
+		ReadOnly:  options.readOnly,
+	})
+}
+
+// txOptionsConnector 开启事务时使用ctx中的配置，由驱动设置隔离级别和只读，database/sql 能正确跟踪事务状态
+type txOptionsConnector struct {
+	driver.Connector
+}
+
+// fullConn mysql驱动的连接实现的接口
+type fullConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+	driver.NamedValueChecker
+}
+
+type txOptionsConn struct {
+	fullConn
+}
+
+func (c *txOptionsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if one, ok := conn.(fullConn); ok {
+		return &txOptionsConn{fullConn: one}, nil
+	}
+	return conn, nil
+}
+
+func (c *txOptionsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if ctxOpts, ok := ctx.Value(txOptionsKey{}).(driver.TxOptions); ok {
+		opts = ctxOpts
+	}
+	return c.fullConn.BeginTx(ctx, opts)
+}
+
+// openMysqlDB 打开数据库，事务支持ctx中的隔离级别和只读配置，查询的行数交给审计统计
+func openMysqlDB(dsn string) (*sql.DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(&rowsCountingConnector{Connector: &txOptionsConnector{Connector: connector}}), nil
+}